@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/WeiZhang555/tabwriter"
+	"github.com/dfang/bin/pkg/cache"
+	"github.com/dfang/bin/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+type cacheCmd struct {
+	cmd *cobra.Command
+}
+
+func newCacheCmd() *cacheCmd {
+	root := &cacheCmd{}
+	// nolint: dupl
+	cmd := &cobra.Command{
+		Use:           "cache",
+		Short:         "Manages the download cache",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+
+	cmd.AddCommand(
+		newCacheListCmd(),
+		newCacheCleanCmd(),
+		newCacheSizeCmd(),
+		newCachePathCmd(),
+	)
+
+	root.cmd = cmd
+	return root
+}
+
+func newCacheListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:           "list",
+		Aliases:       []string{"ls"},
+		Short:         "Lists the cached assets",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		Args:          cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := cache.Default().List()
+			if err != nil {
+				return err
+			}
+
+			w := new(tabwriter.Writer)
+			w.Init(os.Stdout, 8, 8, 3, '\t', 0)
+
+			defer w.Flush()
+
+			fmt.Fprintf(w, "\n %s\t%s\t%s\t%s\t%s", "Repo", "Version", "Asset", "Size", "Last used")
+			for _, e := range entries {
+				fmt.Fprintf(w, "\n %s\t%s\t%s\t%s\t%s", e.Provider+"/"+e.Repo, e.Version, e.Asset, humanSize(e.Size), e.LastUsed.Local().Format("2006-01-02 15:04"))
+			}
+			fmt.Fprintf(w, "\n\n")
+			return nil
+		},
+	}
+}
+
+func newCacheCleanCmd() *cobra.Command {
+	var olderThan time.Duration
+	cmd := &cobra.Command{
+		Use:           "clean",
+		Short:         "Removes the cached assets",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		Args:          cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c := cache.Default()
+			before, err := c.Size()
+			if err != nil {
+				return err
+			}
+
+			var t time.Time
+			if olderThan > 0 {
+				t = time.Now().Add(-olderThan)
+			}
+			if err := c.Clean(t); err != nil {
+				return err
+			}
+
+			after, err := c.Size()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Removed %s from %s\n", humanSize(before-after), c.Dir())
+			return nil
+		},
+	}
+	cmd.Flags().DurationVarP(&olderThan, "older-than", "", 0, "Only remove the assets that haven't been used for this long, e.g. 720h")
+	return cmd
+}
+
+func newCacheSizeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:           "size",
+		Short:         "Prints the disk usage of the cache",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		Args:          cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			size, err := cache.Default().Size()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s (limit %s)\n", humanSize(size), humanSize(config.GetCacheMaxSize()))
+			return nil
+		},
+	}
+}
+
+func newCachePathCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:           "path",
+		Short:         "Prints the directory of the cache",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		Args:          cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fmt.Println(cache.Default().Dir())
+			return nil
+		},
+	}
+}
+
+// humanSize formats a size in bytes with a binary unit.
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
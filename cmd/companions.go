@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/apex/log"
+	"github.com/dfang/bin/pkg/assets"
+	"github.com/dfang/bin/pkg/config"
+	"github.com/dfang/bin/pkg/providers"
+)
+
+// installCompanions installs the shell completions and man pages of f
+// under the XDG data directory and returns their paths. The binary is
+// installed already, so failures are only reported.
+func installCompanions(f *providers.File) []string {
+	if len(f.Companions) == 0 {
+		return nil
+	}
+	defer closeCompanions(f.Companions)
+
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		log.Warnf("Error installing the completions and man pages of %s: %v", f.Name, err)
+		return nil
+	}
+
+	paths := []string{}
+	for _, c := range f.Companions {
+		p := filepath.Join(dataDir, filepath.FromSlash(c.Path))
+		if err := writeCompanion(p, c.Source); err != nil {
+			log.Warnf("Error installing %s: %v", p, err)
+			continue
+		}
+		log.Debugf("Installed %s", p)
+		paths = append(paths, p)
+	}
+	log.Infof("Installed %d completions and man pages of %s in %s", len(paths), f.Name, dataDir)
+	return paths
+}
+
+func writeCompanion(p string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// removeCompanions removes the completions and man pages installed at paths.
+func removeCompanions(paths []string) error {
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func closeCompanions(companions []*assets.Companion) {
+	for _, c := range companions {
+		if c, ok := c.Source.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/apex/log"
+	"github.com/dfang/bin/pkg/cache"
 	"github.com/dfang/bin/pkg/config"
 	"github.com/dfang/bin/pkg/providers"
 	"github.com/fatih/color"
@@ -12,7 +14,14 @@ import (
 )
 
 type ensureCmd struct {
-	cmd *cobra.Command
+	cmd  *cobra.Command
+	opts ensureOpts
+}
+
+type ensureOpts struct {
+	offline     bool
+	platform    string
+	parallelism int
 }
 
 func newEnsureCmd() *ensureCmd {
@@ -25,6 +34,10 @@ func newEnsureCmd() *ensureCmd {
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			platform, err := config.ParsePlatform(root.opts.platform)
+			if err != nil {
+				return err
+			}
 			cfg := config.Get()
 			binsToProcess := map[string]*config.Binary{}
 
@@ -44,43 +57,110 @@ func newEnsureCmd() *ensureCmd {
 			// TODO: code smell here, this pretty much does
 			// the same thing as install logic. Refactor to
 			// use the same code in both places
-			for _, binCfg := range binsToProcess {
+			jobs := []job{}
+			bins := []*config.Binary{}
+			for _, binCfg := range sortedBinaries(binsToProcess) {
 				ep := os.ExpandEnv(binCfg.Path)
 				_, err := os.Stat(ep)
 				if !os.IsNotExist(err) {
 					continue
 				}
 
-				p, err := providers.New(binCfg.URL, binCfg.Provider)
-				if err != nil {
-					return err
-				}
+				binCfg := binCfg
+				jobs = append(jobs, job{name: binCfg.Path, run: func() error {
+					return root.ensure(binCfg, platform)
+				}})
+				bins = append(bins, binCfg)
+			}
 
-				pResult, err := p.Fetch(&providers.FetchOpts{})
-				if err != nil {
-					return err
-				}
+			// binaries missing from the download cache don't
+			// prevent the others from being installed
+			results := runJobs(jobs, root.opts.parallelism, func(err error) bool {
+				return !errors.Is(err, cache.ErrNotCached)
+			})
+			err = reportResults("install", results)
 
-				if err = installBinary(pResult, ep, true); err != nil {
-					return fmt.Errorf("Error installing binary %w", err)
+			missing := []*config.Binary{}
+			for i, r := range results {
+				if errors.Is(r.err, cache.ErrNotCached) {
+					missing = append(missing, bins[i])
 				}
-
-				err = config.UpsertBinary(&config.Binary{
-					RemoteName: pResult.Name,
-					Path:       binCfg.Path,
-					Version:    pResult.Version,
-					Hash:       fmt.Sprintf("%x", pResult.Hash.Sum(nil)),
-					URL:        binCfg.URL,
-				})
-				if err != nil {
-					return err
+			}
+			if len(missing) > 0 {
+				log.Warnf("%d binaries are missing from the download cache in %s:", len(missing), cache.Default().Dir())
+				for _, b := range missing {
+					log.Warnf("  %s %s", b.Path, b.Version)
 				}
-				log.Infof("Done ensuring %s to %s", binCfg.Path, color.GreenString(binCfg.Version))
 			}
-			return nil
+			return err
 		},
 	}
 
 	root.cmd = cmd
+	root.cmd.Flags().BoolVarP(&root.opts.offline, "offline", "", false, "Install the recorded versions from the download cache without reaching the providers")
+	addPlatformFlag(root.cmd, &root.opts.platform)
+	addParallelismFlag(root.cmd, &root.opts.parallelism)
 	return root
 }
+
+// ensure installs the recorded version of binCfg.
+func (root *ensureCmd) ensure(binCfg *config.Binary, flag *config.Platform) error {
+	ep := os.ExpandEnv(binCfg.Path)
+	p, err := providers.New(binCfg.URL, binCfg.Provider)
+	if err != nil {
+		return err
+	}
+	platform, err := binaryPlatform(flag, binCfg)
+	if err != nil {
+		return err
+	}
+
+	// the package path selects the binary of a bundle in the shared asset
+	pResult, err := providers.Fetch(p, &providers.FetchOpts{PackagePath: binCfg.PackagePath, Verification: binCfg.Verification, Platform: platform, Rules: config.GetAssetRules(binCfg.AssetRules), AssetTemplate: binaryAssetTemplate(platform, binCfg), Offline: root.opts.offline, Version: binCfg.Version, Companions: len(binCfg.Companions) > 0})
+	if err != nil {
+		return err
+	}
+
+	digest, err := installBinary(pResult, ep, true)
+	if err != nil {
+		return fmt.Errorf("Error installing binary %w", err)
+	}
+
+	var desktop *config.Desktop
+	if binCfg.Desktop != nil {
+		desktop = installDesktop(binCfg.Path)
+	}
+	companions := installCompanions(pResult)
+
+	// the asset may have been selected by the scoring alone
+	template := pResult.AssetTemplate
+	if template == "" {
+		template = binaryAssetTemplate(platform, binCfg)
+	}
+
+	err = config.UpsertBinary(&config.Binary{
+		RemoteName:    pResult.Name,
+		Path:          binCfg.Path,
+		Version:       pResult.Version,
+		Hash:          digest.Value,
+		URL:           binCfg.URL,
+		Provider:      binCfg.Provider,
+		PackagePath:   pResult.PackagePath,
+		Checksum:      pResult.Checksum,
+		Verification:  binCfg.Verification,
+		Provenance:    pResult.Provenance,
+		AssetDigest:   pResult.AssetDigest,
+		BinaryDigest:  digest,
+		Desktop:       desktop,
+		Bundle:        binCfg.Bundle,
+		Companions:    companions,
+		AssetRules:    binCfg.AssetRules,
+		AssetTemplate: template,
+		Platform:      platformString(platform),
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof("Done ensuring %s to %s", binCfg.Path, color.GreenString(binCfg.Version))
+	return nil
+}
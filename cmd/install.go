@@ -1,15 +1,21 @@
 package cmd
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/apex/log"
+	"github.com/dfang/bin/pkg/appimage"
+	"github.com/dfang/bin/pkg/assets"
 	"github.com/dfang/bin/pkg/config"
 	"github.com/dfang/bin/pkg/providers"
 	"github.com/dfang/bin/pkg/util"
@@ -24,41 +30,49 @@ type installCmd struct {
 }
 
 type installOpts struct {
-	force    bool
-	provider string
-	all      bool
+	force           bool
+	provider        string
+	all             bool
+	requireChecksum bool
+	skipChecksum    bool
+	cosign          config.CosignPolicy
+	cosignRegexp    string
+	minisignKey     string
+	signifyKey      string
+	gpg             config.GPGPolicy
+	provenance      config.ProvenancePolicy
+	offline         bool
+	desktop         bool
+	pick            []string
+	pickMany        bool
+	companions      bool
+	include         []string
+	exclude         []string
+	weights         map[string]int
+	platform        string
+	parallelism     int
 }
 
 func newInstallCmd() *installCmd {
 	root := &installCmd{}
 	// nolint: dupl
 	cmd := &cobra.Command{
-		Use:           "install <url>",
+		Use:           "install <url>... [path]",
 		Aliases:       []string{"i"},
-		Short:         "Installs the specified project from a url",
+		Short:         "Installs the specified projects from their urls",
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		Args:          cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			zlog.Trace().Msgf("args: %v", args)
-			u := args[0]
-
-			// <OWNER>/<REPO> -> github.com/<OWNER/<REPO>
-			if !strings.Contains(u, "github.com") {
-				if strings.Contains(u, "/") {
-					u = fmt.Sprintf("github.com/%s", u)
-				} else {
-					u = DEFAULT_SHORTHANDS[u]
-				}
-			}
+			specs, argpath := installArgs(args)
 
 			var installDir string
-			var fpath, argpath string
-			if len(args) > 1 {
-				argpath = args[1]
+			var fpath string
+			if argpath != "" {
 				var err error
 				// Resolve to absolute path
-				if fpath, err = filepath.Abs(os.ExpandEnv(args[1])); err != nil {
+				if fpath, err = filepath.Abs(os.ExpandEnv(argpath)); err != nil {
 					return err
 				}
 			} else if len(config.Get().DefaultPath) > 0 {
@@ -78,69 +92,39 @@ func newInstallCmd() *installCmd {
 			}
 			installDir = fpath
 
-			// TODO check if binary already exists in config
-			// and triger the update process if that's the case
+			if len(specs) > 1 {
+				if fi, err := os.Stat(os.ExpandEnv(fpath)); err == nil && !fi.IsDir() {
+					return fmt.Errorf("%s must be a directory to install several binaries", argpath)
+				}
+			}
 
-			p, err := providers.New(u, root.opts.provider)
+			verification, err := root.opts.verification()
 			if err != nil {
 				return err
 			}
-			zlog.Trace().Msgf("provider %+v", p)
-
-			pResult, err := p.Fetch(&providers.FetchOpts{All: root.opts.all})
+			rules, err := root.opts.assetRules()
 			if err != nil {
 				return err
 			}
-			fmt.Printf("pResult %+v\n", pResult)
-			fmt.Printf("fpath: %+v\n", fpath)
-
-			fpath, err = checkFinalPath(fpath, pResult.Name)
+			platform, err := config.ParsePlatform(root.opts.platform)
 			if err != nil {
 				return err
 			}
-			fmt.Printf("fpath: %+v\n", fpath)
 
-			if len(argpath) == 0 {
-				argpath = fpath
-			}
-			fmt.Printf("argpath: %+v\n", argpath)
-
-			// fileName := util.CanonicalizeBinaryName(pResult.Name)
-			fileName := util.CanonicalizeBinaryName(pResult.Name)
-			dpath := path.Join(installDir, fileName)
-			fmt.Printf("will install to %s\n", dpath)
-
-			// install binary to path in config
-			// fmt.Printf("install binary to path in config: %s\n", "~/bin/")
-			fmt.Println("pResult", pResult)
-			fmt.Println("dpath", dpath)
-			// fmt.Println(root.opts.force)
-			if err = installBinary(pResult, dpath, root.opts.force); err != nil {
-				return fmt.Errorf("error installing binary: %w", err)
+			// a single binary is installed as before,
+			// several ones are installed concurrently
+			if len(specs) == 1 {
+				return root.install(specs[0], fpath, argpath, installDir, verification, rules, platform)
 			}
 
-			err = config.UpsertBinary(&config.Binary{
-				RemoteName:  pResult.Name,
-				Path:        fpath,
-				Version:     pResult.Version,
-				Hash:        fmt.Sprintf("%x", pResult.Hash.Sum(nil)),
-				URL:         u,
-				Provider:    p.GetID(),
-				PackagePath: pResult.PackagePath,
-			})
-
-			if err != nil {
-				return err
+			jobs := make([]job, 0, len(specs))
+			for _, spec := range specs {
+				spec := spec
+				jobs = append(jobs, job{name: spec, run: func() error {
+					return root.install(spec, fpath, argpath, installDir, verification, rules, platform)
+				}})
 			}
-
-			zlog.Info().Msgf("Done installing %s %s", pResult.Name, pResult.Version)
-			zlog.Info().Msgf("Run %s --help to verify installation", pResult.Name)
-			_ = execShell(dpath, []string{"--help"})
-			// if err != nil {
-			// 	fmt.Println("the installed binary can't not run successfully, please report on github issues ???")
-			// }
-
-			return nil
+			return reportResults("install", runJobs(jobs, root.opts.parallelism, nil))
 		},
 	}
 
@@ -148,9 +132,364 @@ func newInstallCmd() *installCmd {
 	root.cmd.Flags().BoolVarP(&root.opts.force, "force", "f", false, "Force the installation even if the file already exists")
 	root.cmd.Flags().BoolVarP(&root.opts.all, "all", "a", false, "Show all possible download options (skip scoring & filtering)")
 	root.cmd.Flags().StringVarP(&root.opts.provider, "provider", "p", "", "Forces to use a specific provider")
+	root.cmd.Flags().BoolVarP(&root.opts.requireChecksum, "require-checksum", "", false, "Fail if the release doesn't publish a checksum for the downloaded asset")
+	root.cmd.Flags().BoolVarP(&root.opts.skipChecksum, "skip-checksum", "", false, "Skip the checksum validation of the downloaded asset")
+	root.cmd.MarkFlagsMutuallyExclusive("require-checksum", "skip-checksum")
+	root.cmd.Flags().StringVarP(&root.opts.cosign.Key, "cosign-key", "", "", "Verify cosign signatures with the given PEM public key")
+	root.cmd.Flags().StringVarP(&root.opts.cosign.Identity, "cosign-identity", "", "", "Expected identity of the keyless cosign signing certificate")
+	root.cmd.Flags().StringVarP(&root.opts.cosignRegexp, "cosign-identity-regexp", "", "", "Regular expression matching the identity of the keyless cosign signing certificate")
+	root.cmd.Flags().StringVarP(&root.opts.cosign.Issuer, "cosign-issuer", "", "", "Expected OIDC issuer of the keyless cosign signing certificate")
+	root.cmd.Flags().StringVarP(&root.opts.cosign.TrustedRoot, "cosign-trusted-root", "", "", "Sigstore trusted_root.json or PEM bundle used to verify keyless cosign signatures")
+	root.cmd.MarkFlagsMutuallyExclusive("cosign-identity", "cosign-identity-regexp")
+	root.cmd.Flags().StringVarP(&root.opts.minisignKey, "minisign-key", "", "", "Pin the minisign public key (or path to the .pub file) the release must be signed with")
+	root.cmd.Flags().StringVarP(&root.opts.signifyKey, "signify-key", "", "", "Pin the signify public key (or path to the .pub file) the release must be signed with")
+	root.cmd.Flags().StringVarP(&root.opts.gpg.Fingerprint, "gpg-fingerprint", "", "", "Pin the fingerprint of the OpenPGP key the release must be signed with")
+	root.cmd.Flags().StringVarP(&root.opts.gpg.Keyring, "gpg-keyring", "", "", "Directory with the OpenPGP public keys (defaults to keyring/ in the config directory)")
+	root.cmd.Flags().StringVarP(&root.opts.provenance.SourceRepo, "provenance-repo", "", "", "Require a SLSA provenance or GitHub attestation showing the asset was built from this repository")
+	root.cmd.Flags().StringVarP(&root.opts.provenance.SourceRef, "provenance-ref", "", "", "Glob the git ref of the provenance must match, e.g. refs/tags/*")
+	root.cmd.Flags().StringVarP(&root.opts.provenance.BuilderID, "provenance-builder", "", "", "Expected builder id of the provenance")
+	root.cmd.Flags().StringVarP(&root.opts.provenance.Signer.Key, "provenance-key", "", "", "Verify the provenance signature with the given PEM public key")
+	root.cmd.Flags().StringVarP(&root.opts.provenance.Signer.Issuer, "provenance-issuer", "", "https://token.actions.githubusercontent.com", "Expected OIDC issuer of the provenance signing certificate")
+	root.cmd.Flags().StringVarP(&root.opts.provenance.Signer.TrustedRoot, "provenance-trusted-root", "", "", "Sigstore trusted_root.json or PEM bundle used to verify the provenance signing certificate")
+	root.cmd.Flags().BoolVarP(&root.opts.offline, "offline", "", false, "Install the release from the download cache without reaching the provider")
+	root.cmd.Flags().StringSliceVarP(&root.opts.pick, "pick", "", nil, "Install the files of the archive matching these globs, e.g. 'bin/*', as separate binaries")
+	root.cmd.Flags().BoolVarP(&root.opts.pickMany, "multiple", "m", false, "Select several files of the archive to install as separate binaries")
+	root.cmd.MarkFlagsMutuallyExclusive("pick", "multiple")
+	root.cmd.Flags().BoolVarP(&root.opts.companions, "companions", "", false, "Also install the shell completions and man pages shipped in the archive")
+	root.cmd.Flags().StringArrayVarP(&root.opts.include, "include", "", nil, "Only consider the assets whose name matches this regular expression, can be repeated")
+	root.cmd.Flags().StringArrayVarP(&root.opts.exclude, "exclude", "", nil, "Skip the assets whose name matches this regular expression, can be repeated")
+	root.cmd.Flags().StringToIntVarP(&root.opts.weights, "weight", "", nil, "Override the score of a word in the asset names, e.g. musl=20")
+	root.cmd.Flags().BoolVarP(&root.opts.desktop, "desktop", "", false, "Install the desktop entry and icon of AppImages so they show up in the application menus")
+	addPlatformFlag(root.cmd, &root.opts.platform)
+	addParallelismFlag(root.cmd, &root.opts.parallelism)
 	return root
 }
 
+// install installs the binary of the project at u into fpath.
+func (root *installCmd) install(u, fpath, argpath, installDir string, verification *config.Verification, rules *config.AssetRules, platform *config.Platform) error {
+	// <OWNER>/<REPO> -> github.com/<OWNER/<REPO>
+	if !strings.Contains(u, "github.com") {
+		if strings.Contains(u, "/") {
+			u = fmt.Sprintf("github.com/%s", u)
+		} else {
+			u = DEFAULT_SHORTHANDS[u]
+		}
+	}
+
+	// TODO check if binary already exists in config
+	// and triger the update process if that's the case
+
+	p, err := providers.New(u, root.opts.provider)
+	if err != nil {
+		return err
+	}
+	zlog.Trace().Msgf("provider %+v", p)
+
+	pResult, err := providers.Fetch(p, &providers.FetchOpts{All: root.opts.all, RequireChecksum: root.opts.requireChecksum, SkipChecksum: root.opts.skipChecksum, Verification: verification, Platform: platform, Rules: config.GetAssetRules(rules), Offline: root.opts.offline, Pick: root.opts.pick, PickMany: root.opts.pickMany, Companions: root.opts.companions})
+	if err != nil {
+		return err
+	}
+	zlog.Debug().Msgf("pResult %+v", pResult)
+
+	files := append([]*providers.File{pResult}, pResult.Others...)
+	if len(files) == 1 {
+		return root.installFile(p, u, pResult, fpath, argpath, installDir, verification, rules, platform, "")
+	}
+
+	// every binary picked from the asset is installed as its own
+	// binary, they're updated together as a bundle
+	if fi, err := os.Stat(os.ExpandEnv(fpath)); err != nil || !fi.IsDir() {
+		closeFiles(files)
+		return fmt.Errorf("%s must be a directory to install several binaries", fpath)
+	}
+	bundle, err := checkFinalPath(fpath, pResult.Name)
+	if err != nil {
+		closeFiles(files)
+		return err
+	}
+	for i, f := range files {
+		if err := root.installFile(p, u, f, fpath, argpath, installDir, verification, rules, platform, bundle); err != nil {
+			closeFiles(files[i+1:])
+			return err
+		}
+	}
+	return nil
+}
+
+// closeFiles closes the data of files which won't be installed.
+func closeFiles(files []*providers.File) {
+	for _, f := range files {
+		if c, ok := f.Data.(io.Closer); ok {
+			c.Close()
+		}
+		closeCompanions(f.Companions)
+	}
+}
+
+// installFile installs the binary pResult fetched from u into fpath,
+// bundle is the path of the first binary picked from the same asset.
+func (root *installCmd) installFile(p providers.Provider, u string, pResult *providers.File, fpath, argpath, installDir string, verification *config.Verification, rules *config.AssetRules, platform *config.Platform, bundle string) error {
+	zlog.Debug().Msgf("fpath: %+v", fpath)
+
+	fpath, err := checkFinalPath(fpath, pResult.Name)
+	if err != nil {
+		return err
+	}
+	zlog.Debug().Msgf("fpath: %+v", fpath)
+
+	if len(argpath) == 0 {
+		argpath = fpath
+	}
+	zlog.Debug().Msgf("argpath: %+v", argpath)
+
+	// fileName := util.CanonicalizeBinaryName(pResult.Name)
+	fileName := util.CanonicalizeBinaryName(pResult.Name)
+	dpath := path.Join(installDir, fileName)
+	zlog.Debug().Msgf("will install to %s", dpath)
+
+	// install binary to path in config
+	// fmt.Printf("install binary to path in config: %s\n", "~/bin/")
+	zlog.Debug().Msgf("pResult %v", pResult)
+	zlog.Debug().Msgf("dpath %s", dpath)
+	// fmt.Println(root.opts.force)
+	digest, err := installBinary(pResult, dpath, root.opts.force)
+	if err != nil {
+		return fmt.Errorf("error installing binary: %w", err)
+	}
+
+	var desktop *config.Desktop
+	if root.opts.desktop {
+		desktop = installDesktop(dpath)
+	}
+
+	companions := installCompanions(pResult)
+	if root.opts.companions && bundle == "" && len(companions) == 0 {
+		log.Warnf("No completions or man pages found in the asset of %s", pResult.Name)
+	}
+
+	err = config.UpsertBinary(&config.Binary{
+		RemoteName:    pResult.Name,
+		Path:          fpath,
+		Version:       pResult.Version,
+		Hash:          digest.Value,
+		URL:           u,
+		Provider:      p.GetID(),
+		PackagePath:   pResult.PackagePath,
+		Checksum:      pResult.Checksum,
+		Verification:  verification,
+		Provenance:    pResult.Provenance,
+		AssetDigest:   pResult.AssetDigest,
+		BinaryDigest:  digest,
+		Desktop:       desktop,
+		Bundle:        bundle,
+		Companions:    companions,
+		AssetRules:    rules,
+		AssetTemplate: pResult.AssetTemplate,
+		Platform:      platformString(platform),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	zlog.Info().Msgf("Done installing %s %s", pResult.Name, pResult.Version)
+	if platform != nil {
+		// the binary can't run on this host
+		zlog.Info().Msgf("Installed %s for %s", pResult.Name, platform)
+		return nil
+	}
+	zlog.Info().Msgf("Run %s --help to verify installation", pResult.Name)
+	_ = execShell(dpath, []string{"--help"})
+	// if err != nil {
+	// 	fmt.Println("the installed binary can't not run successfully, please report on github issues ???")
+	// }
+
+	return nil
+}
+
+// installDesktop installs the desktop entry and the icon of the AppImage
+// installed at path. The binary is installed already, so failures are
+// only reported and no desktop integration is recorded.
+func installDesktop(path string) *config.Desktop {
+	d, err := appimage.Integrate(os.ExpandEnv(path))
+	if errors.Is(err, appimage.ErrNotAppImage) {
+		log.Warnf("%s is not an AppImage, skipping the desktop integration", path)
+		return nil
+	} else if err != nil {
+		log.Warnf("Error installing the desktop entry of %s: %v", path, err)
+		return nil
+	}
+	log.Infof("Installed the desktop entry %s", d.Entry)
+	return d
+}
+
+// installArgs splits the arguments of install into the projects to install
+// and the path to install them to. The last argument is the path unless
+// it's a project as well as every other one, e.g. install url mytool
+// installs to mytool.
+func installArgs(args []string) ([]string, string) {
+	n := len(args)
+	if n == 1 {
+		return args, ""
+	}
+	if isInstallPath(args[n-1]) {
+		return args[:n-1], args[n-1]
+	}
+	for _, a := range args[1:] {
+		if !isInstallSpec(a) {
+			return args[:n-1], args[n-1]
+		}
+	}
+	return args, ""
+}
+
+// isInstallSpec tells if arg is a project to install: a provider
+// URL, <OWNER>/<REPO> or a shorthand.
+func isInstallSpec(arg string) bool {
+	if _, ok := DEFAULT_SHORTHANDS[arg]; ok {
+		return true
+	}
+	if strings.Contains(arg, "github.com") || strings.Contains(arg, "releases.hashicorp.com") || strings.Contains(arg, "://") {
+		return true
+	}
+	s := strings.Split(arg, "/")
+	return len(s) == 2 && s[0] != "" && s[1] != ""
+}
+
+// isInstallPath tells if the last argument of install is the path
+// to install to rather than another project to install: paths are
+// absolute or start with ".", "~" or "$", or are existing directories.
+func isInstallPath(arg string) bool {
+	if _, ok := DEFAULT_SHORTHANDS[arg]; ok {
+		return false
+	}
+	if filepath.IsAbs(arg) || strings.HasPrefix(arg, ".") || strings.HasPrefix(arg, "~") || strings.HasPrefix(arg, "$") {
+		return true
+	}
+	if strings.Contains(arg, "github.com") || strings.Contains(arg, "://") {
+		return false
+	}
+	fi, err := os.Stat(arg)
+	return err == nil && fi.IsDir()
+}
+
+// verification builds the signature verification policy from the
+// install flags, it returns nil if no verification was requested.
+func (o *installOpts) verification() (*config.Verification, error) {
+	v := &config.Verification{}
+
+	var err error
+	if o.minisignKey != "" {
+		v.Minisign = &config.MinisignPolicy{}
+		if v.Minisign.PublicKey, err = readPublicKey(o.minisignKey); err != nil {
+			return nil, err
+		}
+	}
+	if o.signifyKey != "" {
+		v.Signify = &config.SignifyPolicy{}
+		if v.Signify.PublicKey, err = readPublicKey(o.signifyKey); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.gpg.Fingerprint != "" {
+		gpg := o.gpg
+		gpg.Fingerprint = assets.NormalizeFingerprint(gpg.Fingerprint)
+		if len(gpg.Fingerprint) != 40 && len(gpg.Fingerprint) != 64 {
+			return nil, fmt.Errorf("--gpg-fingerprint must be a full key fingerprint, got %q", o.gpg.Fingerprint)
+		}
+		if gpg.Keyring, err = absPath(gpg.Keyring); err != nil {
+			return nil, err
+		}
+		v.GPG = &gpg
+	} else if o.gpg.Keyring != "" {
+		return nil, fmt.Errorf("--gpg-keyring requires --gpg-fingerprint")
+	}
+
+	if o.provenance.SourceRepo != "" {
+		provenance := o.provenance
+		if provenance.Signer.Key, err = absPath(provenance.Signer.Key); err != nil {
+			return nil, err
+		}
+		if provenance.Signer.TrustedRoot, err = absPath(provenance.Signer.TrustedRoot); err != nil {
+			return nil, err
+		}
+		if provenance.Signer.Key == "" && provenance.Signer.TrustedRoot == "" {
+			return nil, fmt.Errorf("provenance verification requires --provenance-key or --provenance-trusted-root")
+		}
+		v.Provenance = &provenance
+	}
+
+	cosign := o.cosign
+	if o.cosignRegexp != "" {
+		cosign.Identity = o.cosignRegexp
+		cosign.IdentityRegexp = true
+	}
+
+	if cosign == (config.CosignPolicy{}) {
+		if v.Minisign == nil && v.Signify == nil && v.GPG == nil && v.Provenance == nil {
+			return nil, nil
+		}
+		return v, nil
+	}
+
+	if cosign.Key, err = absPath(cosign.Key); err != nil {
+		return nil, err
+	}
+	if cosign.TrustedRoot, err = absPath(cosign.TrustedRoot); err != nil {
+		return nil, err
+	}
+	if cosign.Key == "" && (cosign.Identity == "" || cosign.Issuer == "" || cosign.TrustedRoot == "") {
+		return nil, fmt.Errorf("keyless cosign verification requires --cosign-identity, --cosign-issuer and --cosign-trusted-root")
+	}
+
+	v.Cosign = &cosign
+	return v, nil
+}
+
+// assetRules builds the asset selection rules of the binary from the
+// install flags, it returns nil if none were given.
+func (o *installOpts) assetRules() (*config.AssetRules, error) {
+	rules := &config.AssetRules{Include: o.include, Exclude: o.exclude, Weights: o.weights}
+	if rules.IsEmpty() {
+		return nil, nil
+	}
+	for _, p := range append(append([]string{}, o.include...), o.exclude...) {
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("invalid asset rule %q: %w", p, err)
+		}
+	}
+	return rules, nil
+}
+
+// readPublicKey returns the base64 line of a minisign or signify public key,
+// given either as the key itself or as the path to its .pub file. The key is
+// stored in the config so it stays pinned even if the file changes.
+func readPublicKey(v string) (string, error) {
+	if bs, err := os.ReadFile(os.ExpandEnv(v)); err == nil {
+		v = string(bs)
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	for _, line := range strings.Split(v, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "untrusted comment:") {
+			return line, nil
+		}
+	}
+	return "", fmt.Errorf("no public key found in %q", v)
+}
+
+// absPath resolves p to an absolute path so it can be
+// stored in the config, empty paths are left untouched.
+func absPath(p string) (string, error) {
+	if p == "" {
+		return "", nil
+	}
+	return filepath.Abs(os.ExpandEnv(p))
+}
+
 // checkFinalPath checks if path exists and if it's a dir or not
 // and returns the correct final file path. It also
 // checks if the path already exists and prompts
@@ -171,14 +510,14 @@ func checkFinalPath(path, fileName string) (string, error) {
 }
 
 // installBinary saves the specified binary to the desired path
-// and makes it executable. It also checks if any other binary
-// has the same hash and exists if so.
+// and makes it executable, with the permissions it has in the archive
+// if any. The binary is hashed while it's written and its digest is
+// returned to be recorded in the config.
 
 // TODO check if other binary has the same hash and warn about it.
-// TODO if the file is zipped, tared, whatever then extract it.
-func installBinary(f *providers.File, path string, overwrite bool) error {
+func installBinary(f *providers.File, path string, overwrite bool) (*config.Digest, error) {
 	epath := os.ExpandEnv(path)
-	fmt.Println("epath:", epath)
+	zlog.Debug().Msgf("epath: %s", epath)
 
 	var extraFlags int = os.O_EXCL
 
@@ -187,24 +526,37 @@ func installBinary(f *providers.File, path string, overwrite bool) error {
 		err := os.Remove(epath)
 		log.Debugf("Overwrite flag set, removing file %s\n", epath)
 		if err != nil && !os.IsNotExist(err) {
-			return err
+			return nil, err
 		}
 	}
 
-	file, err := os.OpenFile(epath, os.O_RDWR|os.O_CREATE|extraFlags, 0o766)
+	perm := os.FileMode(0o766)
+	if f.Mode&0o111 != 0 {
+		perm = f.Mode.Perm() | 0o700
+	}
+
+	file, err := os.OpenFile(epath, os.O_RDWR|os.O_CREATE|extraFlags, perm)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	defer file.Close()
 
+	if c, ok := f.Data.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	if f.Hash == nil {
+		f.Hash = sha256.New()
+	}
+
 	zlog.Info().Msgf("Copying from %s@%s into %s", f.Name, f.Version, epath)
-	_, err = io.Copy(file, f.Data)
+	n, err := io.Copy(io.MultiWriter(file, f.Hash), f.Data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return &config.Digest{Algorithm: "sha256", Value: hex.EncodeToString(f.Hash.Sum(nil)), Size: n}, nil
 }
 
 func execShell(command string, args []string) error {
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dfang/bin/pkg/config"
+	"github.com/dfang/bin/pkg/providers"
+)
+
+func TestInstallBinaryDigest(t *testing.T) {
+	f := &providers.File{Data: strings.NewReader("#!/bin/sh\necho bin\n"), Name: "bin", Hash: sha256.New()}
+	digest, err := installBinary(f, filepath.Join(t.TempDir(), "bin"), false)
+	if err != nil {
+		t.Fatalf("Error installing binary: %v", err)
+	}
+
+	expected := &config.Digest{
+		Algorithm: "sha256",
+		Value:     "49193e3631a66b4da2723e317d947c417a3d2e02c935a088fec58ffb76ade2e8",
+		Size:      19,
+	}
+	if *digest != *expected {
+		t.Fatalf("Expected %+v, got %+v", expected, digest)
+	}
+}
@@ -0,0 +1,48 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dfang/bin/pkg/providers"
+	"golang.org/x/sys/unix"
+)
+
+func TestInstallBinaryMode(t *testing.T) {
+	// the umask clears the write bits of the group and others only
+	umask := unix.Umask(0o022)
+	t.Cleanup(func() { unix.Umask(umask) })
+
+	cases := []struct {
+		mode     os.FileMode
+		expected os.FileMode
+	}{
+		{0o700, 0o700},
+		{0o500, 0o700},
+		{0o755, 0o755},
+		// non executable entries, e.g. of zip archives created on windows
+		{0o644, 0o744},
+		{0, 0o744},
+	}
+
+	for _, c := range cases {
+		f := &providers.File{Data: strings.NewReader("#!/bin/sh\necho bin\n"), Name: "bin", Hash: sha256.New(), Mode: c.mode}
+		p := filepath.Join(t.TempDir(), "bin")
+		if _, err := installBinary(f, p, false); err != nil {
+			t.Fatalf("Error installing binary: %v", err)
+		}
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := fi.Mode().Perm(); perm != c.expected {
+			t.Fatalf("Expected %s installed from %s, got %s", c.expected, c.mode, perm)
+		}
+	}
+}
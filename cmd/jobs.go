@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/apex/log"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// defaultParallelism is the number of binaries processed at the same time.
+const defaultParallelism = 10
+
+// errSkipped is reported for the jobs that didn't
+// start because a previous job failed.
+var errSkipped = errors.New("skipped after a previous failure")
+
+// job checks, downloads or installs a single binary.
+type job struct {
+	name string
+	run  func() error
+}
+
+type jobResult struct {
+	name string
+	err  error
+}
+
+// runJobs runs jobs with at most parallelism of them at the same time and
+// returns their results in the order of jobs. Once a job fails with an error
+// stop returns true for, the jobs that haven't started yet are skipped.
+// A nil stop runs every job.
+func runJobs(jobs []job, parallelism int, stop func(error) bool) []jobResult {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	results := make([]jobResult, len(jobs))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	stopped := false
+
+	for i, j := range jobs {
+		results[i].name = j.name
+		sem <- struct{}{}
+
+		mu.Lock()
+		skip := stopped
+		mu.Unlock()
+		if skip {
+			<-sem
+			results[i].err = errSkipped
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, j job) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := j.run()
+			mu.Lock()
+			results[i].err = err
+			if err != nil && stop != nil && stop(err) {
+				stopped = true
+			}
+			mu.Unlock()
+		}(i, j)
+	}
+	wg.Wait()
+	return results
+}
+
+// stopOnError stops running jobs after the first failure.
+func stopOnError(error) bool {
+	return true
+}
+
+// reportResults prints the result of every job and returns an
+// error with the number of failed jobs if any of them failed.
+func reportResults(action string, results []jobResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+			log.Errorf("%s %s: %v", color.RedString("✗"), r.name, r.err)
+			continue
+		}
+		log.Infof("%s %s", color.GreenString("✓"), r.name)
+	}
+
+	if failed > 0 {
+		return wrapErrorWithCode(fmt.Errorf("%d of %d binaries failed to %s", failed, len(results), action), 1, "")
+	}
+	return nil
+}
+
+// addParallelismFlag adds the flag setting how many binaries are processed at the same time.
+func addParallelismFlag(cmd *cobra.Command, p *int) {
+	cmd.Flags().IntVarP(p, "parallelism", "P", defaultParallelism, "Number of binaries to process at the same time")
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunJobs(t *testing.T) {
+	var running, maxRunning int32
+	jobs := []job{}
+	for i := 0; i < 20; i++ {
+		i := i
+		jobs = append(jobs, job{name: fmt.Sprint(i), run: func() error {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			if i%5 == 0 {
+				return fmt.Errorf("job %d failed", i)
+			}
+			return nil
+		}})
+	}
+
+	results := runJobs(jobs, 4, nil)
+	if maxRunning > 4 {
+		t.Fatalf("Expected at most 4 jobs running at the same time, got %d", maxRunning)
+	}
+	for i, r := range results {
+		if r.name != fmt.Sprint(i) {
+			t.Fatalf("Expected results in the order of the jobs, got %s at %d", r.name, i)
+		}
+		if failed := r.err != nil; failed != (i%5 == 0) {
+			t.Fatalf("Unexpected result of job %d: %v", i, r.err)
+		}
+	}
+}
+
+func TestRunJobsStop(t *testing.T) {
+	jobs := []job{
+		{name: "a", run: func() error { return errors.New("a failed") }},
+		{name: "b", run: func() error { return nil }},
+	}
+
+	results := runJobs(jobs, 1, stopOnError)
+	if results[0].err == nil || !errors.Is(results[1].err, errSkipped) {
+		t.Fatalf("Expected b to be skipped after a failed, got %v", results)
+	}
+	if err := reportResults("install", results); err == nil {
+		t.Fatalf("Expected an error reporting failed jobs")
+	}
+}
+
+func TestIsInstallPath(t *testing.T) {
+	dir := t.TempDir()
+	cases := map[string]bool{
+		dir:                            true,
+		"./bin":                        true,
+		"~/bin":                        true,
+		"$HOME/bin":                    true,
+		"fzf":                          false,
+		"junegunn/fzf":                 false,
+		"github.com/junegunn/fzf":      false,
+		"docker://hashicorp/terraform": false,
+	}
+	for arg, expected := range cases {
+		if got := isInstallPath(arg); got != expected {
+			t.Errorf("isInstallPath(%q) = %v, expected %v", arg, got, expected)
+		}
+	}
+}
+
+func TestInstallArgs(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		args  []string
+		specs []string
+		path  string
+	}{
+		{[]string{"github.com/junegunn/fzf"}, []string{"github.com/junegunn/fzf"}, ""},
+		{[]string{"github.com/junegunn/fzf", "mytool"}, []string{"github.com/junegunn/fzf"}, "mytool"},
+		{[]string{"github.com/junegunn/fzf", "bin/mytool", "mytool"}, []string{"github.com/junegunn/fzf", "bin/mytool"}, "mytool"},
+		{[]string{"github.com/junegunn/fzf", dir}, []string{"github.com/junegunn/fzf"}, dir},
+		{[]string{"github.com/junegunn/fzf", "BurntSushi/ripgrep", "rg"}, []string{"github.com/junegunn/fzf", "BurntSushi/ripgrep", "rg"}, ""},
+		{[]string{"fzf", "rg", "./bin"}, []string{"fzf", "rg"}, "./bin"},
+	}
+	for _, c := range cases {
+		specs, path := installArgs(c.args)
+		if strings.Join(specs, " ") != strings.Join(c.specs, " ") || path != c.path {
+			t.Errorf("installArgs(%q) = %q, %q, expected %q, %q", c.args, specs, path, c.specs, c.path)
+		}
+	}
+}
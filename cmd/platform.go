@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"github.com/dfang/bin/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// addPlatformFlag adds the flag selecting the platform binaries are installed for.
+func addPlatformFlag(cmd *cobra.Command, p *string) {
+	cmd.Flags().StringVarP(p, "platform", "", "", "Install the binaries for another platform than this host, e.g. linux/arm64 or linux/arm/v7")
+}
+
+// binaryPlatform returns the platform to install b for: the one given
+// with --platform, or the one b was installed for. It's nil for the host.
+func binaryPlatform(flag *config.Platform, b *config.Binary) (*config.Platform, error) {
+	if flag != nil {
+		return flag, nil
+	}
+	return config.ParsePlatform(b.Platform)
+}
+
+// binaryAssetTemplate returns the template of the asset b was installed
+// from, it selects the asset again unless b is installed for another platform.
+func binaryAssetTemplate(platform *config.Platform, b *config.Binary) string {
+	recorded, err := config.ParsePlatform(b.Platform)
+	if err != nil || platformString(platform) != platformString(recorded) {
+		return ""
+	}
+	return b.AssetTemplate
+}
+
+// platformString returns the platform recorded in the config, empty for the host.
+func platformString(p *config.Platform) string {
+	if p == nil {
+		return ""
+	}
+	return p.String()
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/dfang/bin/pkg/config"
+)
+
+func TestBinaryPlatform(t *testing.T) {
+	arm64 := &config.Platform{OS: "linux", Arch: "arm64"}
+
+	cases := []struct {
+		flag     *config.Platform
+		recorded string
+		out      string
+		ok       bool
+	}{
+		{nil, "", "", true},
+		{nil, "linux/arm64", "linux/arm64", true},
+		{nil, "Linux/ARM/v7", "linux/arm/v7", true},
+		{nil, "linux/arm/7", "linux/arm/v7", true},
+		{arm64, "darwin/arm64", "linux/arm64", true},
+		{nil, "linux", "", false},
+		{nil, "beos/amd64", "", false},
+		{nil, "linux/sparc", "", false},
+		{nil, "linux/arm64/v8", "linux/arm64", true},
+		{nil, "linux/arm64/v7", "", false},
+	}
+
+	for _, c := range cases {
+		p, err := binaryPlatform(c.flag, &config.Binary{Platform: c.recorded})
+		if (err == nil) != c.ok {
+			t.Fatalf("Expected %q to be valid: %v, got %v", c.recorded, c.ok, err)
+		}
+		if out := platformString(p); out != c.out {
+			t.Fatalf("Expected %q for %q, got %q", c.out, c.recorded, out)
+		}
+	}
+}
+
+func TestBinaryAssetTemplate(t *testing.T) {
+	arm64 := &config.Platform{OS: "linux", Arch: "arm64"}
+	template := "tool-{version}-linux-arm64.tar.gz"
+
+	cases := []struct {
+		platform *config.Platform
+		recorded string
+		out      string
+	}{
+		{nil, "", template},
+		{arm64, "linux/arm64", template},
+		{arm64, "Linux/ARM64", template},
+		{arm64, "", ""},
+		{nil, "linux/arm64", ""},
+	}
+
+	for _, c := range cases {
+		b := &config.Binary{Platform: c.recorded, AssetTemplate: template}
+		if out := binaryAssetTemplate(c.platform, b); out != c.out {
+			t.Errorf("Expected %q for %s installed for %q, got %q", c.out, platformString(c.platform), c.recorded, out)
+		}
+	}
+}
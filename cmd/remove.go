@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/dfang/bin/pkg/appimage"
 	"github.com/dfang/bin/pkg/config"
 	"github.com/spf13/cobra"
 )
@@ -42,6 +43,14 @@ func newRemoveCmd() *removeCmd {
 						if err != nil {
 							return fmt.Errorf("Error removing path %s: %v", os.ExpandEnv(bp), err)
 						}
+						if err := removeCompanions(b.Companions); err != nil {
+							return fmt.Errorf("Error removing the completions and man pages of %s: %v", b.Path, err)
+						}
+						if b.Desktop != nil {
+							if err := appimage.Remove(b.Desktop); err != nil {
+								return fmt.Errorf("Error removing the desktop entry of %s: %v", b.Path, err)
+							}
+						}
 						continue
 					}
 				}
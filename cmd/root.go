@@ -8,6 +8,7 @@ import (
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/cli"
 	"github.com/dfang/bin/pkg/config"
+	"github.com/dfang/bin/pkg/progress"
 	"github.com/fatih/color"
 	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
@@ -19,7 +20,8 @@ func Execute(version string, exit func(int), args []string) {
 		color.NoColor = false
 	}
 
-	log.SetHandler(cli.Default)
+	// the log lines are printed above the download progress bars
+	log.SetHandler(cli.New(progress.Writer(os.Stderr)))
 
 	// fmt.Println()
 	// defer fmt.Println()
@@ -51,6 +53,7 @@ type rootCmd struct {
 	cmd   *cobra.Command
 	debug bool
 	trace bool
+	quiet bool
 	exit  func(int)
 }
 
@@ -65,6 +68,12 @@ func newRootCmd(version string, exit func(int)) *rootCmd {
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if root.quiet {
+				log.SetLevel(log.WarnLevel)
+				zerolog.SetGlobalLevel(zerolog.WarnLevel)
+				progress.Set(progress.New(progress.Quiet, os.Stderr))
+			}
+
 			if root.debug {
 				log.SetLevel(log.DebugLevel)
 				// log.Debugf("debug logs enabled, version: %s\n", version)
@@ -85,6 +94,7 @@ func newRootCmd(version string, exit func(int)) *rootCmd {
 
 	cmd.PersistentFlags().BoolVar(&root.debug, "debug", false, "Enable debug mode")
 	cmd.PersistentFlags().BoolVar(&root.trace, "trace", false, "Enable trace mode")
+	cmd.PersistentFlags().BoolVarP(&root.quiet, "quiet", "q", false, "Only print warnings and errors, without download progress")
 	cmd.AddCommand(
 		newInstallCmd().cmd,
 		newEnsureCmd().cmd,
@@ -92,6 +102,8 @@ func newRootCmd(version string, exit func(int)) *rootCmd {
 		newRemoveCmd().cmd,
 		newListCmd().cmd,
 		newPruneCmd().cmd,
+		newVerifyCmd().cmd,
+		newCacheCmd().cmd,
 	)
 
 	root.cmd = cmd
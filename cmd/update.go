@@ -3,8 +3,13 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path"
+	"sort"
+	"sync"
 
 	"github.com/apex/log"
+	"github.com/dfang/bin/pkg/appimage"
+	"github.com/dfang/bin/pkg/assets"
 	"github.com/dfang/bin/pkg/config"
 	"github.com/dfang/bin/pkg/prompt"
 	"github.com/dfang/bin/pkg/providers"
@@ -24,6 +29,10 @@ type updateOpts struct {
 	all             bool
 	skipPathCheck   bool
 	continueOnError bool
+	requireChecksum bool
+	skipChecksum    bool
+	platform        string
+	parallelism     int
 }
 
 type updateInfo struct{ version, url string }
@@ -42,12 +51,10 @@ func newUpdateCmd() *updateCmd {
 			// This allows to update binares from a repo that contains
 			// multiple tags for different binaries
 
-			// TODO update should check all binaries with a
-			// certain configured parallelism (default 10, can be changed with -p) and report
-			// which binarines could be potentially upgraded.
-			// It's very likely that we have to extend the provider
-			// interface to support this use-case
-
+			platform, err := config.ParsePlatform(root.opts.platform)
+			if err != nil {
+				return err
+			}
 			toUpdate := map[*updateInfo]*config.Binary{}
 			cfg := config.Get()
 			binsToProcess := map[string]*config.Binary{}
@@ -65,22 +72,46 @@ func newUpdateCmd() *updateCmd {
 				binsToProcess = cfg.Bins
 			}
 
-			updateFailures := map[*config.Binary]error{}
+			stop := stopOnError
+			if root.opts.continueOnError {
+				stop = nil
+			}
 
-			for _, b := range binsToProcess {
-				p, err := providers.New(b.URL, b.Provider)
-				if err != nil {
-					return err
-				}
-				if ui, err := getLatestVersion(b, p); err != nil {
-					if root.opts.continueOnError {
-						updateFailures[b] = fmt.Errorf("Error while getting latest version of %v: %v", b.Path, err)
-						continue
+			// check the latest versions concurrently, the binaries of a
+			// bundle are updated together so only one of them is checked
+			var mu sync.Mutex
+			bundles := bundleMembers(cfg.Bins)
+			bins := firstOfBundles(sortedBinaries(binsToProcess))
+			checks := make([]job, 0, len(bins))
+			for _, b := range bins {
+				b := b
+				checks = append(checks, job{name: b.Path, run: func() error {
+					p, err := providers.New(b.URL, b.Provider)
+					if err != nil {
+						return err
 					}
-					return err
-				} else if ui != nil {
-					toUpdate[ui] = b
+					ui, err := getLatestVersion(b, p)
+					if err != nil {
+						return err
+					}
+					if ui != nil {
+						mu.Lock()
+						toUpdate[ui] = b
+						mu.Unlock()
+					}
+					return nil
+				}})
+			}
+
+			updateFailures := map[*config.Binary]error{}
+			for i, r := range runJobs(checks, root.opts.parallelism, stop) {
+				if r.err == nil {
+					continue
+				}
+				if !root.opts.continueOnError {
+					return r.err
 				}
+				updateFailures[bins[i]] = fmt.Errorf("Error while getting latest version of %v: %v", bins[i].Path, r.err)
 			}
 
 			if len(toUpdate) == 0 && len(updateFailures) == 0 {
@@ -104,47 +135,29 @@ func newUpdateCmd() *updateCmd {
 				}
 			}
 
-			// TODO	:S code smell here, this pretty much does
-			// the same thing as install logic. Refactor to
-			// use the same code in both places
-			for ui, b := range toUpdate {
-				p, err := providers.New(ui.url, b.Provider)
-				if err != nil {
-					return err
-				}
+			for _, err := range updateFailures {
+				log.Warnf("%v", err)
+			}
 
-				pResult, err := p.Fetch(&providers.FetchOpts{All: root.opts.all, PackagePath: b.PackagePath, SkipPatchCheck: root.opts.skipPathCheck})
-				if err != nil {
-					if root.opts.continueOnError {
-						updateFailures[b] = fmt.Errorf("Error while fetching %v: %w", ui.url, err)
-						continue
+			updates := make([]job, 0, len(toUpdate))
+			for ui, b := range toUpdate {
+				ui, b := ui, b
+				updates = append(updates, job{name: fmt.Sprintf("%s %s", b.Path, ui.version), run: func() error {
+					members := bundles[b.Bundle]
+					if b.Bundle == "" {
+						members = []*config.Binary{b}
 					}
-					return err
-				}
-
-				if err = installBinary(pResult, b.Path, true); err != nil {
-					return fmt.Errorf("Error installing binary %w", err)
-				}
-
-				err = config.UpsertBinary(&config.Binary{
-					RemoteName:  pResult.Name,
-					Path:        b.Path,
-					Version:     pResult.Version,
-					Hash:        fmt.Sprintf("%x", pResult.Hash.Sum(nil)),
-					URL:         ui.url,
-					PackagePath: pResult.PackagePath,
-				})
-				if err != nil {
-					return err
-				}
-
-				log.Infof("Done updating %s to %s", os.ExpandEnv(b.Path), color.GreenString(ui.version))
+					return root.update(members, ui, platform)
+				}})
 			}
-			for _, err := range updateFailures {
+			sort.Slice(updates, func(i, j int) bool { return updates[i].name < updates[j].name })
+
+			err = reportResults("update", runJobs(updates, root.opts.parallelism, stop))
+			if err != nil && root.opts.continueOnError {
 				log.Warnf("%v", err)
+				return nil
 			}
-			// TODO: Return wrapping error with specific exit code if len(updateFailures) > 0?
-			return nil
+			return err
 		},
 	}
 
@@ -154,9 +167,165 @@ func newUpdateCmd() *updateCmd {
 	root.cmd.Flags().BoolVarP(&root.opts.all, "all", "a", false, "Show all possible download options (skip scoring & filtering)")
 	root.cmd.Flags().BoolVarP(&root.opts.skipPathCheck, "skip-path-check", "p", false, "Skips path checking when looking into packages")
 	root.cmd.Flags().BoolVarP(&root.opts.continueOnError, "continue-on-error", "c", false, "Continues to update next package if an error is encountered")
+	root.cmd.Flags().BoolVarP(&root.opts.requireChecksum, "require-checksum", "", false, "Fail if the release doesn't publish a checksum for the downloaded asset")
+	root.cmd.Flags().BoolVarP(&root.opts.skipChecksum, "skip-checksum", "", false, "Skip the checksum validation of the downloaded asset")
+	root.cmd.MarkFlagsMutuallyExclusive("require-checksum", "skip-checksum")
+	addPlatformFlag(root.cmd, &root.opts.platform)
+	addParallelismFlag(root.cmd, &root.opts.parallelism)
 	return root
 }
 
+// update installs the new version of bins, which are either a
+// single binary or the binaries of a bundle.
+// TODO	:S code smell here, this pretty much does
+// the same thing as install logic. Refactor to
+// use the same code in both places
+func (root *updateCmd) update(bins []*config.Binary, ui *updateInfo, flag *config.Platform) error {
+	b := bins[0]
+	p, err := providers.New(ui.url, b.Provider)
+	if err != nil {
+		return err
+	}
+	platform, err := binaryPlatform(flag, b)
+	if err != nil {
+		return err
+	}
+
+	opts := &providers.FetchOpts{
+		All:             root.opts.all,
+		PackagePath:     b.PackagePath,
+		SkipPatchCheck:  root.opts.skipPathCheck,
+		RequireChecksum: root.opts.requireChecksum,
+		SkipChecksum:    root.opts.skipChecksum,
+		Platform:        platform,
+		Rules:           config.GetAssetRules(b.AssetRules),
+		AssetTemplate:   binaryAssetTemplate(platform, b),
+		Verification:    b.Verification,
+	}
+	if len(bins) > 1 {
+		// the binaries of a bundle are extracted from the same asset
+		opts.PackagePath = ""
+		for _, m := range bins {
+			opts.Pick = append(opts.Pick, bundlePick(m, root.opts.skipPathCheck))
+		}
+	}
+	for _, m := range bins {
+		if len(m.Companions) > 0 {
+			opts.Companions = true
+		}
+	}
+
+	pResult, err := p.Fetch(opts)
+	if err != nil {
+		return fmt.Errorf("Error while fetching %v: %w", ui.url, err)
+	}
+
+	files := append([]*providers.File{pResult}, pResult.Others...)
+	defer closeFiles(files)
+
+	// the completions and man pages of the new version might have moved
+	for _, m := range bins {
+		if err := removeCompanions(m.Companions); err != nil {
+			log.Warnf("Error removing the completions and man pages of %s: %v", m.Path, err)
+		}
+	}
+
+	for _, m := range bins {
+		f := pResult
+		if len(bins) > 1 {
+			if f = bundleFile(files, bundlePick(m, root.opts.skipPathCheck)); f == nil {
+				return fmt.Errorf("%s not found in the asset of %s", m.PackagePath, ui.version)
+			}
+		}
+
+		digest, err := installBinary(f, m.Path, true)
+		if err != nil {
+			return fmt.Errorf("Error installing binary %w", err)
+		}
+
+		// the icon of the new version might have another format
+		var desktop *config.Desktop
+		if m.Desktop != nil {
+			if err := appimage.Remove(m.Desktop); err != nil {
+				log.Warnf("Error removing the desktop entry of %s: %v", m.Path, err)
+			}
+			desktop = installDesktop(m.Path)
+		}
+		companions := installCompanions(f)
+
+		// the asset may have been selected by the scoring alone
+		template := f.AssetTemplate
+		if template == "" {
+			template = binaryAssetTemplate(platform, m)
+		}
+
+		err = config.UpsertBinary(&config.Binary{
+			RemoteName:    f.Name,
+			Path:          m.Path,
+			Version:       f.Version,
+			Hash:          digest.Value,
+			URL:           ui.url,
+			Provider:      m.Provider,
+			PackagePath:   f.PackagePath,
+			Checksum:      f.Checksum,
+			Verification:  m.Verification,
+			Provenance:    f.Provenance,
+			AssetDigest:   f.AssetDigest,
+			BinaryDigest:  digest,
+			Desktop:       desktop,
+			Bundle:        m.Bundle,
+			Companions:    companions,
+			AssetRules:    m.AssetRules,
+			AssetTemplate: template,
+			Platform:      platformString(platform),
+		})
+		if err != nil {
+			return err
+		}
+
+		log.Infof("Done updating %s to %s", os.ExpandEnv(m.Path), color.GreenString(ui.version))
+	}
+	return nil
+}
+
+// bundleMembers returns the binaries of every bundle of bins, sorted by path.
+func bundleMembers(bins map[string]*config.Binary) map[string][]*config.Binary {
+	bundles := map[string][]*config.Binary{}
+	for _, b := range sortedBinaries(bins) {
+		if b.Bundle != "" {
+			bundles[b.Bundle] = append(bundles[b.Bundle], b)
+		}
+	}
+	return bundles
+}
+
+// firstOfBundles keeps a single binary of every bundle in bins.
+func firstOfBundles(bins []*config.Binary) []*config.Binary {
+	res := make([]*config.Binary, 0, len(bins))
+	seen := map[string]bool{}
+	for _, b := range bins {
+		if b.Bundle != "" {
+			if seen[b.Bundle] {
+				continue
+			}
+			seen[b.Bundle] = true
+		}
+		res = append(res, b)
+	}
+	return res
+}
+
+// sortedBinaries returns the binaries of bins sorted by path, as a
+// slice so it doesn't share the config map with concurrent updates.
+func sortedBinaries(bins map[string]*config.Binary) []*config.Binary {
+	sorted := make([]*config.Binary, 0, len(bins))
+	for _, b := range bins {
+		sorted = append(sorted, b)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+	return sorted
+}
+
 func getLatestVersion(b *config.Binary, p providers.Provider) (*updateInfo, error) {
 	log.Debugf("Checking updates for %s", b.Path)
 	v, u, err := p.GetLatestVersion()
@@ -178,3 +347,24 @@ func getLatestVersion(b *config.Binary, p providers.Provider) (*updateInfo, erro
 	log.Infof("%s %s -> %s (%s)", b.Path, color.YellowString(b.Version), color.GreenString(v), u)
 	return &updateInfo{v, u}, nil
 }
+
+// bundlePick returns the glob picking the binary of the bundle member m in
+// the asset of any release: its package path with the version replaced, as
+// the top directory of archives is often versioned, or its base name when
+// the path isn't checked.
+func bundlePick(m *config.Binary, skipPathCheck bool) string {
+	if skipPathCheck {
+		return path.Base(m.PackagePath)
+	}
+	return assets.ReplaceVersion(m.PackagePath, m.Version, "*")
+}
+
+// bundleFile returns the file of files picked by pick, nil if there's none.
+func bundleFile(files []*providers.File, pick string) *providers.File {
+	for _, f := range files {
+		if assets.MatchPick(pick, f.PackagePath) {
+			return f
+		}
+	}
+	return nil
+}
@@ -70,3 +70,62 @@ func TestGetLatestVersion(t *testing.T) {
 		}
 	}
 }
+
+func TestBundles(t *testing.T) {
+	bins := map[string]*config.Binary{
+		"/bin/jq":          {Path: "/bin/jq"},
+		"/bin/kubebuilder": {Path: "/bin/kubebuilder", Bundle: "/bin/kubebuilder"},
+		"/bin/etcd":        {Path: "/bin/etcd", Bundle: "/bin/kubebuilder"},
+		"/bin/protoc":      {Path: "/bin/protoc", Bundle: "/bin/protoc"},
+	}
+
+	bundles := bundleMembers(bins)
+	if len(bundles) != 2 {
+		t.Fatalf("Expected 2 bundles, got %d", len(bundles))
+	}
+	if members := bundles["/bin/kubebuilder"]; len(members) != 2 || members[0].Path != "/bin/etcd" || members[1].Path != "/bin/kubebuilder" {
+		t.Fatalf("Unexpected members of the kubebuilder bundle: %+v", members)
+	}
+
+	paths := []string{}
+	for _, b := range firstOfBundles(sortedBinaries(bins)) {
+		paths = append(paths, b.Path)
+	}
+	if expected := []string{"/bin/etcd", "/bin/jq", "/bin/protoc"}; !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("Expected %v, got %v", expected, paths)
+	}
+}
+
+func TestBundlePick(t *testing.T) {
+	etcd := &config.Binary{Path: "/bin/etcd", Version: "v2.3.1", PackagePath: "kubebuilder_2.3.1_linux_amd64/bin/etcd"}
+	kubebuilder := &config.Binary{Path: "/bin/kubebuilder", Version: "v2.3.1", PackagePath: "kubebuilder_2.3.1_linux_amd64/bin/kubebuilder"}
+
+	cases := []struct {
+		files         []string
+		skipPathCheck bool
+		found         bool
+	}{
+		{[]string{"kubebuilder_2.3.2_linux_amd64/bin/kubebuilder", "kubebuilder_2.3.2_linux_amd64/bin/etcd"}, false, true},
+		{[]string{"kubebuilder/bin/kubebuilder", "kubebuilder/bin/etcd"}, false, false},
+		{[]string{"kubebuilder/bin/kubebuilder", "kubebuilder/bin/etcd"}, true, true},
+	}
+
+	for _, c := range cases {
+		files := []*providers.File{}
+		for _, f := range c.files {
+			files = append(files, &providers.File{PackagePath: f})
+		}
+		for i, m := range []*config.Binary{kubebuilder, etcd} {
+			f := bundleFile(files, bundlePick(m, c.skipPathCheck))
+			if !c.found {
+				if f != nil {
+					t.Errorf("Expected %s not to be found in %v, got %s", m.PackagePath, c.files, f.PackagePath)
+				}
+				continue
+			}
+			if f != files[i] {
+				t.Errorf("Expected %s to be found in %v as %s, got %v", m.PackagePath, c.files, c.files[i], f)
+			}
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+
+	"github.com/WeiZhang555/tabwriter"
+	"github.com/dfang/bin/pkg/assets"
+	"github.com/dfang/bin/pkg/config"
+	"github.com/dfang/bin/pkg/providers"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+const (
+	verifyOK            = "ok"
+	verifyMissing       = "missing"
+	verifyModified      = "modified"
+	verifyReplaced      = "replaced"
+	verifyNotExecutable = "not executable"
+	verifyUnknown       = "unknown"
+
+	upstreamMatch    = "match"
+	upstreamMismatch = "mismatch"
+	upstreamVersion  = "version changed"
+	upstreamError    = "error"
+)
+
+type verifyCmd struct {
+	cmd  *cobra.Command
+	opts verifyOpts
+}
+
+type verifyOpts struct {
+	json     bool
+	upstream bool
+}
+
+// verifyResult is the integrity report of a managed binary.
+type verifyResult struct {
+	Path     string `json:"path"`
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Status   string `json:"status"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Upstream string `json:"upstream,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// failed tells if the result should make the command fail.
+func (r *verifyResult) failed() bool {
+	return (r.Status != verifyOK && r.Status != verifyUnknown) ||
+		r.Upstream == upstreamMismatch || r.Upstream == upstreamError
+}
+
+func newVerifyCmd() *verifyCmd {
+	root := &verifyCmd{}
+	// nolint: dupl
+	cmd := &cobra.Command{
+		Use:           "verify [<name> | <paths...>]",
+		Short:         "Verifies the integrity of the binaries managed by bin",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.Get()
+
+			binPaths := []string{}
+			if len(args) > 0 {
+				for _, a := range args {
+					bp, err := getBinPath(a)
+					if err != nil {
+						return err
+					}
+					if _, ok := cfg.Bins[bp]; !ok {
+						return fmt.Errorf("binary path %s is not managed by bin", bp)
+					}
+					binPaths = append(binPaths, bp)
+				}
+			} else {
+				for k := range cfg.Bins {
+					binPaths = append(binPaths, k)
+				}
+			}
+			sort.Strings(binPaths)
+
+			results := []*verifyResult{}
+			failures := 0
+			for _, k := range binPaths {
+				r := verifyBinary(cfg.Bins[k])
+				if root.opts.upstream && r.Status != verifyMissing {
+					verifyUpstream(cfg.Bins[k], r)
+				}
+				if r.failed() {
+					failures++
+				}
+				results = append(results, r)
+			}
+
+			if root.opts.json {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(results); err != nil {
+					return err
+				}
+			} else {
+				printVerifyResults(results, root.opts.upstream)
+			}
+
+			if failures > 0 {
+				return wrapErrorWithCode(fmt.Errorf("%d of %d binaries failed verification", failures, len(results)), 1, "")
+			}
+			return nil
+		},
+	}
+
+	root.cmd = cmd
+	root.cmd.Flags().BoolVarP(&root.opts.json, "json", "", false, "Print the report as JSON")
+	root.cmd.Flags().BoolVarP(&root.opts.upstream, "upstream", "", false, "Download the installed version again and compare it with the recorded digests")
+	return root
+}
+
+// expectedDigest returns the digest recorded for the installed
+// binary, nil if it was installed by an older version of bin.
+func expectedDigest(b *config.Binary) *config.Digest {
+	if b.BinaryDigest != nil {
+		return b.BinaryDigest
+	}
+	if b.Hash != "" {
+		return &config.Digest{Algorithm: "sha256", Value: b.Hash, Size: -1}
+	}
+	return nil
+}
+
+// verifyBinary re-hashes the installed binary and compares it
+// with the digest recorded when it was installed.
+func verifyBinary(b *config.Binary) *verifyResult {
+	p := os.ExpandEnv(b.Path)
+	r := &verifyResult{Path: p, Name: b.RemoteName, Version: b.Version}
+
+	fi, err := os.Lstat(p)
+	if os.IsNotExist(err) {
+		r.Status = verifyMissing
+		return r
+	} else if err != nil {
+		r.Status, r.Message = verifyMissing, err.Error()
+		return r
+	}
+
+	// bin always writes a regular file, anything else means
+	// the binary has been swapped by another tool or by hand
+	if !fi.Mode().IsRegular() {
+		r.Status, r.Message = verifyReplaced, fmt.Sprintf("%s is a %s", p, fi.Mode().Type())
+		return r
+	}
+
+	expected := expectedDigest(b)
+	if expected == nil {
+		r.Status, r.Message = verifyUnknown, "no digest recorded, run bin update or bin ensure to record it"
+		return r
+	}
+
+	actual, err := assets.FileDigest(p, expected.Algorithm)
+	if err != nil {
+		r.Status, r.Message = verifyUnknown, err.Error()
+		return r
+	}
+	r.Expected, r.Actual = expected.String(), actual.String()
+
+	switch {
+	case actual.Value == expected.Value:
+		r.Status = verifyOK
+	case expected.Size >= 0 && actual.Size != expected.Size:
+		r.Status, r.Message = verifyReplaced, fmt.Sprintf("size changed from %d to %d bytes", expected.Size, actual.Size)
+	default:
+		r.Status = verifyModified
+	}
+
+	if r.Status == verifyOK && runtime.GOOS != "windows" && fi.Mode().Perm()&0o111 == 0 {
+		r.Status = verifyNotExecutable
+	}
+	return r
+}
+
+// verifyUpstream downloads the installed version again and compares
+// it with the digests recorded when the binary was installed.
+func verifyUpstream(b *config.Binary, r *verifyResult) {
+	p, err := providers.New(b.URL, b.Provider)
+	if err != nil {
+		r.Upstream, r.Message = upstreamError, err.Error()
+		return
+	}
+
+	platform, err := config.ParsePlatform(b.Platform)
+	if err != nil {
+		r.Upstream, r.Message = upstreamError, err.Error()
+		return
+	}
+
+	pResult, err := p.Fetch(&providers.FetchOpts{PackagePath: b.PackagePath, Platform: platform, Rules: config.GetAssetRules(b.AssetRules), AssetTemplate: b.AssetTemplate, Verification: b.Verification, Version: b.Version})
+	if err != nil {
+		r.Upstream, r.Message = upstreamError, err.Error()
+		return
+	}
+
+	if c, ok := pResult.Data.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	if pResult.Version != b.Version {
+		r.Upstream, r.Message = upstreamVersion, fmt.Sprintf("%s now resolves to %s", b.URL, pResult.Version)
+		return
+	}
+
+	if b.AssetDigest != nil && pResult.AssetDigest != nil && b.AssetDigest.Value != pResult.AssetDigest.Value {
+		r.Upstream, r.Message = upstreamMismatch, fmt.Sprintf("upstream asset is %s, %s was installed", pResult.AssetDigest, b.AssetDigest)
+		return
+	}
+
+	expected := expectedDigest(b)
+	if expected == nil {
+		expected = &config.Digest{Algorithm: "sha256"}
+	}
+	actual, err := assets.Digest(pResult.Data, expected.Algorithm)
+	if err != nil {
+		r.Upstream, r.Message = upstreamError, err.Error()
+		return
+	}
+	installed := r.Actual
+	if installed == "" {
+		// no digest was recorded, compare with the file as it is
+		d, err := assets.FileDigest(r.Path, actual.Algorithm)
+		if err != nil {
+			r.Upstream, r.Message = upstreamError, err.Error()
+			return
+		}
+		installed = d.String()
+	}
+	if installed != actual.String() {
+		r.Upstream, r.Message = upstreamMismatch, fmt.Sprintf("upstream binary is %s, installed is %s", actual, installed)
+		return
+	}
+	r.Upstream = upstreamMatch
+}
+
+func printVerifyResults(results []*verifyResult, upstream bool) {
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 8, 8, 3, '\t', 0)
+
+	defer w.Flush()
+
+	if upstream {
+		fmt.Fprintf(w, "\n %s\t%s\t%s\t%s\t%s", "Path", "Version", "Status", "Upstream", "Details")
+	} else {
+		fmt.Fprintf(w, "\n %s\t%s\t%s\t%s", "Path", "Version", "Status", "Details")
+	}
+	for _, r := range results {
+		status := color.GreenString(r.Status)
+		if r.Status == verifyUnknown {
+			status = color.YellowString(r.Status)
+		} else if r.Status != verifyOK {
+			status = color.RedString(r.Status)
+		}
+
+		details := r.Message
+		if details == "" && r.Expected != "" && r.Status != verifyOK {
+			details = fmt.Sprintf("expected %s, got %s", r.Expected, r.Actual)
+		}
+
+		if upstream {
+			fmt.Fprintf(w, "\n %s\t%s\t%s\t%s\t%s", r.Path, r.Version, status, r.Upstream, details)
+		} else {
+			fmt.Fprintf(w, "\n %s\t%s\t%s\t%s", r.Path, r.Version, status, details)
+		}
+	}
+	fmt.Fprintf(w, "\n\n")
+}
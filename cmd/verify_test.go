@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dfang/bin/pkg/config"
+)
+
+func TestVerifyBinary(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("#!/bin/sh\necho bin\n")
+	digest := &config.Digest{Algorithm: "sha256", Value: "49193e3631a66b4da2723e317d947c417a3d2e02c935a088fec58ffb76ade2e8", Size: 19}
+
+	write := func(name string, data []byte, perm os.FileMode) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, data, perm); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(write("target", content, 0o755), link); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		in     *config.Binary
+		status string
+	}{
+		{"unchanged", &config.Binary{Path: write("ok", content, 0o755), BinaryDigest: digest}, verifyOK},
+		{"legacy hash", &config.Binary{Path: write("legacy", content, 0o755), Hash: digest.Value}, verifyOK},
+		{"no digest", &config.Binary{Path: write("unknown", content, 0o755)}, verifyUnknown},
+		{"missing", &config.Binary{Path: filepath.Join(dir, "missing"), BinaryDigest: digest}, verifyMissing},
+		{"modified", &config.Binary{Path: write("modified", []byte("#!/bin/sh\necho evl\n"), 0o755), BinaryDigest: digest}, verifyModified},
+		{"replaced", &config.Binary{Path: write("replaced", []byte("#!/bin/sh\necho evil\n"), 0o755), BinaryDigest: digest}, verifyReplaced},
+		{"symlink", &config.Binary{Path: link, BinaryDigest: digest}, verifyReplaced},
+		{"not executable", &config.Binary{Path: write("noexec", content, 0o644), BinaryDigest: digest}, verifyNotExecutable},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if r := verifyBinary(c.in); r.Status != c.status {
+				t.Fatalf("Expected status %q, got %q (%s)", c.status, r.Status, r.Message)
+			}
+		})
+	}
+}
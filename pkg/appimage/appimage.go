@@ -0,0 +1,353 @@
+// Package appimage integrates AppImages with the desktop: the .desktop file
+// and the icon embedded in the squashfs payload of the AppImage are installed
+// under the XDG data directory, with the Exec path rewritten to the installed
+// AppImage, so it shows up in the application menus like a packaged app.
+package appimage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dfang/bin/pkg/config"
+	"github.com/diskfs/go-diskfs/filesystem/squashfs"
+	zlog "github.com/rs/zerolog/log"
+)
+
+// ErrNotAppImage is returned when integrating a file
+// which isn't a (type 2) AppImage.
+var ErrNotAppImage = errors.New("not an AppImage")
+
+var (
+	elfMagic = []byte("\x7fELF")
+	// appImageMagic is stored in the padding of the ELF identification
+	// of the runtime of type 2 AppImages
+	appImageMagic  = []byte("AI\x02")
+	squashfsMagic  = []byte("hsqs")
+	iconExtensions = []string{".svg", ".png", ".xpm"}
+	// iconDirs are searched for the icon when it isn't a regular
+	// file at the root of the AppImage, .DirIcon is usually a symlink
+	iconDirs = []string{
+		"usr/share/icons/hicolor/scalable/apps",
+		"usr/share/icons/hicolor/512x512/apps",
+		"usr/share/icons/hicolor/256x256/apps",
+		"usr/share/icons/hicolor/128x128/apps",
+		"usr/share/icons/hicolor/64x64/apps",
+		"usr/share/icons/hicolor/48x48/apps",
+		"usr/share/pixmaps",
+	}
+)
+
+// IsAppImage checks if the file at p is a type 2 AppImage.
+func IsAppImage(p string) bool {
+	f, err := os.Open(p)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	ident := make([]byte, 11)
+	if _, err := io.ReadFull(f, ident); err != nil {
+		return false
+	}
+	return bytes.HasPrefix(ident, elfMagic) && bytes.Equal(ident[8:], appImageMagic)
+}
+
+// payloadOffset returns the offset of the squashfs payload, which
+// is appended to the runtime right after its section headers.
+func payloadOffset(r io.ReaderAt) (int64, error) {
+	ident := make([]byte, 64)
+	if _, err := r.ReadAt(ident, 0); err != nil {
+		return 0, err
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if ident[5] == 2 {
+		order = binary.BigEndian
+	}
+
+	var offset int64
+	switch ident[4] {
+	case 1: // ELFCLASS32
+		offset = int64(order.Uint32(ident[0x20:])) + int64(order.Uint16(ident[0x2e:]))*int64(order.Uint16(ident[0x30:]))
+	case 2: // ELFCLASS64
+		offset = int64(order.Uint64(ident[0x28:])) + int64(order.Uint16(ident[0x3a:]))*int64(order.Uint16(ident[0x3c:]))
+	default:
+		return 0, fmt.Errorf("unknown ELF class %d", ident[4])
+	}
+
+	magic := make([]byte, len(squashfsMagic))
+	if _, err := r.ReadAt(magic, offset); err != nil || !bytes.Equal(magic, squashfsMagic) {
+		return 0, fmt.Errorf("no squashfs payload found at offset %d", offset)
+	}
+	return offset, nil
+}
+
+// payloadFile is the squashfs payload of an AppImage, the squashfs
+// reader doesn't account for its offset so it's read through a section.
+type payloadFile struct {
+	*io.SectionReader
+}
+
+func (payloadFile) WriteAt([]byte, int64) (int, error) {
+	return 0, errors.New("read only")
+}
+
+// payload opens the squashfs payload of the AppImage f.
+func payload(f *os.File) (*squashfs.FileSystem, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset, err := payloadOffset(f)
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size() - offset
+	return squashfs.Read(payloadFile{io.NewSectionReader(f, offset, size)}, size, 0, 0)
+}
+
+// readFile reads the regular file p of fs, symlinks and other entries
+// are ignored since the squashfs reader doesn't resolve them.
+func readFile(fs *squashfs.FileSystem, p string) ([]byte, error) {
+	entries, err := fs.ReadDir(path.Dir(p))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.Name() != path.Base(p) {
+			continue
+		}
+		if !e.Mode().IsRegular() {
+			return nil, fmt.Errorf("%s is not a regular file", p)
+		}
+		f, err := fs.OpenFile(p, os.O_RDONLY)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return io.ReadAll(f)
+	}
+	return nil, os.ErrNotExist
+}
+
+// desktopEntry returns the name and the content of the .desktop file at the root of fs.
+func desktopEntry(fs *squashfs.FileSystem) (string, []byte, error) {
+	entries, err := fs.ReadDir("/")
+	if err != nil {
+		return "", nil, err
+	}
+	for _, e := range entries {
+		if e.Mode().IsRegular() && strings.HasSuffix(e.Name(), ".desktop") {
+			bs, err := readFile(fs, "/"+e.Name())
+			return e.Name(), bs, err
+		}
+	}
+	return "", nil, fmt.Errorf("no desktop entry found in the AppImage")
+}
+
+// icon returns the extension and the content of the icon named name,
+// .DirIcon is used when it can't be found.
+func icon(fs *squashfs.FileSystem, name string) (string, []byte) {
+	candidates := []string{}
+	// absolute icon paths point outside of the AppImage
+	if name != "" && !strings.Contains(name, "/") {
+		for _, dir := range append([]string{""}, iconDirs...) {
+			for _, ext := range iconExtensions {
+				candidates = append(candidates, path.Join("/", dir, name+ext))
+			}
+		}
+	}
+
+	for _, c := range candidates {
+		if bs, err := readFile(fs, c); err == nil {
+			return path.Ext(c), bs
+		}
+	}
+
+	if bs, err := readFile(fs, "/.DirIcon"); err == nil {
+		if bytes.HasPrefix(bs, []byte("\x89PNG")) {
+			return ".png", bs
+		} else if bytes.Contains(bs[:min(len(bs), 512)], []byte("<svg")) {
+			return ".svg", bs
+		}
+	}
+	return "", nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Integrate installs the desktop entry and the icon of the AppImage
+// installed at p, the files are named after the installed binary.
+func Integrate(p string) (*config.Desktop, error) {
+	if !IsAppImage(p) {
+		return nil, ErrNotAppImage
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fs, err := payload(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the AppImage payload of %s: %w", p, err)
+	}
+
+	entryName, entry, err := desktopEntry(fs)
+	if err != nil {
+		return nil, err
+	}
+	zlog.Debug().Msgf("Found desktop entry %s in %s", entryName, p)
+
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return nil, err
+	}
+	name := "bin-" + filepath.Base(p)
+	d := &config.Desktop{Entry: filepath.Join(dataDir, "applications", name+".desktop")}
+
+	if ext, bs := icon(fs, iconName(entry)); bs != nil {
+		d.Icon = filepath.Join(dataDir, "icons", "hicolor", iconSize(ext, bs), "apps", name+ext)
+		if err := writeFile(d.Icon, bs); err != nil {
+			return nil, err
+		}
+	} else {
+		zlog.Warn().Msgf("No icon found in %s", p)
+	}
+
+	if err := writeFile(d.Entry, rewrite(entry, p, d.Icon)); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Remove removes the desktop entry and the icon of d.
+func Remove(d *config.Desktop) error {
+	for _, p := range []string{d.Entry, d.Icon} {
+		if p == "" {
+			continue
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFile(p string, bs []byte) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, bs, 0o644)
+}
+
+// iconSize returns the hicolor theme directory of the icon, the size
+// of png icons is read from their header.
+func iconSize(ext string, bs []byte) string {
+	switch ext {
+	case ".svg":
+		return "scalable"
+	case ".png":
+		if c, err := png.DecodeConfig(bytes.NewReader(bs)); err == nil && c.Width == c.Height {
+			return fmt.Sprintf("%dx%d", c.Width, c.Height)
+		}
+	}
+	return "256x256"
+}
+
+// iconName returns the Icon key of the main group of the desktop entry.
+func iconName(entry []byte) string {
+	name := ""
+	eachKey(entry, func(group, key, value string) {
+		if group == "Desktop Entry" && key == "Icon" && name == "" {
+			name = value
+		}
+	})
+	return name
+}
+
+// eachKey calls fn with every key of the desktop entry.
+func eachKey(entry []byte, fn func(group, key, value string)) {
+	group := ""
+	s := bufio.NewScanner(bytes.NewReader(entry))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			group = line[1 : len(line)-1]
+			continue
+		}
+		if k, v, ok := strings.Cut(line, "="); ok {
+			fn(group, strings.TrimSpace(k), strings.TrimSpace(v))
+		}
+	}
+}
+
+// rewrite points the Exec and TryExec keys of every group of the desktop
+// entry to the AppImage at p, and the Icon keys to the installed icon.
+func rewrite(entry []byte, p, icon string) []byte {
+	out := new(bytes.Buffer)
+	s := bufio.NewScanner(bytes.NewReader(entry))
+	for s.Scan() {
+		line := s.Text()
+		k, v, ok := strings.Cut(line, "=")
+		switch key := strings.TrimSpace(k); {
+		case !ok || strings.HasPrefix(strings.TrimSpace(line), "#"):
+		case key == "Exec":
+			line = "Exec=" + quoteExec(p)
+			// keep the field codes and the arguments of the command
+			if _, args, ok := cutCommand(strings.TrimSpace(v)); ok {
+				line += " " + args
+			}
+		case key == "TryExec":
+			line = "TryExec=" + p
+		case key == "Icon" && icon != "":
+			line = "Icon=" + icon
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.Bytes()
+}
+
+// cutCommand splits the value of an Exec key into its (possibly quoted)
+// command and its arguments.
+func cutCommand(v string) (string, string, bool) {
+	if strings.HasPrefix(v, `"`) {
+		for i := 1; i < len(v); i++ {
+			if v[i] == '\\' {
+				i++
+			} else if v[i] == '"' {
+				cmd, args := v[:i+1], strings.TrimSpace(v[i+1:])
+				return cmd, args, args != ""
+			}
+		}
+		return v, "", false
+	}
+	cmd, args, ok := strings.Cut(v, " ")
+	args = strings.TrimSpace(args)
+	return cmd, args, ok && args != ""
+}
+
+// quoteExec quotes the path p as the command of an Exec key
+// if it contains reserved characters.
+func quoteExec(p string) string {
+	if !strings.ContainsAny(p, " \t\n\"'\\><~|&;$*?#()`") {
+		return p
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", `$`, `\$`)
+	return `"` + r.Replace(p) + `"`
+}
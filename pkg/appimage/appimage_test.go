@@ -0,0 +1,179 @@
+package appimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/diskfs/go-diskfs/filesystem/squashfs"
+)
+
+const testEntry = `[Desktop Entry]
+Type=Application
+Name=App
+# Exec=app in a comment
+Exec=app %U
+TryExec=app
+Icon=app
+Actions=new-window;
+
+[Desktop Action new-window]
+Name=New Window
+Exec=app --new-window
+`
+
+// squashfsImage builds a squashfs image with files.
+func squashfsImage(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "payload.squashfs")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	fs, err := squashfs.Create(f, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if err := fs.Mkdir(filepath.Dir(name)); err != nil {
+			t.Fatal(err)
+		}
+		w, err := fs.OpenFile(name, os.O_CREATE|os.O_RDWR)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fs.Finalize(squashfs.FinalizeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bs
+}
+
+// appImage returns a type 2 AppImage with the squashfs payload of files,
+// the runtime is only an ELF header with a single section header.
+func appImage(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	runtime := make([]byte, 128)
+	copy(runtime, "\x7fELF\x02\x01\x01")
+	copy(runtime[8:], appImageMagic)
+	binary.LittleEndian.PutUint64(runtime[0x28:], 64)
+	binary.LittleEndian.PutUint16(runtime[0x3a:], 64)
+	binary.LittleEndian.PutUint16(runtime[0x3c:], 1)
+	return append(runtime, squashfsImage(t, files)...)
+}
+
+func pngIcon(t *testing.T, size int) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, size, size))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestIntegrate(t *testing.T) {
+	dataDir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dataDir)
+
+	icon := pngIcon(t, 32)
+	p := filepath.Join(t.TempDir(), "app.AppImage")
+	data := appImage(t, map[string][]byte{
+		"/app.desktop":  []byte(testEntry),
+		"/app.png":      icon,
+		"/usr/bin/app":  []byte("\x7fELF app"),
+		"/usr/lib/x.so": []byte("\x7fELF lib"),
+	})
+	if err := os.WriteFile(p, data, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsAppImage(p) {
+		t.Fatalf("Expected %s to be an AppImage", p)
+	}
+
+	d, err := Integrate(p)
+	if err != nil {
+		t.Fatalf("Error integrating %s: %v", p, err)
+	}
+
+	expectedEntry := filepath.Join(dataDir, "applications", "bin-app.AppImage.desktop")
+	expectedIcon := filepath.Join(dataDir, "icons", "hicolor", "32x32", "apps", "bin-app.AppImage.png")
+	if d.Entry != expectedEntry || d.Icon != expectedIcon {
+		t.Fatalf("Expected %s and %s, got %+v", expectedEntry, expectedIcon, d)
+	}
+
+	bs, err := os.ReadFile(d.Icon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bs, icon) {
+		t.Fatalf("Expected the icon of the AppImage to be installed")
+	}
+
+	bs, err = os.ReadFile(d.Entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"Exec=" + p + " %U", "TryExec=" + p, "Icon=" + expectedIcon, "Exec=" + p + " --new-window", "# Exec=app in a comment"} {
+		if !strings.Contains(string(bs), line+"\n") {
+			t.Fatalf("Expected %q in the desktop entry, got:\n%s", line, bs)
+		}
+	}
+
+	if err := Remove(d); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{d.Entry, d.Icon} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Fatalf("Expected %s to be removed", p)
+		}
+	}
+}
+
+func TestIntegrateNotAppImage(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	p := filepath.Join(t.TempDir(), "app")
+	if err := os.WriteFile(p, []byte("\x7fELF\x02\x01\x01\x00\x00\x00\x00 binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Integrate(p); !errors.Is(err, ErrNotAppImage) {
+		t.Fatalf("Expected ErrNotAppImage, got %v", err)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	cases := []struct {
+		in   string
+		path string
+		icon string
+		out  string
+	}{
+		{"Exec=app\n", "/opt/bin/app", "", "Exec=/opt/bin/app\n"},
+		{"Exec=AppRun %F\nIcon=app\n", "/opt/bin/app", "", "Exec=/opt/bin/app %F\nIcon=app\n"},
+		{"Exec=\"my app\" --flag %u\n", "/opt/bin/app", "/icons/app.svg", "Exec=/opt/bin/app --flag %u\n"},
+		{"Exec=app %U\nIcon=app\n", "/home/me/My Apps/app", "/icons/app.svg", "Exec=\"/home/me/My Apps/app\" %U\nIcon=/icons/app.svg\n"},
+		{"Name=Exec\nComment=Exec=app\n", "/opt/bin/app", "", "Name=Exec\nComment=Exec=app\n"},
+	}
+
+	for _, c := range cases {
+		if out := string(rewrite([]byte(c.in), c.path, c.icon)); out != c.out {
+			t.Errorf("Expected %q rewritten to %q, got %q", c.in, c.out, out)
+		}
+	}
+}
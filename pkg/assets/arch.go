@@ -0,0 +1,86 @@
+// arch.go
+//
+// tell the assets built for another architecture by their names. The names of some
+// architectures contain the ones of others, e.g. arm64 and arm, or x86_64 and x86,
+// so the longest names are matched first
+package assets
+
+import (
+	"strings"
+	"unicode"
+
+	bstrings "github.com/dfang/bin/pkg/strings"
+)
+
+// stripForeignArch lowercases the asset name and blanks out the names of the
+// architectures the target can't run, which are only matched as whole words.
+// It tells if there were any, the ones within the names of the target
+// architecture, like the arm of arm64 on arm64 hosts, don't count.
+func stripForeignArch(r platformResolver, name string) (string, bool) {
+	bs := []byte(strings.ToLower(name))
+	own := make([]bool, len(bs))
+	for _, a := range r.GetArch() {
+		for _, i := range indexAll(string(bs), strings.ToLower(a)) {
+			for j := i; j < i+len(a); j++ {
+				own[j] = true
+			}
+		}
+	}
+
+	foreign := false
+	for _, a := range r.GetForeignArch() {
+		for _, i := range indexAll(string(bs), a) {
+			end := i + len(a)
+			if isLetter(bs, i-1) || isLetter(bs, end) || all(own[i:end]) {
+				continue
+			}
+			for j := i; j < end; j++ {
+				bs[j] = '/'
+			}
+			foreign = true
+		}
+	}
+	return string(bs), foreign
+}
+
+// forForeignArch checks if the asset is only named after
+// architectures the target can't run, name is stripped already.
+func forForeignArch(r platformResolver, name string, foreign bool) bool {
+	if !foreign {
+		return false
+	}
+	arch := []string{}
+	for _, a := range r.GetArch() {
+		arch = append(arch, strings.ToLower(a))
+	}
+	return !bstrings.ContainsAny(name, arch)
+}
+
+// indexAll returns the indexes of the occurrences of sub in s.
+func indexAll(s, sub string) []int {
+	res := []int{}
+	if sub == "" {
+		return res
+	}
+	for i := 0; ; {
+		j := strings.Index(s[i:], sub)
+		if j < 0 {
+			return res
+		}
+		res = append(res, i+j)
+		i += j + 1
+	}
+}
+
+func isLetter(bs []byte, i int) bool {
+	return i >= 0 && i < len(bs) && unicode.IsLetter(rune(bs[i]))
+}
+
+func all(bs []bool) bool {
+	for _, b := range bs {
+		if !b {
+			return false
+		}
+	}
+	return true
+}
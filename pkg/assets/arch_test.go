@@ -0,0 +1,100 @@
+package assets
+
+import (
+	"testing"
+)
+
+func TestFilterAssetsArch(t *testing.T) {
+	goreleaser := []*Asset{
+		{Name: "tool_1.0.0_darwin_arm64.tar.gz"},
+		{Name: "tool_1.0.0_linux_386.tar.gz"},
+		{Name: "tool_1.0.0_linux_amd64.tar.gz"},
+		{Name: "tool_1.0.0_linux_arm64.tar.gz"},
+		{Name: "tool_1.0.0_linux_armv6.tar.gz"},
+		{Name: "tool_1.0.0_linux_armv7.tar.gz"},
+		{Name: "tool_1.0.0_linux_ppc64le.tar.gz"},
+		{Name: "tool_1.0.0_linux_riscv64.tar.gz"},
+	}
+	rust := []*Asset{
+		{Name: "tool-1.0.0-aarch64-apple-darwin.tar.gz"},
+		{Name: "tool-1.0.0-aarch64-unknown-linux-musl.tar.gz"},
+		{Name: "tool-1.0.0-arm-unknown-linux-musleabihf.tar.gz"},
+		{Name: "tool-1.0.0-armv7-unknown-linux-musleabihf.tar.gz"},
+		{Name: "tool-1.0.0-i686-unknown-linux-musl.tar.gz"},
+		{Name: "tool-1.0.0-powerpc64le-unknown-linux-gnu.tar.gz"},
+		{Name: "tool-1.0.0-riscv64gc-unknown-linux-gnu.tar.gz"},
+		{Name: "tool-1.0.0-x86_64-unknown-linux-musl.tar.gz"},
+	}
+
+	cases := []struct {
+		goarch, goarm string
+		as            []*Asset
+		out           string
+	}{
+		{"amd64", "", goreleaser, "tool_1.0.0_linux_amd64.tar.gz"},
+		{"arm64", "", goreleaser, "tool_1.0.0_linux_arm64.tar.gz"},
+		{"arm", "7", goreleaser, "tool_1.0.0_linux_armv7.tar.gz"},
+		{"arm", "6", goreleaser, "tool_1.0.0_linux_armv6.tar.gz"},
+		{"386", "", goreleaser, "tool_1.0.0_linux_386.tar.gz"},
+		{"ppc64le", "", goreleaser, "tool_1.0.0_linux_ppc64le.tar.gz"},
+		{"riscv64", "", goreleaser, "tool_1.0.0_linux_riscv64.tar.gz"},
+		{"amd64", "", rust, "tool-1.0.0-x86_64-unknown-linux-musl.tar.gz"},
+		{"arm64", "", rust, "tool-1.0.0-aarch64-unknown-linux-musl.tar.gz"},
+		{"arm", "7", rust, "tool-1.0.0-armv7-unknown-linux-musleabihf.tar.gz"},
+		{"arm", "6", rust, "tool-1.0.0-arm-unknown-linux-musleabihf.tar.gz"},
+		{"386", "", rust, "tool-1.0.0-i686-unknown-linux-musl.tar.gz"},
+		{"ppc64le", "", rust, "tool-1.0.0-powerpc64le-unknown-linux-gnu.tar.gz"},
+		{"riscv64", "", rust, "tool-1.0.0-riscv64gc-unknown-linux-gnu.tar.gz"},
+		// the assets named after other architectures only are skipped
+		{"arm64", "", goreleaser[4:6], ""},
+		{"arm", "7", goreleaser[2:4], ""},
+		{"386", "", []*Asset{rust[1], rust[7]}, ""},
+		{"amd64", "", goreleaser[3:5], ""},
+	}
+
+	for _, c := range cases {
+		resolver = linuxResolver(c.goarch, c.goarm)
+		f := NewFilter(&FilterOpts{})
+		gf, err := f.FilterAssets("tool", c.as)
+		if c.out == "" {
+			if err == nil {
+				t.Errorf("Expected no asset for %s%s, got %s", c.goarch, c.goarm, gf.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Error filtering assets for %s%s: %v", c.goarch, c.goarm, err)
+			continue
+		}
+		if gf.Name != c.out {
+			t.Errorf("Expected %s for %s%s, got %s", c.out, c.goarch, c.goarm, gf.Name)
+		}
+	}
+}
+
+func TestStripForeignArch(t *testing.T) {
+	cases := []struct {
+		goarch  string
+		name    string
+		foreign bool
+	}{
+		{"amd64", "tool-linux-x86_64", false},
+		{"amd64", "tool-linux64", false},
+		{"amd64", "tool-linux-arm64", true},
+		{"amd64", "harmony-linux", false},
+		{"arm64", "tool-linux-arm64", false},
+		{"arm64", "tool-linux-aarch64", false},
+		{"arm64", "tool-linux-armhf", true},
+		{"386", "tool-linux-x86_64", true},
+		{"386", "tool-linux-x86", false},
+		{"ppc64le", "tool-linux-ppc64le", false},
+		{"ppc64", "tool-linux-ppc64le", true},
+	}
+
+	for _, c := range cases {
+		resolver = linuxResolver(c.goarch, "")
+		if _, foreign := stripForeignArch(resolver, c.name); foreign != c.foreign {
+			t.Errorf("Expected %s to be for another architecture than %s: %v, got %v", c.name, c.goarch, c.foreign, foreign)
+		}
+	}
+}
@@ -1,13 +1,13 @@
 package assets
 
 import (
-	"bytes"
+	"fmt"
 	"io"
 	"os"
-	"path"
 	"strings"
+	"unicode"
 
-	"github.com/cheggaaa/pb"
+	"github.com/dfang/bin/pkg/cache"
 	"github.com/dfang/bin/pkg/config"
 	zlog "github.com/rs/zerolog/log"
 )
@@ -21,6 +21,11 @@ type Asset struct {
 	URL                string
 	Size               int64
 	BrowserDownloadURL string
+	// Mode is the mode of the archive contents, 0 if unknown
+	Mode os.FileMode
+	// elf is the ELF header of the archive contents, nil if
+	// they're not ELF binaries or the header isn't read
+	elf *elfHeader
 }
 
 func (g Asset) String() string {
@@ -39,15 +44,42 @@ type FilteredAsset struct {
 	URL                string // API URL: https://api.github.com/repos/BurntSushi/ripgrep/releases/assets/38486907
 	BrowserDownloadURL string // BrowserDownloadURL: https://github.com/junegunn/fzf/releases/download/0.42.0/fzf-0.42.0-darwin_amd64.zip
 	score              int
+	mode               os.FileMode
+	elf                *elfHeader
 	Size               int64
 	ContentMd5         string
 	ExtraHeaders       map[string]string
+	// Template is the name of the asset with its version replaced,
+	// set when it's selected among several ones with the same score
+	Template string
 }
 
 type finalFile struct {
+	// Source is the content of the binary, it has to be
+	// closed if it implements io.Closer
 	Source      io.Reader
 	Name        string
 	PackagePath string
+	// Mode is the mode of the binary in the archive, 0 if unknown
+	Mode os.FileMode
+	// Checksum is the verified upstream checksum of the downloaded asset, if any
+	Checksum *Checksum
+	// Provenance is the verified provenance of the downloaded asset, if required
+	Provenance *config.Provenance
+	// AssetDigest is the sha256 of the downloaded asset
+	AssetDigest *config.Digest
+	// AssetTemplate is the template of the asset the binary comes from, see
+	// FilteredAsset.Template. It's the one of the musl or static asset the
+	// binary is replaced with when it can't run with the libc of the host
+	AssetTemplate string
+	// Others are the other binaries picked from the same
+	// archive, see FilterOpts.Pick and FilterOpts.PickMany
+	Others []*finalFile
+	// Companions are the shell completions and man pages
+	// of the archive, see FilterOpts.Companions
+	Companions []*Companion
+	// libcErr tells why the binary can't run with the libc of the host
+	libcErr error
 }
 
 // SanitizeName removes irrelevant information from the
@@ -87,27 +119,173 @@ func SanitizeName(name, version string) string {
 	return r.Replace(name)
 }
 
+// ReplaceVersion replaces the version in name with repl where it sits
+// between separators, optionally after a v, so short versions like 6
+// don't replace the digits of other words like arm64.
+func ReplaceVersion(name, version, repl string) string {
+	version = strings.TrimPrefix(version, "v")
+	if version == "" {
+		return name
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); {
+		end := i + len(version)
+		if strings.HasPrefix(name[i:], version) && isSeparator(name, i-1, true) && isSeparator(name, end, false) {
+			b.WriteString(repl)
+			i = end
+			continue
+		}
+		b.WriteByte(name[i])
+		i++
+	}
+	return b.String()
+}
+
+// isSeparator tells if the byte of name at i separates a version from the
+// rest of the name, the bounds of name do. A v before the version is skipped.
+func isSeparator(name string, i int, before bool) bool {
+	if before && i >= 0 && (name[i] == 'v' || name[i] == 'V') {
+		i--
+	}
+	if i < 0 || i >= len(name) {
+		return true
+	}
+	c := rune(name[i])
+	return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+}
+
+// cachedAsset returns the path of the asset in the download
+// cache, it's downloaded if it isn't cached yet.
+func (f *Filter) cachedAsset(gf *FilteredAsset) (string, error) {
+	c := cache.Default()
+	key := f.cacheKey(gf.Name)
+	defer cache.Lock(key)()
+
+	if e, p, ok := c.Lookup(key); ok && (gf.Size <= 0 || e.Size == gf.Size) {
+		zlog.Info().Msgf("Using %s from the download cache", key)
+		return p, nil
+	}
+	if f.opts.Offline {
+		return "", fmt.Errorf("%s: %w", key, cache.ErrNotCached)
+	}
+
+	partial, err := c.PartialPath(key)
+	if err != nil {
+		return "", err
+	}
+	if err := grabAsset(gf.BrowserDownloadURL, partial, gf.Size, nil); err != nil {
+		return "", err
+	}
+	_, p, err := c.Store(key, gf.BrowserDownloadURL, partial)
+	return p, err
+}
+
+// cacheKey returns the key of the named asset in the download cache.
+func (f *Filter) cacheKey(name string) cache.Key {
+	key := f.opts.CacheKey
+	if key.Repo == "" {
+		key.Repo = f.repoName
+	}
+	key.Asset = name
+	return key
+}
+
+// cachedCandidates returns the assets available in the download cache.
+func (f *Filter) cachedCandidates(as []*Asset) []*Asset {
+	c := cache.Default()
+	cached := []*Asset{}
+	for _, a := range as {
+		if _, _, ok := c.Lookup(f.cacheKey(a.Name)); ok {
+			cached = append(cached, a)
+		}
+	}
+	return cached
+}
+
+// auxiliaryFile returns the content of a small release file, like a checksum
+// or signature file. The files are kept in the download cache so the asset
+// can still be verified offline.
+func (f *Filter) auxiliaryFile(a *Asset) ([]byte, error) {
+	c := cache.Default()
+	key := f.cacheKey(a.Name)
+	defer cache.Lock(key)()
+
+	if f.opts.Offline {
+		_, p, ok := c.Lookup(key)
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", key, cache.ErrNotCached)
+		}
+		return os.ReadFile(p)
+	}
+
+	bs, err := fetchAuxiliaryFile(a, f.headers)
+	if err != nil {
+		return nil, err
+	}
+	if c.Dir() != "" {
+		if err := storeAuxiliaryFile(c, key, a.BrowserDownloadURL, bs); err != nil {
+			zlog.Debug().Err(err).Msgf("Could not cache %s", key)
+		}
+	}
+	return bs, nil
+}
+
+func storeAuxiliaryFile(c *cache.Cache, key cache.Key, url string, bs []byte) error {
+	partial, err := c.PartialPath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(partial, bs, 0o600); err != nil {
+		return err
+	}
+	_, _, err = c.Store(key, url, partial)
+	return err
+}
+
 // ProcessURL processes a FilteredAsset by uncompressing/unarchiving the URL of the asset.
 func (f *Filter) ProcessURL(gf *FilteredAsset) (*finalFile, error) {
 	zlog.Debug().Msgf("cache_dir: %s", config.GetCacheDir())
-	expectedFilePath := path.Join(config.GetCacheDir(), gf.Name)
+	expectedFilePath, err := f.cachedAsset(gf)
+	if err != nil {
+		return nil, err
+	}
 	zlog.Debug().Msgf("expectedFilePath: %s", expectedFilePath)
-	// filename := filepath.Base(expectedFilePath)
-
-	grabAsset(gf.BrowserDownloadURL, expectedFilePath)
 	f.name = gf.Name
+	f.headers = gf.ExtraHeaders
+
+	// the asset is only hashed once, the digest is
+	// shared by the checksum and signature checks
+	assetDigest, err := FileDigest(expectedFilePath, "sha256")
+	if err != nil {
+		return nil, err
+	}
+
+	checksum, err := f.validate(gf, expectedFilePath, assetDigest)
+	if err != nil {
+		return nil, err
+	}
+
+	provenance, err := f.verifySignatures(gf, expectedFilePath, assetDigest)
+	if err != nil {
+		return nil, err
+	}
 
 	zlog.Info().Msg("processing downloaded asset ...")
-	bar := pb.Full.Start64(0)
-	expectedFile, _ := os.Open(expectedFilePath)
-	defer expectedFile.Close()
-	barReader := bar.NewProxyReader(expectedFile)
-	defer bar.Finish()
-	buf := new(bytes.Buffer)
-	_, err := io.Copy(buf, barReader)
+	outFile, err := f.processFile(expectedFilePath, false)
 	if err != nil {
 		return nil, err
 	}
-	bar.Finish()
-	return f.processReader(buf)
+	outFile.Checksum = checksum
+	outFile.Provenance = provenance
+	outFile.AssetDigest = assetDigest
+	outFile.AssetTemplate = gf.Template
+
+	if bad := outFile.unrunnable(); bad != nil {
+		if libcOf(gf.Name) == musl || isStatic(gf.Name) {
+			zlog.Warn().Msgf("%s may not run on this host, %v", bad.Name, bad.libcErr)
+		} else {
+			return f.libcFallback(gf, outFile), nil
+		}
+	}
+	return outFile, nil
 }
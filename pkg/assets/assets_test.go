@@ -2,14 +2,20 @@ package assets
 
 import (
 	"fmt"
+	"os"
 	"strings"
 	"testing"
+
+	"github.com/dfang/bin/pkg/cache"
+	"github.com/dfang/bin/pkg/config"
 )
 
 type mockOSResolver struct {
 	OS                   []string
 	Arch                 []string
+	ForeignArch          []string
 	OSSpecificExtensions []string
+	Libc                 *libc
 }
 
 func (m *mockOSResolver) GetOS() []string {
@@ -20,13 +26,26 @@ func (m *mockOSResolver) GetArch() []string {
 	return m.Arch
 }
 
+func (m *mockOSResolver) GetForeignArch() []string {
+	return m.ForeignArch
+}
+
 func (m *mockOSResolver) GetOSSpecificExtensions() []string {
 	return m.OSSpecificExtensions
 }
 
+func (m *mockOSResolver) GetLibc() *libc {
+	return m.Libc
+}
+
+// linuxResolver resolves Linux on goarch, goarm is the arm variant.
+func linuxResolver(goarch, goarm string) *mockOSResolver {
+	return &mockOSResolver{OS: []string{"linux"}, Arch: config.ArchAliases(goarch, goarm), ForeignArch: config.ForeignArchAliases(goarch, goarm), OSSpecificExtensions: []string{"AppImage"}}
+}
+
 var (
-	testLinuxAMDResolver   = &mockOSResolver{OS: []string{"linux"}, Arch: []string{"amd64", "x86_64", "x64", "64"}, OSSpecificExtensions: []string{"AppImage"}}
-	testWindowsAMDResolver = &mockOSResolver{OS: []string{"windows", "win"}, Arch: []string{"amd64", "x86_64", "x64", "64"}, OSSpecificExtensions: []string{"exe"}}
+	testLinuxAMDResolver   = linuxResolver("amd64", "")
+	testWindowsAMDResolver = &mockOSResolver{OS: []string{"windows", "win"}, Arch: config.ArchAliases("amd64", ""), ForeignArch: config.ForeignArchAliases("amd64", ""), OSSpecificExtensions: []string{"exe"}}
 )
 
 func TestSanitizeName(t *testing.T) {
@@ -54,6 +73,28 @@ func TestSanitizeName(t *testing.T) {
 	}
 }
 
+func TestReplaceVersion(t *testing.T) {
+	cases := []struct {
+		in  string
+		v   string
+		out string
+	}{
+		{"kubebuilder_2.3.1_linux_amd64/bin/etcd", "v2.3.1", "kubebuilder_*_linux_amd64/bin/etcd"},
+		{"tool-v1.0.0-linux-amd64.tar.gz", "v1.0.0", "tool-v*-linux-amd64.tar.gz"},
+		{"tool_1.0.0_linux_amd64.tar.gz", "1.0.0", "tool_*_linux_amd64.tar.gz"},
+		{"tool-6-linux-arm64.tar.gz", "6", "tool-*-linux-arm64.tar.gz"},
+		{"tool-v4-linux-x86_64.tar.gz", "v4", "tool-v*-linux-x86_64.tar.gz"},
+		{"tool-1.0.10-linux-amd64", "1.0.1", "tool-1.0.10-linux-amd64"},
+		{"tool-linux-amd64", "", "tool-linux-amd64"},
+	}
+
+	for _, c := range cases {
+		if n := ReplaceVersion(c.in, c.v, "*"); n != c.out {
+			t.Errorf("Error replacing %s in %s: %s does not match %s", c.v, c.in, n, c.out)
+		}
+	}
+}
+
 type args struct {
 	repoName string
 	as       []*Asset
@@ -143,6 +184,16 @@ func TestFilterAssets(t *testing.T) {
 			{Name: "usql-0.8.2-linux-amd64.tar.bz2", URL: "https://github.com/xo/usql/releases/download/v0.8.2/usql-0.8.2-linux-amd64.tar.bz2"},
 			{Name: "usql-0.8.2-windows-amd64.zip", URL: "https://github.com/xo/usql/releases/download/v0.8.2/usql-0.8.2-windows-amd64.zip"},
 		}}, "usql-0.8.2-windows-amd64.zip", testWindowsAMDResolver},
+		{args{"bin", []*Asset{
+			{Name: "bin_0.1.0_darwin_amd64.tar.gz", URL: "https://github.com/dfang/bin/releases/download/v0.1.0/bin_0.1.0_darwin_amd64.tar.gz"},
+			{Name: "bin_0.1.0_amd64.deb", URL: "https://github.com/dfang/bin/releases/download/v0.1.0/bin_0.1.0_amd64.deb"},
+			{Name: "bin_0.1.0_windows_amd64.zip", URL: "https://github.com/dfang/bin/releases/download/v0.1.0/bin_0.1.0_windows_amd64.zip"},
+		}}, "bin_0.1.0_amd64.deb", testLinuxAMDResolver},
+		{args{"bin", []*Asset{
+			{Name: "bin_0.1.0_linux_amd64.tar.gz", URL: "https://github.com/dfang/bin/releases/download/v0.1.0/bin_0.1.0_linux_amd64.tar.gz"},
+			{Name: "bin_0.1.0_amd64.deb", URL: "https://github.com/dfang/bin/releases/download/v0.1.0/bin_0.1.0_amd64.deb"},
+			{Name: "bin-0.1.0.x86_64.rpm", URL: "https://github.com/dfang/bin/releases/download/v0.1.0/bin-0.1.0.x86_64.rpm"},
+		}}, "bin_0.1.0_linux_amd64.tar.gz", testLinuxAMDResolver},
 		{args{"cli", []*Asset{
 			{Name: "dapr", URL: ""},
 		}}, "dapr", testLinuxAMDResolver},
@@ -162,6 +213,126 @@ func TestFilterAssets(t *testing.T) {
 	}
 }
 
+func TestFilterAssetsRules(t *testing.T) {
+	resolver = testLinuxAMDResolver
+	as := []*Asset{
+		{Name: "ripgrep-14.1.0-x86_64-apple-darwin.tar.gz"},
+		{Name: "ripgrep-14.1.0-x86_64-unknown-linux-gnu.tar.gz"},
+		{Name: "ripgrep-14.1.0-x86_64-unknown-linux-musl.tar.gz"},
+		{Name: "ripgrep_14.1.0-1_amd64.deb"},
+	}
+
+	cases := []struct {
+		rules *config.AssetRules
+		out   string
+	}{
+		{&config.AssetRules{Include: []string{"musl"}}, "ripgrep-14.1.0-x86_64-unknown-linux-musl.tar.gz"},
+		{&config.AssetRules{Exclude: []string{"-gnu\\."}}, "ripgrep-14.1.0-x86_64-unknown-linux-musl.tar.gz"},
+		{&config.AssetRules{Weights: map[string]int{"GNU": 20}}, "ripgrep-14.1.0-x86_64-unknown-linux-gnu.tar.gz"},
+		{&config.AssetRules{Weights: map[string]int{"musl": -10}}, "ripgrep-14.1.0-x86_64-unknown-linux-gnu.tar.gz"},
+		// the OS and architecture still have to match
+		{&config.AssetRules{Include: []string{"darwin", "musl"}}, "ripgrep-14.1.0-x86_64-unknown-linux-musl.tar.gz"},
+		{&config.AssetRules{Include: []string{"\\.zip$"}}, ""},
+		{&config.AssetRules{Exclude: []string{"("}}, ""},
+	}
+
+	for _, c := range cases {
+		f := NewFilter(&FilterOpts{Rules: c.rules})
+		gf, err := f.FilterAssets("ripgrep", as)
+		if c.out == "" {
+			if err == nil {
+				t.Fatalf("Expected an error filtering with %+v, got %s", c.rules, gf.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Error filtering assets with %+v: %v", c.rules, err)
+		}
+		if gf.Name != c.out {
+			t.Fatalf("Expected %s with %+v, got %s", c.out, c.rules, gf.Name)
+		}
+	}
+}
+
+func TestAssetTemplate(t *testing.T) {
+	cases := []struct {
+		name    string
+		version string
+		out     string
+	}{
+		{"ripgrep-14.1.0-x86_64-unknown-linux-musl.tar.gz", "14.1.0", "ripgrep-{version}-x86_64-unknown-linux-musl.tar.gz"},
+		{"tool_v1.2.3_linux_amd64.zip", "v1.2.3", "tool_v{version}_linux_amd64.zip"},
+		{"tool-linux-amd64", "v1.2.3", "tool-linux-amd64"},
+		{"tool-linux-amd64", "", "tool-linux-amd64"},
+		// short versions only replace whole words
+		{"tool-6-linux-arm64.tar.gz", "6", "tool-{version}-linux-arm64.tar.gz"},
+		{"tool_v4_linux_x86_64.tar.gz", "v4", "tool_v{version}_linux_x86_64.tar.gz"},
+	}
+
+	for _, c := range cases {
+		if out := assetTemplate(c.name, c.version); out != c.out {
+			t.Errorf("Expected the template of %s %s to be %s, got %s", c.name, c.version, c.out, out)
+		}
+	}
+}
+
+func TestFilterAssetsTemplate(t *testing.T) {
+	resolver = testLinuxAMDResolver
+	release := func(version string) []*Asset {
+		return []*Asset{
+			{Name: "ripgrep-" + version + "-x86_64-apple-darwin.tar.gz"},
+			{Name: "ripgrep-" + version + "-x86_64-unknown-linux-gnu.tar.gz"},
+			{Name: "ripgrep-" + version + "-x86_64-unknown-linux-musl.tar.gz"},
+		}
+	}
+
+	// the user selects the musl asset
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+	os.Stdin = r
+	fmt.Fprintln(w, "2")
+	w.Close()
+
+	f := NewFilter(&FilterOpts{CacheKey: cache.Key{Version: "14.0.0"}})
+	gf, err := f.FilterAssets("ripgrep", release("14.0.0"))
+	if err != nil {
+		t.Fatalf("Error filtering assets: %v", err)
+	}
+	if gf.Template != "ripgrep-{version}-x86_64-unknown-linux-musl.tar.gz" {
+		t.Fatalf("Expected the template of the selected asset, got %q", gf.Template)
+	}
+
+	// the next release is selected without prompting, stdin is closed
+	f = NewFilter(&FilterOpts{CacheKey: cache.Key{Version: "v14.1.0"}, AssetTemplate: gf.Template})
+	gf, err = f.FilterAssets("ripgrep", release("14.1.0"))
+	if err != nil {
+		t.Fatalf("Error filtering assets with the template: %v", err)
+	}
+	if gf.Name != "ripgrep-14.1.0-x86_64-unknown-linux-musl.tar.gz" {
+		t.Fatalf("Expected the asset matching the template, got %s", gf.Name)
+	}
+
+	// the template is kept even if scoring prefers another asset
+	f = NewFilter(&FilterOpts{CacheKey: cache.Key{Version: "v2.0.0"}, AssetTemplate: "cli-{version}-linux-amd64.tar.gz"})
+	gf, err = f.FilterAssets("tool", []*Asset{{Name: "tool-2.0.0-linux-amd64.tar.gz"}, {Name: "cli-2.0.0-linux-amd64.tar.gz"}})
+	if err != nil {
+		t.Fatalf("Error filtering assets with the template: %v", err)
+	}
+	if gf.Name != "cli-2.0.0-linux-amd64.tar.gz" {
+		t.Fatalf("Expected the asset matching the template, got %s", gf.Name)
+	}
+
+	// the user is prompted again once the template doesn't match
+	f = NewFilter(&FilterOpts{CacheKey: cache.Key{Version: "15.0.0"}, AssetTemplate: "rg-{version}-x86_64-linux-musl.tar.gz"})
+	if gf, err = f.FilterAssets("ripgrep", release("15.0.0")); err == nil {
+		t.Fatalf("Expected a prompt, got %s", gf.Name)
+	}
+}
+
 func TestIsSupportedExt(t *testing.T) {
 	cases := []struct {
 		in  string
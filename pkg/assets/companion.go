@@ -0,0 +1,75 @@
+// companion.go
+//
+// shell completions and man pages shipped along with the binary in archives,
+// they're installed under the XDG data directory where the shells and man look for them
+package assets
+
+import (
+	"io"
+	"path"
+	"strings"
+)
+
+// Companion is a shell completion or a man page shipped in the archive of a binary.
+type Companion struct {
+	// Path is where the file is installed, relative
+	// to the XDG data directory, e.g. man/man1/rg.1
+	Path string
+	// Source is the content of the file, it has to
+	// be closed if it implements io.Closer
+	Source io.Reader
+}
+
+// companionPath returns where the archive entry name is installed if it's
+// a completion or a man page, relative to the XDG data directory, or "".
+func companionPath(name string) string {
+	base := path.Base(name)
+	ext := path.Ext(base)
+	dir := strings.ToLower(path.Dir(name))
+
+	// man pages like doc/rg.1 or man/man1/bat.1.gz, but
+	// not versioned names like libfoo.so.1 or v1.2
+	if section := path.Ext(strings.TrimSuffix(base, ".gz")); len(section) == 2 && section[1] >= '1' && section[1] <= '9' {
+		stem := strings.TrimSuffix(strings.TrimSuffix(base, ".gz"), section)
+		if stem != "" && !strings.Contains(stem, ".so") && (stem[len(stem)-1] < '0' || stem[len(stem)-1] > '9') {
+			return path.Join("man", "man"+section[1:], base)
+		}
+	}
+
+	// completions like complete/_rg, completions/bat.fish or autocomplete/bash_autocomplete
+	if !strings.Contains(dir, "complet") && !strings.Contains(strings.ToLower(base), "complet") {
+		return ""
+	}
+	switch {
+	case ext == ".fish":
+		return path.Join("fish", "vendor_completions.d", base)
+	case ext == ".zsh":
+		return path.Join("zsh", "site-functions", "_"+strings.TrimPrefix(strings.TrimSuffix(base, ext), "_"))
+	case ext == "" && strings.HasPrefix(base, "_"):
+		return path.Join("zsh", "site-functions", base)
+	case ext == ".bash" || ext == ".bash-completion":
+		return path.Join("bash-completion", "completions", strings.TrimSuffix(base, ext))
+	case ext == "" && strings.Contains(strings.ToLower(name), "bash"):
+		return path.Join("bash-completion", "completions", base)
+	}
+	return ""
+}
+
+// companionContents returns the completions and man pages among the
+// archive entries names, which aren't selected as binaries, with the
+// path they're installed to. It's empty unless FilterOpts.Companions is set.
+func (f *Filter) companionContents(names, selected []string) map[string]string {
+	companions := map[string]string{}
+	if !f.opts.Companions {
+		return companions
+	}
+	for _, name := range names {
+		if contains(selected, name) {
+			continue
+		}
+		if p := companionPath(name); p != "" {
+			companions[name] = p
+		}
+	}
+	return companions
+}
@@ -0,0 +1,113 @@
+package assets
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompanionPath(t *testing.T) {
+	cases := []struct {
+		in  string
+		out string
+	}{
+		{"doc/rg.1", "man/man1/rg.1"},
+		{"bat-v0.24.0/bat.1.gz", "man/man1/bat.1.gz"},
+		{"man/man5/tool.conf.5", "man/man5/tool.conf.5"},
+		{"complete/_rg", "zsh/site-functions/_rg"},
+		{"completions/bat.zsh", "zsh/site-functions/_bat"},
+		{"completions/bat.fish", "fish/vendor_completions.d/bat.fish"},
+		{"complete/rg.bash", "bash-completion/completions/rg"},
+		{"completions/fd.bash-completion", "bash-completion/completions/fd"},
+		{"autocomplete/bash_autocomplete", "bash-completion/completions/bash_autocomplete"},
+		{"rg", ""},
+		{"README.md", ""},
+		{"scripts/install.bash", ""},
+		{"complete/_", "zsh/site-functions/_"},
+		{"v1.2", ""},
+		{"lib/libfoo.so.1", ""},
+		{"lib/.1", ""},
+	}
+
+	for _, c := range cases {
+		if out := companionPath(c.in); out != c.out {
+			t.Errorf("Expected %s to be installed at %q, got %q", c.in, c.out, out)
+		}
+	}
+}
+
+func TestProcessFileCompanions(t *testing.T) {
+	contents := map[string][]byte{
+		"rg/rg":               []byte("\x7fELF rg"),
+		"rg/complete/_rg":     []byte("#compdef rg"),
+		"rg/complete/rg.bash": []byte("complete -F _rg rg"),
+		"rg/complete/rg.fish": []byte("complete -c rg"),
+		"rg/doc/rg.1":         []byte(".TH RG 1"),
+		"rg/README.md":        []byte("# rg"),
+	}
+
+	cases := []struct {
+		name       string
+		data       []byte
+		companions bool
+		out        map[string]string
+	}{
+		{"rg.tar.gz", tarGz(t, contents), true, map[string]string{
+			"zsh/site-functions/_rg":            "#compdef rg",
+			"bash-completion/completions/rg":    "complete -F _rg rg",
+			"fish/vendor_completions.d/rg.fish": "complete -c rg",
+			"man/man1/rg.1":                     ".TH RG 1",
+		}},
+		{"rg.zip", zipArchive(t, contents), true, map[string]string{
+			"zsh/site-functions/_rg":            "#compdef rg",
+			"bash-completion/completions/rg":    "complete -F _rg rg",
+			"fish/vendor_completions.d/rg.fish": "complete -c rg",
+			"man/man1/rg.1":                     ".TH RG 1",
+		}},
+		{"rg.tar.gz", tarGz(t, contents), false, map[string]string{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("TMPDIR", dir)
+			p := filepath.Join(dir, c.name)
+			if err := os.WriteFile(p, c.data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			f := InitFilter("rg", c.name, "", &FilterOpts{PackagePath: "rg/rg", Companions: c.companions})
+			out, err := f.processFile(p, false)
+			if err != nil {
+				t.Fatalf("Error processing archive: %v", err)
+			}
+			if out.Name != "rg" {
+				t.Fatalf("Expected rg, got %s", out.Name)
+			}
+
+			companions := map[string]string{}
+			for _, companion := range out.Companions {
+				bs, err := io.ReadAll(companion.Source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				companions[companion.Path] = string(bs)
+			}
+			if len(companions) != len(c.out) {
+				t.Fatalf("Expected %d companions, got %v", len(c.out), companions)
+			}
+			for k, v := range c.out {
+				if companions[k] != v {
+					t.Fatalf("Expected %s with %q, got %q", k, v, companions[k])
+				}
+			}
+			closeFinalFiles([]*finalFile{out})
+
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != 1 {
+				t.Fatalf("Expected temporary files to be removed, found %d files", len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,483 @@
+// cosign.go
+//
+// verify cosign signatures and Sigstore bundles offline, with a locally supplied
+// public key or trusted root. Transparency log inclusion proofs aren't checked,
+// the integrated time of the log entry is only used as the signing time.
+package assets
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dfang/bin/pkg/config"
+	zlog "github.com/rs/zerolog/log"
+)
+
+var (
+	// OIDC issuer extensions added by Fulcio to the signing certificates,
+	// see https://github.com/sigstore/fulcio/blob/main/docs/oid-info.md
+	oidIssuerV1 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	oidIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// sigstoreBundle is a Sigstore bundle (<asset>.sigstore.json) or a
+// legacy bundle produced by `cosign sign-blob --bundle`.
+type sigstoreBundle struct {
+	MediaType            string `json:"mediaType"`
+	VerificationMaterial struct {
+		Certificate *struct {
+			RawBytes string `json:"rawBytes"`
+		} `json:"certificate"`
+		X509CertificateChain *struct {
+			Certificates []struct {
+				RawBytes string `json:"rawBytes"`
+			} `json:"certificates"`
+		} `json:"x509CertificateChain"`
+		TlogEntries []struct {
+			IntegratedTime string `json:"integratedTime"`
+		} `json:"tlogEntries"`
+	} `json:"verificationMaterial"`
+	MessageSignature *struct {
+		MessageDigest struct {
+			Algorithm string `json:"algorithm"`
+			Digest    string `json:"digest"`
+		} `json:"messageDigest"`
+		Signature string `json:"signature"`
+	} `json:"messageSignature"`
+	DSSEEnvelope *dsseEnvelope `json:"dsseEnvelope"`
+
+	// legacy cosign bundle fields
+	Base64Signature string `json:"base64Signature"`
+	Cert            string `json:"cert"`
+	RekorBundle     *struct {
+		Payload struct {
+			IntegratedTime int64 `json:"integratedTime"`
+		} `json:"Payload"`
+	} `json:"rekorBundle"`
+}
+
+// dsseEnvelope is a DSSE envelope as found in Sigstore bundles of attestations.
+type dsseEnvelope struct {
+	PayloadType string `json:"payloadType"`
+	Payload     string `json:"payload"`
+	Signatures  []struct {
+		KeyID string `json:"keyid"`
+		Sig   string `json:"sig"`
+	} `json:"signatures"`
+}
+
+// sigstoreMaterial is what's needed to verify a signature once the
+// bundle or the .sig and .pem files have been parsed.
+type sigstoreMaterial struct {
+	signature []byte
+	// digest is the sha256 digest of the signed content, as stated by the bundle
+	digest []byte
+	// certs is the signing certificate followed by its chain, if any
+	certs []*x509.Certificate
+	// signedAt is the time the signature was logged in the transparency log
+	signedAt time.Time
+}
+
+// parseSigstoreBundle parses a Sigstore bundle in any of the supported formats.
+func parseSigstoreBundle(bs []byte) (*sigstoreBundle, *sigstoreMaterial, error) {
+	var b sigstoreBundle
+	if err := json.Unmarshal(bs, &b); err != nil {
+		return nil, nil, fmt.Errorf("error parsing sigstore bundle: %w", err)
+	}
+
+	m := &sigstoreMaterial{}
+	var err error
+	vm := b.VerificationMaterial
+	switch {
+	case vm.Certificate != nil:
+		if m.certs, err = parseDERCertificates(vm.Certificate.RawBytes); err != nil {
+			return nil, nil, err
+		}
+	case vm.X509CertificateChain != nil:
+		raw := []string{}
+		for _, c := range vm.X509CertificateChain.Certificates {
+			raw = append(raw, c.RawBytes)
+		}
+		if m.certs, err = parseDERCertificates(raw...); err != nil {
+			return nil, nil, err
+		}
+	case b.Cert != "":
+		if m.certs, err = parseCertificates([]byte(b.Cert)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, e := range vm.TlogEntries {
+		if t, err := strconv.ParseInt(e.IntegratedTime, 10, 64); err == nil && t > 0 {
+			m.signedAt = time.Unix(t, 0)
+			break
+		}
+	}
+	if b.RekorBundle != nil && b.RekorBundle.Payload.IntegratedTime > 0 {
+		m.signedAt = time.Unix(b.RekorBundle.Payload.IntegratedTime, 0)
+	}
+
+	switch {
+	case b.MessageSignature != nil:
+		if m.signature, err = decodeBase64(b.MessageSignature.Signature); err != nil {
+			return nil, nil, fmt.Errorf("error decoding bundle signature: %w", err)
+		}
+		if b.MessageSignature.MessageDigest.Digest != "" {
+			if b.MessageSignature.MessageDigest.Algorithm != "SHA2_256" {
+				return nil, nil, fmt.Errorf("unsupported bundle digest algorithm %s", b.MessageSignature.MessageDigest.Algorithm)
+			}
+			if m.digest, err = decodeBase64(b.MessageSignature.MessageDigest.Digest); err != nil {
+				return nil, nil, fmt.Errorf("error decoding bundle digest: %w", err)
+			}
+		}
+	case b.Base64Signature != "":
+		if m.signature, err = decodeBase64(b.Base64Signature); err != nil {
+			return nil, nil, fmt.Errorf("error decoding bundle signature: %w", err)
+		}
+	case b.DSSEEnvelope != nil:
+		// attestations don't sign the asset itself but a statement about it
+	default:
+		return nil, nil, fmt.Errorf("sigstore bundle doesn't contain a signature")
+	}
+
+	return &b, m, nil
+}
+
+func parseDERCertificates(raw ...string) ([]*x509.Certificate, error) {
+	res := []*x509.Certificate{}
+	for _, r := range raw {
+		der, err := decodeBase64(r)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding certificate: %w", err)
+		}
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+// parseCertificates parses PEM certificates, cosign writes them
+// base64 encoded with --output-certificate so both are accepted.
+func parseCertificates(bs []byte) ([]*x509.Certificate, error) {
+	if decoded, err := decodeBase64(string(bs)); err == nil {
+		bs = decoded
+	}
+
+	res := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, bs = pem.Decode(bs)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("no PEM certificate found")
+	}
+	return res, nil
+}
+
+// loadPublicKey reads a PEM encoded public key like the
+// ones generated by `cosign generate-key-pair`.
+func loadPublicKey(p string) (crypto.PublicKey, error) {
+	bs, err := os.ReadFile(os.ExpandEnv(p))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(bs)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM public key found in %s", p)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// trustedRoot is the subset of a Sigstore trusted_root.json used for
+// keyless verification.
+type trustedRoot struct {
+	CertificateAuthorities []struct {
+		CertChain struct {
+			Certificates []struct {
+				RawBytes string `json:"rawBytes"`
+			} `json:"certificates"`
+		} `json:"certChain"`
+	} `json:"certificateAuthorities"`
+}
+
+// loadTrustedRoot loads the certificate authorities from a Sigstore
+// trusted_root.json or a PEM bundle.
+func loadTrustedRoot(p string) (roots, intermediates *x509.CertPool, err error) {
+	bs, err := os.ReadFile(os.ExpandEnv(p))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var certs []*x509.Certificate
+	var tr trustedRoot
+	if json.Unmarshal(bs, &tr) == nil && len(tr.CertificateAuthorities) > 0 {
+		for _, ca := range tr.CertificateAuthorities {
+			raw := []string{}
+			for _, c := range ca.CertChain.Certificates {
+				raw = append(raw, c.RawBytes)
+			}
+			cs, err := parseDERCertificates(raw...)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error parsing trusted root %s: %w", p, err)
+			}
+			certs = append(certs, cs...)
+		}
+	} else if certs, err = parseCertificates(bs); err != nil {
+		return nil, nil, fmt.Errorf("error parsing trusted root %s: %w", p, err)
+	}
+
+	roots, intermediates = x509.NewCertPool(), x509.NewCertPool()
+	for _, c := range certs {
+		if c.CheckSignatureFrom(c) == nil {
+			roots.AddCert(c)
+		} else {
+			intermediates.AddCert(c)
+		}
+	}
+	return roots, intermediates, nil
+}
+
+// certificateIssuer returns the OIDC issuer recorded by Fulcio in the certificate.
+func certificateIssuer(c *x509.Certificate) string {
+	for _, ext := range c.Extensions {
+		switch {
+		case ext.Id.Equal(oidIssuerV2):
+			var issuer string
+			if _, err := asn1.Unmarshal(ext.Value, &issuer); err == nil {
+				return issuer
+			}
+		case ext.Id.Equal(oidIssuerV1):
+			return string(ext.Value)
+		}
+	}
+	return ""
+}
+
+// certificateIdentities returns the subject alternative names of the certificate.
+func certificateIdentities(c *x509.Certificate) []string {
+	res := []string{}
+	for _, u := range c.URIs {
+		res = append(res, u.String())
+	}
+	res = append(res, c.EmailAddresses...)
+	return res
+}
+
+// verifyCertificate checks that the signing certificate chains up to the trusted
+// root at the signing time and was issued to the expected identity, and returns
+// its public key.
+func verifyCertificate(policy *config.CosignPolicy, m *sigstoreMaterial) (crypto.PublicKey, error) {
+	if len(m.certs) == 0 {
+		return nil, fmt.Errorf("no signing certificate found and no key configured")
+	}
+	if policy.TrustedRoot == "" || policy.Identity == "" || policy.Issuer == "" {
+		return nil, fmt.Errorf("keyless verification requires a trusted root, an identity and an issuer")
+	}
+
+	roots, intermediates, err := loadTrustedRoot(policy.TrustedRoot)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range m.certs[1:] {
+		intermediates.AddCert(c)
+	}
+
+	leaf := m.certs[0]
+	signedAt := m.signedAt
+	if signedAt.IsZero() {
+		// without a transparency log entry the best we have is the
+		// beginning of the short lived certificate validity
+		signedAt = leaf.NotBefore
+	}
+
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   signedAt,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return nil, fmt.Errorf("invalid signing certificate: %w", err)
+	}
+
+	if issuer := certificateIssuer(leaf); issuer != policy.Issuer {
+		return nil, fmt.Errorf("certificate issuer %q doesn't match the expected %q", issuer, policy.Issuer)
+	}
+
+	matches := func(id string) bool { return id == policy.Identity }
+	if policy.IdentityRegexp {
+		re, err := regexp.Compile("^(?:" + policy.Identity + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity regexp %q: %w", policy.Identity, err)
+		}
+		matches = re.MatchString
+	}
+
+	identities := certificateIdentities(leaf)
+	for _, id := range identities {
+		if matches(id) {
+			return leaf.PublicKey, nil
+		}
+	}
+
+	return nil, fmt.Errorf("certificate identities %v don't match the expected %q", identities, policy.Identity)
+}
+
+// verifyBlobSignature verifies sig over the content of file with the given key.
+func verifyBlobSignature(pub crypto.PublicKey, file *signedFile, digest, sig []byte) error {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest, sig) {
+			return fmt.Errorf("invalid ECDSA signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, sig); err != nil {
+			return err
+		}
+	case ed25519.PublicKey:
+		// ed25519 signs the whole message instead of its digest
+		data, err := file.readAll()
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(k, data, sig) {
+			return fmt.Errorf("invalid ed25519 signature")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return nil
+}
+
+func sha256File(file *signedFile) ([]byte, error) {
+	if file.sha256 != nil {
+		return file.sha256, nil
+	}
+	r, err := file.open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// cosignMaterial fetches the cosign signature material of file from the release,
+// preferring Sigstore bundles over detached .sig/.pem files. It returns nil if the
+// release doesn't publish any.
+func (f *Filter) cosignMaterial(file *signedFile) (*sigstoreMaterial, error) {
+	if a := f.findSignatureAsset(file.name, ".sigstore.json", ".sigstore", ".bundle"); a != nil {
+		bs, err := f.auxiliaryFile(a)
+		if err != nil {
+			return nil, err
+		}
+		b, m, err := parseSigstoreBundle(bs)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", a.Name, err)
+		}
+		if b.DSSEEnvelope == nil {
+			return m, nil
+		}
+	}
+
+	a := f.findSignatureAsset(file.name, ".sig")
+	if a == nil {
+		return nil, nil
+	}
+	bs, err := f.auxiliaryFile(a)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(string(bs), untrustedCommentPrefix) {
+		// a signify signature
+		return nil, nil
+	}
+	m := &sigstoreMaterial{}
+	if m.signature, err = decodeBase64(string(bs)); err != nil {
+		m.signature = bs
+	}
+
+	if a := f.findSignatureAsset(file.name, ".pem", ".cert"); a != nil {
+		bs, err := f.auxiliaryFile(a)
+		if err != nil {
+			return nil, err
+		}
+		if m.certs, err = parseCertificates(bs); err != nil {
+			return nil, fmt.Errorf("%s: %w", a.Name, err)
+		}
+	}
+
+	return m, nil
+}
+
+// verifyCosign verifies the first of files that has a cosign signature
+// or Sigstore bundle published in the release.
+func (f *Filter) verifyCosign(policy *config.CosignPolicy, files []*signedFile) error {
+	for _, file := range files {
+		m, err := f.cosignMaterial(file)
+		if err != nil {
+			return err
+		}
+		if m == nil {
+			zlog.Debug().Msgf("No cosign signature found for %s", file.name)
+			continue
+		}
+
+		digest, err := sha256File(file)
+		if err != nil {
+			return err
+		}
+		if m.digest != nil && string(m.digest) != string(digest) {
+			return signatureError(file.name, "digest doesn't match the sigstore bundle")
+		}
+
+		var pub crypto.PublicKey
+		if policy.Key != "" {
+			if pub, err = loadPublicKey(policy.Key); err != nil {
+				return err
+			}
+		} else if pub, err = verifyCertificate(policy, m); err != nil {
+			return signatureError(file.name, "%v", err)
+		}
+
+		if err := verifyBlobSignature(pub, file, digest, m.signature); err != nil {
+			return signatureError(file.name, "%v", err)
+		}
+
+		zlog.Info().Msgf("Cosign signature of %s verified", file.name)
+		return nil
+	}
+
+	return fmt.Errorf("%w: the release doesn't publish a cosign signature for %s", ErrSignatureNotFound, files[0].name)
+}
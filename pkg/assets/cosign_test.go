@@ -0,0 +1,203 @@
+package assets
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dfang/bin/pkg/config"
+)
+
+const (
+	testIdentity = "https://github.com/dfang/bin/.github/workflows/release.yml@refs/tags/v0.1.0"
+	testIssuer   = "https://token.actions.githubusercontent.com"
+)
+
+// serveFiles serves the given files and returns them as release assets.
+func serveFiles(t *testing.T, files map[string][]byte) []*Asset {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bs, ok := files[filepath.Base(r.URL.Path)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(bs)
+	}))
+	t.Cleanup(srv.Close)
+
+	as := []*Asset{}
+	for name := range files {
+		as = append(as, &Asset{Name: name, BrowserDownloadURL: srv.URL + "/" + name})
+	}
+	return as
+}
+
+func writeTempFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	return writeTempFile(t, name, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}))
+}
+
+// newTestCA creates a self signed CA and a code signing certificate
+// issued by it to identity, like Fulcio does for keyless signatures.
+func newTestCA(t *testing.T, identity string) (caDER []byte, leaf *x509.Certificate, key *ecdsa.PrivateKey) {
+	t.Helper()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	issuer, _ := asn1.Marshal(testIssuer)
+	u, _ := url.Parse(identity)
+	key, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leafTmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		NotBefore:       time.Now().Add(-time.Minute),
+		NotAfter:        time.Now().Add(10 * time.Minute),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		URIs:            []*url.URL{u},
+		ExtraExtensions: []pkix.Extension{{Id: oidIssuerV2, Value: issuer}},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ = x509.ParseCertificate(leafDER)
+	return caDER, leaf, key
+}
+
+func TestVerifyCosign(t *testing.T) {
+	data := []byte("#!/bin/sh\necho bin\n")
+	digest := sha256.Sum256(data)
+	name := "bin_0.1.0_linux_amd64"
+	assetPath := writeTempFile(t, name, data)
+
+	caDER, leaf, leafKey := newTestCA(t, testIdentity)
+	leafSig, _ := ecdsa.SignASN1(rand.Reader, leafKey, digest[:])
+	leafPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})
+	trustedRoot := writePEM(t, "root.pem", "CERTIFICATE", caDER)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	keySig, _ := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	pubDER, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	pubKey := writePEM(t, "cosign.pub", "PUBLIC KEY", pubDER)
+
+	bundle, _ := json.Marshal(map[string]interface{}{
+		"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json",
+		"verificationMaterial": map[string]interface{}{
+			"certificate": map[string]string{"rawBytes": base64.StdEncoding.EncodeToString(leaf.Raw)},
+			"tlogEntries": []map[string]string{{"integratedTime": "0"}},
+		},
+		"messageSignature": map[string]interface{}{
+			"messageDigest": map[string]string{"algorithm": "SHA2_256", "digest": base64.StdEncoding.EncodeToString(digest[:])},
+			"signature":     base64.StdEncoding.EncodeToString(leafSig),
+		},
+	})
+
+	keyless := &config.CosignPolicy{Identity: testIdentity, Issuer: testIssuer, TrustedRoot: trustedRoot}
+	cases := []struct {
+		name   string
+		files  map[string][]byte
+		policy *config.CosignPolicy
+		err    error
+	}{
+		{
+			name:   "keyed signature",
+			files:  map[string][]byte{name + ".sig": []byte(base64.StdEncoding.EncodeToString(keySig))},
+			policy: &config.CosignPolicy{Key: pubKey},
+		},
+		{
+			name:   "keyed signature with another key",
+			files:  map[string][]byte{name + ".sig": []byte(base64.StdEncoding.EncodeToString(leafSig))},
+			policy: &config.CosignPolicy{Key: pubKey},
+			err:    ErrSignatureMismatch,
+		},
+		{
+			name: "keyless signature",
+			files: map[string][]byte{
+				name + ".sig": []byte(base64.StdEncoding.EncodeToString(leafSig)),
+				name + ".pem": []byte(base64.StdEncoding.EncodeToString(leafPEM)),
+			},
+			policy: keyless,
+		},
+		{
+			name: "keyless signature with identity regexp",
+			files: map[string][]byte{
+				name + ".sig": []byte(base64.StdEncoding.EncodeToString(leafSig)),
+				name + ".pem": leafPEM,
+			},
+			policy: &config.CosignPolicy{Identity: `https://github\.com/dfang/bin/.*`, IdentityRegexp: true, Issuer: testIssuer, TrustedRoot: trustedRoot},
+		},
+		{
+			name: "keyless signature from another identity",
+			files: map[string][]byte{
+				name + ".sig": []byte(base64.StdEncoding.EncodeToString(leafSig)),
+				name + ".pem": leafPEM,
+			},
+			policy: &config.CosignPolicy{Identity: "https://github.com/evil/bin/.github/workflows/release.yml@refs/tags/v0.1.0", Issuer: testIssuer, TrustedRoot: trustedRoot},
+			err:    ErrSignatureMismatch,
+		},
+		{
+			name:   "sigstore bundle",
+			files:  map[string][]byte{name + ".sigstore.json": bundle},
+			policy: keyless,
+		},
+		{
+			name:   "missing signature",
+			files:  map[string][]byte{"checksums.txt": []byte("")},
+			policy: keyless,
+			err:    ErrSignatureNotFound,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f := NewFilter(&FilterOpts{Verification: &config.Verification{Cosign: c.policy}})
+			f.assets = serveFiles(t, c.files)
+			_, err := f.verifySignatures(&FilteredAsset{Name: name}, assetPath, nil)
+			if c.err == nil && err != nil {
+				t.Fatalf("Error verifying signature: %v", err)
+			}
+			if c.err != nil && !errors.Is(err, c.err) {
+				t.Fatalf("Expected error %v, got %v", c.err, err)
+			}
+		})
+	}
+}
@@ -4,17 +4,22 @@
 package assets
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"time"
 
 	"github.com/cavaliergopher/grab/v3"
-	"github.com/cheggaaa/pb"
+	"github.com/dfang/bin/pkg/config"
+	"github.com/dfang/bin/pkg/progress"
 	zlog "github.com/rs/zerolog/log"
 )
 
@@ -62,41 +67,153 @@ func prefixAssetURL(assetURL string) string {
 	return assetURL
 }
 
-func grabAsset(url, path string) {
-	// create client
+// ErrSizeMismatch is returned when the size of the downloaded
+// asset doesn't match the size announced by the provider.
+var ErrSizeMismatch = errors.New("downloaded size mismatch")
+
+// errDownloadStalled aborts a download attempt that
+// didn't receive any data for the request timeout.
+var errDownloadStalled = errors.New("download stalled")
+
+// downloadBackoff returns how long to wait before retrying a failed download.
+var downloadBackoff = func(attempt int) time.Duration {
+	if d := time.Second << attempt; d < 30*time.Second {
+		return d
+	}
+	return 30 * time.Second
+}
+
+// retryableDownload tells if a failed download is worth retrying,
+// client errors (but timeouts and rate limits) and file system
+// errors would fail the same way again.
+func retryableDownload(err error) bool {
+	var code grab.StatusCodeError
+	if errors.As(err, &code) {
+		return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+	}
+	var pathErr *fs.PathError
+	return !errors.As(err, &pathErr)
+}
+
+// grabAsset downloads url to path with the given request headers. A partial
+// download left in the cache by a previous run is resumed and failed attempts
+// are retried with an exponential backoff. If size is known, the downloaded
+// file must have exactly that size.
+func grabAsset(url, path string, size int64, headers map[string]string) error {
+	dc := config.GetDownloadConfig()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(dc.Timeout)*time.Second)
+	defer cancel()
+
 	client := grab.NewClient()
-	// req, _ := grab.NewRequest(".", url)
-	req, _ := grab.NewRequest(path, url)
+	for attempt := 0; ; attempt++ {
+		err := downloadAttempt(ctx, client, url, path, size, headers, time.Duration(dc.RequestTimeout)*time.Second)
+		if err == nil {
+			return nil
+		}
 
-	// start download
-	fmt.Printf("Downloading %v...\n", req.URL())
-	resp := client.Do(req)
-	fmt.Printf("  %v\n", resp.HTTPResponse.Status)
+		// the cached file doesn't match the asset, it can't be resumed
+		if errors.Is(err, ErrSizeMismatch) {
+			_ = os.Remove(path)
+		}
 
-	writer := io.Discard
-	// start new bar
-	bar := pb.Full.Start64(resp.Size())
-	bar.SetRefreshRate(5 * time.Millisecond)
-	file, _ := os.Open(path)
+		if ctx.Err() != nil {
+			return fmt.Errorf("error downloading %s: timed out after %ds: %w", url, dc.Timeout, err)
+		}
+		if attempt >= *dc.Retries || !retryableDownload(err) {
+			return fmt.Errorf("error downloading %s: %w", url, err)
+		}
 
-	// create proxy reader
-	barReader := bar.NewProxyReader(file)
+		wait := downloadBackoff(attempt)
+		zlog.Warn().Err(err).Msgf("Download of %s failed, retrying in %s (%d/%d)", url, wait, attempt+1, *dc.Retries)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return fmt.Errorf("error downloading %s: timed out after %ds: %w", url, dc.Timeout, err)
+		}
+	}
+}
 
-	// copy from proxy reader
-	_, err := io.Copy(writer, barReader)
+// downloadAttempt runs a single download, aborting it if no
+// data is received for stallTimeout.
+func downloadAttempt(ctx context.Context, client *grab.Client, url, path string, size int64, headers map[string]string, stallTimeout time.Duration) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := grab.NewRequest(path, url)
 	if err != nil {
-		zlog.Error().Err(err).Msg("error when io.Copy")
+		return err
+	}
+	for name, value := range headers {
+		req.HTTPRequest.Header.Set(name, value)
 	}
+	req = req.WithContext(ctx)
+	if size > 0 {
+		req.Size = size
+	}
+
+	zlog.Debug().Msgf("Downloading %v...", req.URL())
+	resp := client.Do(req)
+
+	bar := progress.Start(filepath.Base(path), size)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	stalled := false
+	last, lastProgress := int64(-1), time.Now()
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			n := resp.BytesComplete()
+			bar.SetTotal(resp.Size())
+			bar.SetCurrent(n)
+			if n != last {
+				last, lastProgress = n, time.Now()
+			} else if time.Since(lastProgress) > stallTimeout {
+				stalled = true
+				cancel()
+			}
+		case <-resp.Done:
+			break loop
+		}
+	}
+	bar.SetTotal(resp.Size())
+	bar.SetCurrent(resp.BytesComplete())
+	bar.Finish()
 
-	// check for errors
 	if err := resp.Err(); err != nil {
-		fmt.Fprintf(os.Stderr, "Download failed: %v\n", err)
+		if stalled {
+			return fmt.Errorf("%w: no data received for %s", errDownloadStalled, stallTimeout)
+		}
+		if errors.Is(err, grab.ErrBadLength) {
+			return fmt.Errorf("%w: expected %d bytes, the server announced %d", ErrSizeMismatch, size, resp.Size())
+		}
+		return err
 	}
 
-	// finish bar
-	bar.Finish()
+	if resp.DidResume {
+		zlog.Debug().Msgf("Resumed the partial download of %s", url)
+	}
+	zlog.Debug().Msgf("Download saved to %v", resp.Filename)
+
+	return checkDownloadSize(resp.Filename, size)
+}
 
-	fmt.Printf("Download saved to %v \n", resp.Filename)
+// checkDownloadSize removes the downloaded file if its
+// size doesn't match the size announced by the provider.
+func checkDownloadSize(path string, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.Size() != size {
+		_ = os.Remove(path)
+		return fmt.Errorf("%w: expected %d bytes, got %d", ErrSizeMismatch, size, fi.Size())
+	}
+	return nil
 }
 
 // 1. skip download if file exists
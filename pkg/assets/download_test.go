@@ -0,0 +1,131 @@
+package assets
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cavaliergopher/grab/v3"
+)
+
+func TestGrabAsset(t *testing.T) {
+	downloadBackoff = func(int) time.Duration { return 0 }
+	data := bytes.Repeat([]byte("bin"), 10000)
+
+	var gets, ranges, failures int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+			return
+		case "/flaky":
+			if r.Method == http.MethodGet && atomic.AddInt32(&failures, 1) <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(&gets, 1)
+			if r.Header.Get("Range") != "" {
+				atomic.AddInt32(&ranges, 1)
+			}
+		}
+		http.ServeContent(w, r, "bin", time.Now(), bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		name    string
+		path    string
+		partial []byte
+		size    int64
+		gets    int32
+		ranges  int32
+		err     error
+	}{
+		{name: "download", path: "/bin", size: int64(len(data)), gets: 1},
+		{name: "retry server errors", path: "/flaky", size: int64(len(data)), gets: 1},
+		{name: "resume partial download", path: "/bin", partial: data[:1000], size: int64(len(data)), gets: 1, ranges: 1},
+		{name: "unknown size", path: "/bin", gets: 1},
+		{name: "size mismatch", path: "/bin", size: 42, err: ErrSizeMismatch},
+		{name: "not found", path: "/missing", size: int64(len(data)), err: grab.StatusCodeError(http.StatusNotFound)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			atomic.StoreInt32(&gets, 0)
+			atomic.StoreInt32(&ranges, 0)
+			p := filepath.Join(t.TempDir(), "bin")
+			if c.partial != nil {
+				if err := os.WriteFile(p, c.partial, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := grabAsset(srv.URL+c.path, p, c.size, nil)
+			if c.err != nil {
+				if !errors.Is(err, c.err) {
+					t.Fatalf("Expected error %v, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error downloading: %v", err)
+			}
+
+			bs, _ := os.ReadFile(p)
+			if !bytes.Equal(bs, data) {
+				t.Fatalf("Downloaded file doesn't match, got %d bytes", len(bs))
+			}
+			if g, r := atomic.LoadInt32(&gets), atomic.LoadInt32(&ranges); g != c.gets || r != c.ranges {
+				t.Fatalf("Expected %d requests and %d range requests, got %d and %d", c.gets, c.ranges, g, r)
+			}
+		})
+	}
+}
+
+func TestFetchAuxiliaryFile(t *testing.T) {
+	downloadBackoff = func(int) time.Duration { return 0 }
+	data := []byte("abc  bin\n")
+
+	var failures int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the API URL only serves authenticated requests
+		if r.URL.Path == "/api/checksums.txt" && r.Header.Get("Authorization") != "token secret" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodGet && atomic.AddInt32(&failures, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		http.ServeContent(w, r, "checksums.txt", time.Now(), bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	a := &Asset{Name: "checksums.txt", URL: srv.URL + "/api/checksums.txt", BrowserDownloadURL: srv.URL + "/download/checksums.txt"}
+	cases := []struct {
+		name    string
+		headers map[string]string
+	}{
+		{"public", nil},
+		{"private", map[string]string{"Authorization": "token secret"}},
+	}
+
+	for _, c := range cases {
+		atomic.StoreInt32(&failures, 0)
+		bs, err := fetchAuxiliaryFile(a, c.headers)
+		if err != nil {
+			t.Fatalf("Error fetching the %s checksum file: %v", c.name, err)
+		}
+		if !bytes.Equal(bs, data) {
+			t.Fatalf("Expected %q for the %s checksum file, got %q", data, c.name, bs)
+		}
+	}
+}
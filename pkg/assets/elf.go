@@ -0,0 +1,155 @@
+// elf.go
+//
+// tell real executables from scripts and docs by their ELF header, and the platform
+// they're built for by its class, machine and OS ABI, so binaries for another one
+// aren't picked from archives nor installed
+package assets
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// elfHeaderSize is the size of the start of the ELF header telling
+// the platform of the binary, up to its machine.
+const elfHeaderSize = 20
+
+// elfScore is added to the score of the archive entries which are
+// ELF binaries for the target, it beats any score given by their names.
+const elfScore = 100
+
+// elfPlatform is the class, data encoding and machine of the binaries of an architecture.
+type elfPlatform struct {
+	class   elf.Class
+	data    elf.Data
+	machine elf.Machine
+}
+
+// elfPlatforms maps the architectures, as GOARCH, to the ELF platform of their binaries.
+var elfPlatforms = map[string]elfPlatform{
+	"386":      {elf.ELFCLASS32, elf.ELFDATA2LSB, elf.EM_386},
+	"amd64":    {elf.ELFCLASS64, elf.ELFDATA2LSB, elf.EM_X86_64},
+	"arm":      {elf.ELFCLASS32, elf.ELFDATA2LSB, elf.EM_ARM},
+	"arm64":    {elf.ELFCLASS64, elf.ELFDATA2LSB, elf.EM_AARCH64},
+	"loong64":  {elf.ELFCLASS64, elf.ELFDATA2LSB, elf.EM_LOONGARCH},
+	"mips":     {elf.ELFCLASS32, elf.ELFDATA2MSB, elf.EM_MIPS},
+	"mipsle":   {elf.ELFCLASS32, elf.ELFDATA2LSB, elf.EM_MIPS},
+	"mips64":   {elf.ELFCLASS64, elf.ELFDATA2MSB, elf.EM_MIPS},
+	"mips64le": {elf.ELFCLASS64, elf.ELFDATA2LSB, elf.EM_MIPS},
+	"ppc64":    {elf.ELFCLASS64, elf.ELFDATA2MSB, elf.EM_PPC64},
+	"ppc64le":  {elf.ELFCLASS64, elf.ELFDATA2LSB, elf.EM_PPC64},
+	"riscv64":  {elf.ELFCLASS64, elf.ELFDATA2LSB, elf.EM_RISCV},
+	"s390x":    {elf.ELFCLASS64, elf.ELFDATA2MSB, elf.EM_S390},
+}
+
+// elfOSABIs maps the OS ABIs specific to an OS to the OS, as GOOS,
+// most binaries use the generic System V ABI.
+var elfOSABIs = map[elf.OSABI]string{
+	elf.ELFOSABI_LINUX:   "linux",
+	elf.ELFOSABI_FREEBSD: "freebsd",
+	elf.ELFOSABI_NETBSD:  "netbsd",
+	elf.ELFOSABI_OPENBSD: "openbsd",
+	elf.ELFOSABI_SOLARIS: "solaris",
+}
+
+// nonELFOSes are the OSes whose binaries aren't ELF files.
+var nonELFOSes = []string{"darwin", "windows"}
+
+// elfHeader is the platform an ELF binary is built for.
+type elfHeader struct {
+	elfPlatform
+	osabi elf.OSABI
+}
+
+func (h *elfHeader) String() string {
+	return fmt.Sprintf("%s %s binary (%s)", h.class, h.machine, h.osabi)
+}
+
+// parseELFHeader parses the start of the ELF header bs,
+// it returns nil if bs isn't the header of an ELF file.
+func parseELFHeader(bs []byte) *elfHeader {
+	if len(bs) < elfHeaderSize || string(bs[:4]) != elf.ELFMAG {
+		return nil
+	}
+
+	h := &elfHeader{osabi: elf.OSABI(bs[elf.EI_OSABI])}
+	h.class, h.data = elf.Class(bs[elf.EI_CLASS]), elf.Data(bs[elf.EI_DATA])
+	var order binary.ByteOrder
+	switch h.data {
+	case elf.ELFDATA2LSB:
+		order = binary.LittleEndian
+	case elf.ELFDATA2MSB:
+		order = binary.BigEndian
+	default:
+		return nil
+	}
+	if h.class != elf.ELFCLASS32 && h.class != elf.ELFCLASS64 {
+		return nil
+	}
+	h.machine = elf.Machine(order.Uint16(bs[18:]))
+	return h
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// readHeader reads the start of the file r, enough
+// to tell if it's an ELF binary and its platform.
+func readHeader(r io.Reader) []byte {
+	bs := make([]byte, elfHeaderSize)
+	n, _ := io.ReadFull(r, bs)
+	return bs[:n]
+}
+
+// checkTarget checks the binary runs on goos/goarch, unknown
+// platforms are accepted since there's nothing to check them against.
+func (h *elfHeader) checkTarget(goos, goarch string) error {
+	if contains(nonELFOSes, goos) {
+		return fmt.Errorf("%s can't run on %s", h, goos)
+	}
+	if abiOS, ok := elfOSABIs[h.osabi]; ok && abiOS != goos {
+		return fmt.Errorf("%s is built for %s, not %s", h, abiOS, goos)
+	}
+	if p, ok := elfPlatforms[goarch]; ok && p != h.elfPlatform {
+		return fmt.Errorf("%s is built for another architecture than %s", h, goarch)
+	}
+	return nil
+}
+
+// target returns the OS and the architecture binaries are installed for.
+func target(r platformResolver) (string, string) {
+	goos, goarch := "", ""
+	if oses := r.GetOS(); len(oses) > 0 {
+		goos = oses[0]
+	}
+	if arch := r.GetArch(); len(arch) > 0 {
+		goarch = arch[0]
+	}
+	return goos, goarch
+}
+
+// checkBinary refuses the file at p if it's an ELF binary built for another
+// platform than the target one, other files can't be checked.
+func checkBinary(r platformResolver, p, name string) error {
+	file, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	h := parseELFHeader(readHeader(file))
+	if h == nil {
+		return nil
+	}
+	if err := h.checkTarget(target(r)); err != nil {
+		return fmt.Errorf("refusing to install %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package assets
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// elfBinary returns the start of an ELF binary for the platform.
+func elfBinary(p elfPlatform, osabi elf.OSABI) []byte {
+	bs := make([]byte, 64)
+	copy(bs, elf.ELFMAG)
+	bs[elf.EI_CLASS], bs[elf.EI_DATA], bs[elf.EI_VERSION], bs[elf.EI_OSABI] = byte(p.class), byte(p.data), byte(elf.EV_CURRENT), byte(osabi)
+	var order binary.ByteOrder = binary.LittleEndian
+	if p.data == elf.ELFDATA2MSB {
+		order = binary.BigEndian
+	}
+	order.PutUint16(bs[16:], uint16(elf.ET_EXEC))
+	order.PutUint16(bs[18:], uint16(p.machine))
+	return bs
+}
+
+func TestCheckTarget(t *testing.T) {
+	cases := []struct {
+		binary []byte
+		goos   string
+		goarch string
+		ok     bool
+	}{
+		{elfBinary(elfPlatforms["amd64"], elf.ELFOSABI_NONE), "linux", "amd64", true},
+		{elfBinary(elfPlatforms["amd64"], elf.ELFOSABI_LINUX), "linux", "amd64", true},
+		{elfBinary(elfPlatforms["arm64"], elf.ELFOSABI_NONE), "linux", "amd64", false},
+		{elfBinary(elfPlatforms["386"], elf.ELFOSABI_NONE), "linux", "amd64", false},
+		{elfBinary(elfPlatforms["ppc64"], elf.ELFOSABI_NONE), "linux", "ppc64le", false},
+		{elfBinary(elfPlatforms["amd64"], elf.ELFOSABI_FREEBSD), "linux", "amd64", false},
+		{elfBinary(elfPlatforms["amd64"], elf.ELFOSABI_FREEBSD), "freebsd", "amd64", true},
+		{elfBinary(elfPlatforms["arm64"], elf.ELFOSABI_NONE), "darwin", "arm64", false},
+		// there's nothing to check unknown architectures against
+		{elfBinary(elfPlatforms["riscv64"], elf.ELFOSABI_NONE), "linux", "sparc64", true},
+	}
+
+	for _, c := range cases {
+		h := parseELFHeader(c.binary)
+		if h == nil {
+			t.Fatalf("Expected %q to be parsed", c.binary[:elfHeaderSize])
+		}
+		if err := h.checkTarget(c.goos, c.goarch); (err == nil) != c.ok {
+			t.Errorf("Expected %s on %s/%s to be ok: %v, got %v", h, c.goos, c.goarch, c.ok, err)
+		}
+	}
+
+	for _, bs := range [][]byte{nil, []byte("\x7fELF binary"), []byte("#!/bin/sh\necho not an ELF binary\n")} {
+		if h := parseELFHeader(bs); h != nil {
+			t.Errorf("Expected %q not to be parsed, got %s", bs, h)
+		}
+	}
+}
+
+func TestProcessFileELF(t *testing.T) {
+	resolver = testLinuxAMDResolver
+	amd64 := elfBinary(elfPlatforms["amd64"], elf.ELFOSABI_NONE)
+	arm64 := elfBinary(elfPlatforms["arm64"], elf.ELFOSABI_NONE)
+
+	cases := []struct {
+		repo  string
+		name  string
+		data  []byte
+		out   string
+		error string
+	}{
+		// the names of the scripts are as good as the binary's
+		{"bat", "bat.tar.gz", tarGz(t, map[string][]byte{
+			"bat/bat":                        amd64,
+			"bat/autocomplete/bat.bash":      []byte("#!/bin/bash\ncomplete -F _bat bat\n"),
+			"bat/autocomplete/bat.zsh":       []byte("#compdef bat\n"),
+			"bat/assets/bat-linux-amd64.txt": []byte("bat"),
+		}), "bat/bat", ""},
+		// the binary isn't named after the repository
+		{"ripgrep", "ripgrep.zip", zipArchive(t, map[string][]byte{
+			"rg":        amd64,
+			"README.md": []byte("# ripgrep"),
+			"doc/rg.1":  []byte(".TH RG 1"),
+		}), "rg", ""},
+		// the binary for another architecture is never picked
+		{"tool", "tool.tar.gz", tarGz(t, map[string][]byte{
+			"tool-arm64/tool": arm64,
+			"tool-amd64/tool": amd64,
+		}), "tool-amd64/tool", ""},
+		{"tool", "tool.tar.gz", tarGz(t, map[string][]byte{
+			"tool/tool": arm64,
+		}), "", "refusing to install tool"},
+		{"tool", "tool-linux-amd64", arm64, "", "refusing to install tool-linux-amd64"},
+		// the 7z fixture only has room for the start of the binaries
+		{"tool", "tool.7z", sevenZip(t, []string{"arm/tool", "x86/tool"}, map[string][]byte{
+			"arm/tool": arm64[:elfHeaderSize],
+			"x86/tool": amd64[:elfHeaderSize],
+		}), "x86/tool", ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("TMPDIR", dir)
+			p := filepath.Join(dir, c.name)
+			if err := os.WriteFile(p, c.data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			f := InitFilter(c.repo, c.name, "", &FilterOpts{})
+			out, err := f.processFile(p, false)
+			if c.error != "" {
+				if err == nil || !strings.Contains(err.Error(), c.error) {
+					t.Fatalf("Expected error %q, got %v", c.error, err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Error processing %s: %v", c.name, err)
+				}
+				if out.PackagePath != c.out {
+					t.Fatalf("Expected %s, got %s", c.out, out.PackagePath)
+				}
+				closeFinalFiles([]*finalFile{out})
+			}
+
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != 1 {
+				t.Fatalf("Expected temporary files to be removed, found %d files", len(entries))
+			}
+		})
+	}
+}
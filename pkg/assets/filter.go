@@ -5,11 +5,14 @@ package assets
 
 import (
 	"fmt"
-	"runtime"
+	"os"
+	"regexp"
 	"sort"
 	"strings"
 
 	"github.com/apex/log"
+	"github.com/dfang/bin/pkg/cache"
+	"github.com/dfang/bin/pkg/config"
 	"github.com/dfang/bin/pkg/options"
 	bstrings "github.com/dfang/bin/pkg/strings"
 	zlog "github.com/rs/zerolog/log"
@@ -36,6 +39,19 @@ type Filter struct {
 	repoName    string
 	name        string
 	packagePath string
+	mode        os.FileMode
+
+	// assets are all the assets of the release, including the
+	// ones not considered for download like checksum files
+	assets []*Asset
+	// headers are sent along the requests of the release files, e.g. the
+	// auth token of private repositories, see FilteredAsset.ExtraHeaders
+	headers map[string]string
+	// checksumFile is the checksum file the downloaded asset was validated against
+	checksumFile *signedFile
+	// executablesOnly only lists the executable entries of the
+	// archives, set when unpacking the payload of deb and rpm packages
+	executablesOnly bool
 }
 
 type FilterOpts struct {
@@ -46,6 +62,43 @@ type FilterOpts struct {
 	// variable to filter the resulting outputs. This is very useful
 	// so we don't prompt the user to pick the file again on updates
 	PackagePath string
+	// Pick selects the files of the archive matching these globs (or
+	// paths) rather than a single binary, every glob has to match
+	Pick []string
+	// PickMany prompts to select several files of the archive
+	PickMany bool
+	// Companions extracts the shell completions and
+	// man pages of the archive along with the binary
+	Companions bool
+
+	// RequireChecksum fails the download if the release doesn't
+	// publish a checksum for the selected asset
+	RequireChecksum bool
+	// SkipChecksum skips the validation of the downloaded asset
+	SkipChecksum bool
+
+	// Platform is the platform the binary is installed for,
+	// nil for the one bin runs on
+	Platform *config.Platform
+
+	// Rules are the user defined asset selection rules of the binary
+	Rules *config.AssetRules
+	// AssetTemplate is the asset the user selected previously, with
+	// the version replaced, see FilteredAsset.Template. It selects the
+	// asset among the ones with the highest score without prompting
+	AssetTemplate string
+
+	// Verification is the signature verification policy of the binary
+	Verification *config.Verification
+	// Attestations returns the attestation bundles published by the
+	// provider for an asset sha256 digest, if the provider supports them
+	Attestations func(digest string) ([][]byte, error)
+
+	// CacheKey identifies the release in the download cache,
+	// the asset name is set once the asset is selected
+	CacheKey cache.Key
+	// Offline only uses the assets available in the download cache
+	Offline bool
 }
 
 func InitFilter(repoName, name, packagePath string, opts *FilterOpts) *Filter {
@@ -61,6 +114,14 @@ func NewFilter(opts *FilterOpts) *Filter {
 	return &Filter{opts: opts}
 }
 
+// platform resolves the platform the binary is installed for.
+func (f *Filter) platform() platformResolver {
+	if f.opts.Platform != nil {
+		return targetResolver{platform: f.opts.Platform}
+	}
+	return resolver
+}
+
 func (g FilteredAsset) String() string {
 	if g.DisplayName != "" {
 		return g.DisplayName
@@ -72,6 +133,28 @@ func (g FilteredAsset) String() string {
 // select the proper one and ask the user to manually select one
 // in case it can't determine it.
 func (f *Filter) FilterAssets(repoName string, as []*Asset) (*FilteredAsset, error) {
+	f.assets = as
+	as, err := applyRules(downloadCandidates(as), f.opts.Rules)
+	if err != nil {
+		return nil, err
+	}
+	if f.opts.Offline {
+		as = f.cachedCandidates(as)
+		if len(as) == 0 {
+			return nil, fmt.Errorf("no asset of %s %s: %w", f.cacheKey("").Repo, f.opts.CacheKey.Version, cache.ErrNotCached)
+		}
+	}
+
+	// the asset selected previously is kept, scoring
+	// could prefer another one of the new release
+	version := f.opts.CacheKey.Version
+	if a := matchTemplate(as, f.opts.AssetTemplate, version); a != nil {
+		zlog.Info().Msgf("Selected %s, it matches the asset selected previously", a.Name)
+		return &FilteredAsset{RepoName: repoName, Name: a.Name, DisplayName: a.DisplayName, URL: a.URL, Size: a.Size, BrowserDownloadURL: a.BrowserDownloadURL, Template: f.opts.AssetTemplate}, nil
+	} else if f.opts.AssetTemplate != "" {
+		log.Warnf("No asset matches %s, selected previously, anymore", f.opts.AssetTemplate)
+	}
+
 	matches := []*FilteredAsset{}
 	if len(as) == 1 {
 		a := as[0]
@@ -81,44 +164,70 @@ func (f *Filter) FilterAssets(repoName string, as []*Asset) (*FilteredAsset, err
 			scores := map[string]int{}
 			scoreKeys := []string{}
 			scores[repoName] = 1
-			for _, os := range resolver.GetOS() {
+			r := f.platform()
+			for _, os := range r.GetOS() {
 				scores[os] = 10
 			}
-			for _, arch := range resolver.GetArch() {
+			for _, arch := range r.GetArch() {
 				scores[arch] = 5
 			}
-			for _, osSpecificExtension := range resolver.GetOSSpecificExtensions() {
+			for _, osSpecificExtension := range r.GetOSSpecificExtensions() {
 				scores[osSpecificExtension] = 15
 			}
+			if f.opts.Rules != nil {
+				for key, weight := range f.opts.Rules.Weights {
+					scores[strings.ToLower(key)] = weight
+				}
+			}
 
 			for key := range scores {
 				scoreKeys = append(scoreKeys, strings.ToLower(key))
 			}
 
-			zlog.Debug().Str("GOOS", runtime.GOOS).Str("GOARCH", runtime.GOARCH).Msg("Guess the proper asset to be downloaded based on the target system info")
+			goos, goarch := target(r)
+			zlog.Debug().Str("GOOS", goos).Str("GOARCH", goarch).Msg("Guess the proper asset to be downloaded based on the target system info")
 
-			for _, a := range as {
-				highestScoreForAsset := 0
-				gf := &FilteredAsset{RepoName: repoName, Name: a.Name, DisplayName: a.DisplayName, URL: a.URL, score: 0, Size: a.Size, BrowserDownloadURL: a.BrowserDownloadURL}
-				for _, candidate := range []string{a.Name} {
-					candidateScore := 0
-					if bstrings.ContainsAny(strings.ToLower(candidate), scoreKeys) &&
-						isSupportedExt(candidate) {
-						for toMatch, score := range scores {
-							if strings.Contains(strings.ToLower(candidate), strings.ToLower(toMatch)) {
-								candidateScore += score
+			scoreAssets := func(supported func(string) bool) []*FilteredAsset {
+				res := []*FilteredAsset{}
+				for _, a := range as {
+					highestScoreForAsset := 0
+					gf := &FilteredAsset{RepoName: repoName, Name: a.Name, DisplayName: a.DisplayName, URL: a.URL, score: 0, Size: a.Size, BrowserDownloadURL: a.BrowserDownloadURL}
+					for _, candidate := range []string{a.Name} {
+						candidateScore := 0
+						name, foreign := stripForeignArch(r, candidate)
+						if bstrings.ContainsAny(name, scoreKeys) && supported(candidate) &&
+							!forForeignArch(r, name, foreign) {
+							for toMatch, score := range scores {
+								if strings.Contains(name, strings.ToLower(toMatch)) {
+									candidateScore += score
+								}
+							}
+							if candidateScore > highestScoreForAsset {
+								highestScoreForAsset = candidateScore
+								gf.Name = candidate
+								gf.score = candidateScore
 							}
 						}
-						if candidateScore > highestScoreForAsset {
-							highestScoreForAsset = candidateScore
-							gf.Name = candidate
-							gf.score = candidateScore
-						}
+					}
+
+					if highestScoreForAsset > 0 {
+						res = append(res, gf)
 					}
 				}
+				return res
+			}
 
-				if highestScoreForAsset > 0 {
-					matches = append(matches, gf)
+			matches = scoreAssets(isSupportedExt)
+			if targetsLinux(r) && !anyForOS(r, matches) {
+				// some projects only publish their linux binaries as packages
+				zlog.Debug().Msg("No binary or archive found for the OS, looking for deb and rpm packages")
+				if packages := scoreAssets(isPackageExt); len(packages) > 0 {
+					matches = packages
+				}
+			}
+			if l := r.GetLibc(); l != nil && targetsLinux(r) {
+				for _, m := range matches {
+					m.score = l.score(m.Name, m.score)
 				}
 			}
 			highestAssetScore := 0
@@ -187,7 +296,7 @@ func (f *Filter) FilterAssets(repoName string, as []*Asset) (*FilteredAsset, err
 			return nil, err
 		}
 		gf = choice.(*FilteredAsset)
-		// TODO make user select the proper file
+		gf.Template = assetTemplate(gf.Name, version)
 	} else {
 		gf = matches[0]
 	}
@@ -195,6 +304,98 @@ func (f *Filter) FilterAssets(repoName string, as []*Asset) (*FilteredAsset, err
 	return gf, nil
 }
 
+// versionPlaceholder replaces the release version in asset templates.
+const versionPlaceholder = "{version}"
+
+// assetTemplate returns the name of the asset of the release version
+// with the version replaced, e.g. tool-{version}-linux-amd64.tar.gz,
+// so the asset can be selected again in the next releases.
+func assetTemplate(name, version string) string {
+	return ReplaceVersion(name, version, versionPlaceholder)
+}
+
+// matchTemplate returns the asset named after template for
+// the release version, nil if there's none.
+func matchTemplate(as []*Asset, template, version string) *Asset {
+	if template == "" {
+		return nil
+	}
+	name := strings.ReplaceAll(template, versionPlaceholder, strings.TrimPrefix(version, "v"))
+	for _, a := range as {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// downloadCandidates removes checksum and signature files from the release
+// assets, they're only used to validate the selected asset.
+func downloadCandidates(as []*Asset) []*Asset {
+	res := make([]*Asset, 0, len(as))
+	for _, a := range as {
+		if isChecksumFile(a.Name) || isSignatureFile(a.Name) {
+			continue
+		}
+		res = append(res, a)
+	}
+	return res
+}
+
+// applyRules keeps the assets whose name matches one of the include
+// patterns of rules, if any, and none of the exclude ones.
+func applyRules(as []*Asset, rules *config.AssetRules) ([]*Asset, error) {
+	if rules == nil || len(rules.Include) == 0 && len(rules.Exclude) == 0 {
+		return as, nil
+	}
+	include, err := compileRules(rules.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compileRules(rules.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*Asset, 0, len(as))
+	for _, a := range as {
+		if len(include) > 0 && !matchesAny(include, a.Name) {
+			zlog.Debug().Msgf("Skipping %s, it matches no include rule", a.Name)
+			continue
+		}
+		if matchesAny(exclude, a.Name) {
+			zlog.Debug().Msgf("Skipping %s, it matches an exclude rule", a.Name)
+			continue
+		}
+		res = append(res, a)
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("no asset matches the asset rules (include %q, exclude %q)", rules.Include, rules.Exclude)
+	}
+	return res, nil
+}
+
+func compileRules(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid asset rule %q: %w", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func matchesAny(res []*regexp.Regexp, name string) bool {
+	for _, re := range res {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
 // nolint: unused
 // filterBySize: keep the smallest size one for assets with same scores, eg. jdxcode/rtx.
 func filterBySize(assets []*FilteredAsset) ([]*FilteredAsset, error) {
@@ -0,0 +1,142 @@
+// gpg.go
+//
+// verify OpenPGP detached signatures (<asset>.asc, <asset>.gpg) with the keys of a local
+// keyring directory, the signing key must match the fingerprint pinned for the binary
+package assets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/dfang/bin/pkg/config"
+	zlog "github.com/rs/zerolog/log"
+)
+
+// NormalizeFingerprint removes the formatting gpg uses when printing
+// fingerprints (spaces, 0x prefix, lowercase) so they can be compared.
+func NormalizeFingerprint(fp string) string {
+	fp = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(fp), "0x"), "0X")
+	return strings.ToUpper(strings.ReplaceAll(fp, " ", ""))
+}
+
+// loadKeyring reads every armored or binary public key found in dir.
+func loadKeyring(dir string) (openpgp.EntityList, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading keyring directory: %w", err)
+	}
+
+	keyring := openpgp.EntityList{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		p := filepath.Join(dir, e.Name())
+		bs, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+
+		el, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(bs))
+		if err != nil {
+			el, err = openpgp.ReadKeyRing(bytes.NewReader(bs))
+		}
+		if err != nil {
+			zlog.Debug().Err(err).Msgf("Skipping %s, not an OpenPGP key", p)
+			continue
+		}
+		keyring = append(keyring, el...)
+	}
+	return keyring, nil
+}
+
+// signatureIssuer returns the key id of the signature issuer, used
+// to report which key signed a release we don't have the key of.
+func signatureIssuer(sig []byte) string {
+	r := io.Reader(bytes.NewReader(sig))
+	if block, err := armor.Decode(bytes.NewReader(sig)); err == nil {
+		r = block.Body
+	}
+	p, err := packet.Read(r)
+	if err != nil {
+		return "unknown"
+	}
+	if s, ok := p.(*packet.Signature); ok && s.IssuerKeyId != nil {
+		return fmt.Sprintf("%016X", *s.IssuerKeyId)
+	}
+	return "unknown"
+}
+
+// checkGPGSignature verifies sig over file and returns the fingerprint
+// of the primary key of the signer.
+func checkGPGSignature(keyring openpgp.EntityList, file *signedFile, sig []byte) (string, error) {
+	r, err := file.open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	var signer *openpgp.Entity
+	if bytes.HasPrefix(bytes.TrimSpace(sig), []byte("-----BEGIN")) {
+		signer, err = openpgp.CheckArmoredDetachedSignature(keyring, r, bytes.NewReader(sig), nil)
+	} else {
+		signer, err = openpgp.CheckDetachedSignature(keyring, r, bytes.NewReader(sig), nil)
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint), nil
+}
+
+// verifyGPG verifies the first of files with an OpenPGP signature published in the
+// release. A signature made by any other key than the pinned one is reported as a
+// key change so updates don't silently switch to a different signer.
+func (f *Filter) verifyGPG(policy *config.GPGPolicy, files []*signedFile) error {
+	pinned := NormalizeFingerprint(policy.Fingerprint)
+	dir := policy.Keyring
+	if dir == "" {
+		dir = config.GetKeyringDir()
+	}
+	keyring, err := loadKeyring(os.ExpandEnv(dir))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		a := f.findSignatureAsset(file.name, ".asc", ".gpg")
+		if a == nil {
+			zlog.Debug().Msgf("No OpenPGP signature found for %s", file.name)
+			continue
+		}
+		sig, err := f.auxiliaryFile(a)
+		if err != nil {
+			return err
+		}
+
+		fp, err := checkGPGSignature(keyring, file, sig)
+		if errors.Is(err, pgperrors.ErrUnknownIssuer) {
+			return signatureError(file.name, "%s was made by key %s which is not in the keyring %s, the pinned key is %s. The signing key may have changed",
+				a.Name, signatureIssuer(sig), dir, pinned)
+		} else if err != nil {
+			return signatureError(file.name, "%s: %v", a.Name, err)
+		}
+
+		if fp != pinned {
+			return signatureError(file.name, "signing key changed, %s was made by %s but the pinned key is %s", a.Name, fp, pinned)
+		}
+
+		zlog.Info().Msgf("OpenPGP signature of %s verified with key %s", file.name, fp)
+		return nil
+	}
+
+	return fmt.Errorf("%w: the release doesn't publish an OpenPGP signature for %s", ErrSignatureNotFound, files[0].name)
+}
@@ -0,0 +1,124 @@
+package assets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/dfang/bin/pkg/config"
+)
+
+func newTestEntity(t *testing.T, name string) *openpgp.Entity {
+	t.Helper()
+	e, err := openpgp.NewEntity(name, "", name+"@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func exportPublicKey(t *testing.T, dir string, e *openpgp.Entity) {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	name := fmt.Sprintf("%X.asc", e.PrimaryKey.Fingerprint)
+	if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func armoredSignature(t *testing.T, e *openpgp.Entity, data []byte) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	if err := openpgp.ArmoredDetachSign(buf, e, bytes.NewReader(data), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestVerifyGPG(t *testing.T) {
+	data := []byte("#!/bin/sh\necho cura\n")
+	name := "Ultimaker_Cura-4.7.1.AppImage"
+	assetPath := writeTempFile(t, name, data)
+
+	pinned := newTestEntity(t, "pinned")
+	rotated := newTestEntity(t, "rotated")
+	unknown := newTestEntity(t, "unknown")
+
+	keyring := t.TempDir()
+	exportPublicKey(t, keyring, pinned)
+	exportPublicKey(t, keyring, rotated)
+
+	fingerprint := fmt.Sprintf("%X", pinned.PrimaryKey.Fingerprint)
+	policy := &config.GPGPolicy{Fingerprint: fingerprint, Keyring: keyring}
+
+	cases := []struct {
+		name   string
+		files  map[string][]byte
+		err    error
+		errMsg string
+	}{
+		{
+			name:  "signed with the pinned key",
+			files: map[string][]byte{name + ".asc": armoredSignature(t, pinned, data)},
+		},
+		{
+			name:   "signed with another key of the keyring",
+			files:  map[string][]byte{name + ".asc": armoredSignature(t, rotated, data)},
+			err:    ErrSignatureMismatch,
+			errMsg: "signing key changed",
+		},
+		{
+			name:   "signed with a key missing from the keyring",
+			files:  map[string][]byte{name + ".asc": armoredSignature(t, unknown, data)},
+			err:    ErrSignatureMismatch,
+			errMsg: "may have changed",
+		},
+		{
+			name:  "signature of other content",
+			files: map[string][]byte{name + ".asc": armoredSignature(t, pinned, []byte("other"))},
+			err:   ErrSignatureMismatch,
+		},
+		{
+			name:  "unsigned",
+			files: map[string][]byte{name + ".sha256": []byte("")},
+			err:   ErrSignatureNotFound,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f := NewFilter(&FilterOpts{Verification: &config.Verification{GPG: policy}})
+			f.assets = serveFiles(t, c.files)
+			_, err := f.verifySignatures(&FilteredAsset{Name: name}, assetPath, nil)
+			if c.err == nil && err != nil {
+				t.Fatalf("Error verifying signature: %v", err)
+			}
+			if c.err != nil && !errors.Is(err, c.err) {
+				t.Fatalf("Expected error %v, got %v", c.err, err)
+			}
+			if c.errMsg != "" && !strings.Contains(err.Error(), c.errMsg) {
+				t.Fatalf("Expected error to contain %q, got %v", c.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestNormalizeFingerprint(t *testing.T) {
+	if e, a := "4AEE18F83AFDEB23", NormalizeFingerprint("0x4aee 18f8 3afd eb23"); e != a {
+		t.Fatalf("Expected %s, got %s", e, a)
+	}
+}
@@ -0,0 +1,236 @@
+// libc.go
+//
+// binaries linked against glibc only run on hosts with the glibc version they require, and
+// not at all on musl hosts like Alpine. The assets built for the libc of the host are preferred,
+// and a musl or static asset is installed instead when the selected binary can't run
+package assets
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/hashicorp/go-version"
+	zlog "github.com/rs/zerolog/log"
+)
+
+const (
+	gnu  = "gnu"
+	musl = "musl"
+)
+
+// libcScore is added to the score of the assets built for the libc of the host.
+const libcScore = 2
+
+var (
+	// glibcPaths are the usual locations of the glibc shared library
+	glibcPaths = []string{
+		"/lib64/libc.so.6",
+		"/lib/libc.so.6",
+		"/lib/*-linux-gnu*/libc.so.6",
+		"/usr/lib64/libc.so.6",
+		"/usr/lib/libc.so.6",
+		"/usr/lib/*-linux-gnu*/libc.so.6",
+	}
+	// glibcRelease is the version in the banner of the glibc shared library,
+	// e.g. GNU C Library (Debian GLIBC 2.36-9) stable release version 2.36.
+	glibcRelease = regexp.MustCompile(`GNU C Library .* release version (\d+\.\d+)`)
+	// muslLoaders is the dynamic loader of musl hosts, it's
+	// named after the architecture, e.g. ld-musl-x86_64.so.1
+	muslLoaders = "/lib/ld-musl-*.so.1"
+)
+
+// libc is the C library of a Linux host.
+type libc struct {
+	// flavour is either gnu (glibc) or musl
+	flavour string
+	// version is the version of glibc, e.g. 2.36
+	version string
+}
+
+func (l *libc) String() string {
+	if l.version == "" {
+		return l.flavour
+	}
+	return l.flavour + " " + l.version
+}
+
+var (
+	hostLibcOnce sync.Once
+	hostLibc     *libc
+)
+
+// detectLibc returns the libc of the host, nil if it's not Linux or if it can't
+// be found. glibc is looked for first since its hosts may have musl installed too.
+func detectLibc() *libc {
+	hostLibcOnce.Do(func() {
+		if runtime.GOOS != "linux" {
+			return
+		}
+		for _, pattern := range glibcPaths {
+			matches, _ := filepath.Glob(pattern)
+			for _, p := range matches {
+				bs, err := os.ReadFile(p)
+				if err != nil {
+					continue
+				}
+				if m := glibcRelease.FindSubmatch(bs); m != nil {
+					hostLibc = &libc{flavour: gnu, version: string(m[1])}
+					return
+				}
+			}
+		}
+		if matches, _ := filepath.Glob(muslLoaders); len(matches) > 0 {
+			hostLibc = &libc{flavour: musl}
+		}
+	})
+	return hostLibc
+}
+
+// nameTokens splits the name of an asset into its words, e.g.
+// rg-x86_64-unknown-linux-musl.tar.gz into rg, x86, 64, unknown...
+func nameTokens(name string) []string {
+	return strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// libcOf returns the libc the asset name is built for, or "" if it
+// doesn't tell. arm assets are e.g. linux-gnueabihf or linux-musleabihf.
+func libcOf(name string) string {
+	for _, token := range nameTokens(name) {
+		switch {
+		case strings.HasPrefix(token, musl):
+			return musl
+		case strings.HasPrefix(token, gnu), strings.HasPrefix(token, "glibc"):
+			return gnu
+		}
+	}
+	return ""
+}
+
+// isStatic checks if the asset name tells it's statically linked.
+func isStatic(name string) bool {
+	return contains(nameTokens(name), "static")
+}
+
+// score adjusts the score of the asset name for the libc of the host: the
+// assets built for it are preferred, and the glibc ones never run on musl.
+func (l *libc) score(name string, score int) int {
+	switch flavour := libcOf(name); {
+	case flavour == l.flavour:
+		return score + libcScore
+	case flavour == gnu && l.flavour == musl:
+		return 0
+	case flavour == "" && isStatic(name) && l.flavour == musl:
+		return score + 1
+	}
+	return score
+}
+
+// checkLibc checks the ELF binary at p can run with the libc of the host. Binaries
+// which aren't linked against glibc, like static and musl ones, run on any host.
+func checkLibc(r platformResolver, p string) error {
+	l := r.GetLibc()
+	if l == nil {
+		return nil
+	}
+
+	file, err := elf.Open(p)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	libs, err := file.ImportedLibraries()
+	if err != nil || !contains(libs, "libc.so.6") {
+		return nil
+	}
+	if l.flavour == musl {
+		return fmt.Errorf("it's linked against glibc and the host uses musl")
+	}
+
+	host, err := version.NewVersion(l.version)
+	if err != nil {
+		return nil
+	}
+	// the symbols are versioned with the glibc release which introduced them, e.g. GLIBC_2.34
+	symbols, _ := file.ImportedSymbols()
+	for _, s := range symbols {
+		v, err := version.NewVersion(strings.TrimPrefix(s.Version, "GLIBC_"))
+		if err != nil || !strings.HasPrefix(s.Version, "GLIBC_") {
+			continue
+		}
+		if v.GreaterThan(host) {
+			return fmt.Errorf("it requires %s (%s) and the host has glibc %s", s.Version, s.Name, l.version)
+		}
+	}
+	return nil
+}
+
+// unrunnable returns the first of the binary out and the other binaries picked
+// with it which can't run with the libc of the host, nil if they all can.
+func (out *finalFile) unrunnable() *finalFile {
+	for _, o := range append([]*finalFile{out}, out.Others...) {
+		if o.libcErr != nil {
+			return o
+		}
+	}
+	return nil
+}
+
+// libcFallback replaces out, the binaries of gf which can't run with the libc of the
+// host, with the binaries of a musl or static asset of the release if there's one.
+// out is installed anyway, with a warning, otherwise.
+func (f *Filter) libcFallback(gf *FilteredAsset, out *finalFile) *finalFile {
+	bad := out.unrunnable()
+	zlog.Warn().Msgf("%s may not run on this host, %v", bad.Name, bad.libcErr)
+
+	candidates := []*Asset{}
+	for _, a := range downloadCandidates(f.assets) {
+		if a.Name != gf.Name && (libcOf(a.Name) == musl || isStatic(a.Name)) {
+			candidates = append(candidates, a)
+		}
+	}
+	if len(candidates) == 0 {
+		return out
+	}
+
+	// the fallback asset is laid out differently, e.g. in a
+	// tool-x86_64-unknown-linux-musl folder rather than -gnu
+	opts := *f.opts
+	opts.PackagePath = ""
+	g := *f
+	g.opts = &opts
+	fallback, err := g.FilterAssets(gf.RepoName, candidates)
+	if err != nil {
+		zlog.Warn().Msgf("No musl or static asset to fall back to: %v", err)
+		return out
+	}
+	g.assets = f.assets
+	fallback.ExtraHeaders = gf.ExtraHeaders
+
+	zlog.Info().Msgf("Falling back to %s", fallback.Name)
+	fout, err := g.ProcessURL(fallback)
+	if err != nil {
+		zlog.Warn().Msgf("Error falling back to %s: %v", fallback.Name, err)
+		return out
+	}
+	if fout.unrunnable() != nil {
+		closeFinalFiles(append([]*finalFile{fout}, fout.Others...))
+		return out
+	}
+	// the asset selected previously is replaced with the fallback,
+	// so the next releases don't select it again
+	if fout.AssetTemplate == "" && gf.Template != "" {
+		fout.AssetTemplate = assetTemplate(fallback.Name, f.opts.CacheKey.Version)
+	}
+	closeFinalFiles(append([]*finalFile{out}, out.Others...))
+	return fout
+}
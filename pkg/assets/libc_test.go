@@ -0,0 +1,167 @@
+package assets
+
+import (
+	"bytes"
+	"debug/elf"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dfang/bin/pkg/cache"
+)
+
+func TestLibcOf(t *testing.T) {
+	cases := []struct {
+		in     string
+		libc   string
+		static bool
+	}{
+		{"ripgrep-14.1.0-x86_64-unknown-linux-musl.tar.gz", musl, false},
+		{"ripgrep-14.1.0-x86_64-unknown-linux-gnu.tar.gz", gnu, false},
+		{"ripgrep-14.1.0-arm-unknown-linux-gnueabihf.tar.gz", gnu, false},
+		{"ripgrep-14.1.0-arm-unknown-linux-musleabihf.tar.gz", musl, false},
+		{"tool_linux_amd64_glibc2.17.tar.gz", gnu, false},
+		{"tool_linux_amd64_static.tar.gz", "", true},
+		{"air_1.44.0_linux_amd64.tar.gz", "", false},
+	}
+
+	for _, c := range cases {
+		if l := libcOf(c.in); l != c.libc {
+			t.Errorf("Expected %s to be built for %q, got %q", c.in, c.libc, l)
+		}
+		if s := isStatic(c.in); s != c.static {
+			t.Errorf("Expected %s to be static: %v, got %v", c.in, c.static, s)
+		}
+	}
+}
+
+func TestFilterAssetsLibc(t *testing.T) {
+	as := []*Asset{
+		{Name: "ripgrep-14.1.0-x86_64-apple-darwin.tar.gz"},
+		{Name: "ripgrep-14.1.0-x86_64-unknown-linux-gnu.tar.gz"},
+		{Name: "ripgrep-14.1.0-x86_64-unknown-linux-musl.tar.gz"},
+	}
+	static := []*Asset{
+		{Name: "tool_linux_amd64.tar.gz"},
+		{Name: "tool_linux_amd64_static.tar.gz"},
+	}
+
+	cases := []struct {
+		as   []*Asset
+		libc *libc
+		out  string
+	}{
+		{as, &libc{flavour: gnu, version: "2.36"}, "ripgrep-14.1.0-x86_64-unknown-linux-gnu.tar.gz"},
+		{as, &libc{flavour: musl}, "ripgrep-14.1.0-x86_64-unknown-linux-musl.tar.gz"},
+		{static, &libc{flavour: musl}, "tool_linux_amd64_static.tar.gz"},
+	}
+
+	for _, c := range cases {
+		resolver = &mockOSResolver{OS: []string{"linux"}, Arch: []string{"amd64", "x86_64", "x64", "64"}, Libc: c.libc}
+		f := NewFilter(&FilterOpts{})
+		gf, err := f.FilterAssets("ripgrep", c.as)
+		if err != nil {
+			t.Fatalf("Error filtering assets on %s: %v", c.libc, err)
+		}
+		if gf.Name != c.out {
+			t.Fatalf("Expected %s on %s, got %s", c.out, c.libc, gf.Name)
+		}
+	}
+}
+
+func TestCheckLibc(t *testing.T) {
+	// any binary of the host linked against glibc with versioned symbols
+	p := "/bin/ls"
+	file, err := elf.Open(p)
+	if err != nil {
+		t.Skipf("%s isn't an ELF binary: %v", p, err)
+	}
+	libs, _ := file.ImportedLibraries()
+	file.Close()
+	if !contains(libs, "libc.so.6") {
+		t.Skipf("%s isn't linked against glibc", p)
+	}
+
+	cases := []struct {
+		libc *libc
+		ok   bool
+	}{
+		{nil, true},
+		{&libc{flavour: gnu, version: "99.0"}, true},
+		{&libc{flavour: gnu, version: "2.0"}, false},
+		{&libc{flavour: musl}, false},
+	}
+
+	for _, c := range cases {
+		resolver = &mockOSResolver{OS: []string{"linux"}, Arch: []string{"amd64"}, Libc: c.libc}
+		if err := checkLibc(resolver, p); (err == nil) != c.ok {
+			t.Errorf("Expected %s to run with %s: %v, got %v", p, c.libc, c.ok, err)
+		}
+	}
+}
+
+func TestLibcFallback(t *testing.T) {
+	// any binary of the host linked against glibc
+	p := "/bin/ls"
+	file, err := elf.Open(p)
+	if err != nil {
+		t.Skipf("%s isn't an ELF binary: %v", p, err)
+	}
+	libs, _ := file.ImportedLibraries()
+	file.Close()
+	if !contains(libs, "libc.so.6") {
+		t.Skipf("%s isn't linked against glibc", p)
+	}
+	glibcBinary, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := []byte("#!/bin/sh\necho tool\n")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := script
+		if r.URL.Path == "/tool-1.0.0-linux-gnu" {
+			data = glibcBinary
+		}
+		http.ServeContent(w, r, r.URL.Path, time.Now(), bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	// the download cache is relative to the working directory when it's not configured
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	resolver = &mockOSResolver{OS: []string{"linux"}, Arch: []string{"amd64"}, Libc: &libc{flavour: musl}}
+	as := []*Asset{
+		{Name: "tool-1.0.0-linux-gnu", BrowserDownloadURL: srv.URL + "/tool-1.0.0-linux-gnu"},
+		{Name: "tool-1.0.0-linux-musl", BrowserDownloadURL: srv.URL + "/tool-1.0.0-linux-musl"},
+	}
+	f := NewFilter(&FilterOpts{AssetTemplate: "tool-{version}-linux-gnu", CacheKey: cache.Key{Repo: "tool", Version: "1.0.0"}})
+	gf, err := f.FilterAssets("tool", as)
+	if err != nil {
+		t.Fatalf("Error filtering assets: %v", err)
+	}
+	out, err := f.ProcessURL(gf)
+	if err != nil {
+		t.Fatalf("Error processing %s: %v", gf.Name, err)
+	}
+	defer closeFinalFiles([]*finalFile{out})
+
+	bs, err := io.ReadAll(out.Source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bs, script) {
+		t.Fatalf("Expected the binary of the musl asset, got %d bytes", len(bs))
+	}
+	// the musl asset is selected for the next releases
+	if out.AssetTemplate != "tool-{version}-linux-musl" {
+		t.Fatalf("Expected the template of the musl asset, got %q", out.AssetTemplate)
+	}
+}
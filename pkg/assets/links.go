@@ -0,0 +1,168 @@
+// links.go
+//
+// symlinks and hardlinks of archives, e.g. a binary linked to its versioned file,
+// they're resolved to the regular file they point to inside the archive
+package assets
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// maxLinks is the number of links followed before giving up, like ELOOP.
+const maxLinks = 40
+
+// archiveEntry is a regular file or a link of an archive.
+type archiveEntry struct {
+	// name is the name of the entry in the archive
+	name string
+	mode os.FileMode
+	size int64
+	// link is the cleaned path of the entry a link points to, it's
+	// empty for regular files and links pointing outside of the archive
+	link   string
+	isLink bool
+	// header is the start of the content of regular files, see readHeader
+	header []byte
+}
+
+// archiveEntries indexes the regular files and links of an archive by path.
+type archiveEntries struct {
+	byPath map[string]*archiveEntry
+	order  []*archiveEntry
+}
+
+func newArchiveEntries() *archiveEntries {
+	return &archiveEntries{byPath: map[string]*archiveEntry{}}
+}
+
+// cleanPath returns the path of the archive entry name, without the
+// leading ./ most tarballs have.
+func cleanPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// symlinkTarget returns the path of the entry the symlink name points to,
+// or "" if it points outside of the archive.
+func symlinkTarget(name, target string) string {
+	if target == "" || path.IsAbs(target) {
+		return ""
+	}
+	p := path.Join(path.Dir(cleanPath(name)), target)
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return ""
+	}
+	return p
+}
+
+// add adds the entry e, the first entry of a path is kept
+// when an archive has duplicates, like the extraction does.
+func (es *archiveEntries) add(e *archiveEntry) {
+	p := cleanPath(e.name)
+	if _, ok := es.byPath[p]; ok {
+		return
+	}
+	es.byPath[p] = e
+	es.order = append(es.order, e)
+}
+
+// resolve follows the links from the entry name to a regular
+// file, it returns nil if the links are broken or loop.
+func (es *archiveEntries) resolve(name string) *archiveEntry {
+	e := es.byPath[cleanPath(name)]
+	for i := 0; e != nil && e.isLink; i++ {
+		if i == maxLinks || e.link == "" {
+			return nil
+		}
+		e = es.byPath[e.link]
+	}
+	return e
+}
+
+// sources maps the regular files to extract to the wanted entries
+// resolving to them, several links can point to the same file.
+func (es *archiveEntries) sources(wanted []string) map[string][]string {
+	sources := map[string][]string{}
+	for _, name := range wanted {
+		if e := es.resolve(name); e != nil {
+			sources[e.name] = append(sources[e.name], name)
+		}
+	}
+	return sources
+}
+
+// entryAssets returns the names of the regular files and resolved links of
+// the archive, and the ones which are candidates for the binary. The mode of
+// the links is the mode of the file they point to. The versioned file a link
+// points to isn't a candidate, unless it's the PackagePath or it's picked.
+func (f *Filter) entryAssets(es *archiveEntries) ([]string, []*Asset) {
+	names := []string{}
+	candidates := []*archiveEntry{}
+	linked := map[*archiveEntry]bool{}
+	for _, e := range es.order {
+		r := es.resolve(e.name)
+		if r == nil {
+			continue
+		}
+		names = append(names, e.name)
+
+		if !f.opts.SkipPathCheck && len(f.opts.PackagePath) > 0 && e.name != f.opts.PackagePath {
+			continue
+		}
+
+		if f.executablesOnly && r.mode&0o111 == 0 {
+			continue
+		}
+
+		candidates = append(candidates, e)
+		if e.isLink {
+			linked[r] = true
+		}
+	}
+
+	as := make([]*Asset, 0, len(candidates))
+	for _, e := range candidates {
+		if linked[e] && len(f.opts.PackagePath) == 0 && len(f.opts.Pick) == 0 {
+			continue
+		}
+		r := es.resolve(e.name)
+		as = append(as, &Asset{Name: e.name, URL: "", Size: r.size, Mode: r.mode, elf: parseELFHeader(r.header)})
+	}
+	return names, as
+}
+
+// modes returns the modes of the files the entries names resolve to.
+func (es *archiveEntries) modes(names []string) map[string]os.FileMode {
+	modes := map[string]os.FileMode{}
+	for _, name := range names {
+		if e := es.resolve(name); e != nil {
+			modes[name] = e.mode
+		}
+	}
+	return modes
+}
+
+// extractLinked extracts r for every entry of names, which all
+// resolve to the same regular file, and records them in paths.
+func extractLinked(r io.Reader, names []string, paths map[string]string) error {
+	tmp, err := extractToTemp(r)
+	if err != nil {
+		return err
+	}
+	paths[names[0]] = tmp
+	for _, name := range names[1:] {
+		file, err := os.Open(tmp)
+		if err != nil {
+			return err
+		}
+		p, err := extractToTemp(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		paths[name] = p
+	}
+	return nil
+}
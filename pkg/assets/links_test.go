@@ -0,0 +1,170 @@
+package assets
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type linkEntry struct {
+	name string
+	mode int64
+	// link is the target of symlinks, or of hardlinks if hard is set
+	link string
+	hard bool
+	data []byte
+}
+
+func linkTar(t *testing.T, entries []linkEntry) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, e := range entries {
+		h := &tar.Header{Name: e.name, Mode: e.mode, Size: int64(len(e.data)), Typeflag: tar.TypeReg}
+		if e.link != "" {
+			h.Typeflag, h.Linkname, h.Size = tar.TypeSymlink, e.link, 0
+			if e.hard {
+				h.Typeflag = tar.TypeLink
+			}
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	return buf.Bytes()
+}
+
+func linkZip(t *testing.T, entries []linkEntry) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, e := range entries {
+		h := &zip.FileHeader{Name: e.name}
+		h.SetMode(os.FileMode(e.mode))
+		data := e.data
+		if e.link != "" {
+			h.SetMode(os.ModeSymlink | 0o777)
+			data = []byte(e.link)
+		}
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestProcessFileLinks(t *testing.T) {
+	binary := []byte("\x7fELF tool")
+	versioned := []linkEntry{
+		{name: "tool-1.2.3/README.md", mode: 0o644, data: []byte("# tool")},
+		{name: "tool-1.2.3/tool", link: "tool-1.2.3"},
+		{name: "tool-1.2.3/tool-1.2.3", mode: 0o750, data: binary},
+	}
+	hardlinked := []linkEntry{
+		{name: "./bin/tool-1.2.3", mode: 0o750, data: binary},
+		{name: "./bin/tool", link: "bin/tool-1.2.3", hard: true, mode: 0o750},
+	}
+	chained := []linkEntry{
+		{name: "opt/tool/libexec/tool", mode: 0o750, data: binary},
+		{name: "opt/tool/bin/tool-current", link: "../libexec/tool"},
+		{name: "bin/tool", link: "../opt/tool/bin/tool-current"},
+		{name: "bin/outside", link: "/usr/bin/tool"},
+		{name: "bin/loop", link: "loop"},
+	}
+
+	cases := []struct {
+		name        string
+		data        []byte
+		opts        *FilterOpts
+		packagePath string
+	}{
+		{"tool.tar", linkTar(t, versioned), &FilterOpts{}, "tool-1.2.3/tool"},
+		{"tool.zip", linkZip(t, versioned), &FilterOpts{}, "tool-1.2.3/tool"},
+		{"tool.tar", linkTar(t, hardlinked), &FilterOpts{}, "./bin/tool"},
+		{"tool.tar", linkTar(t, chained), &FilterOpts{PackagePath: "bin/tool"}, "bin/tool"},
+		{"tool.zip", linkZip(t, chained), &FilterOpts{Pick: []string{"bin/*"}}, "bin/tool"},
+		// the versioned file is still installed when asked for
+		{"tool.tar", linkTar(t, versioned), &FilterOpts{PackagePath: "tool-1.2.3/tool-1.2.3"}, "tool-1.2.3/tool-1.2.3"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("TMPDIR", dir)
+			p := filepath.Join(dir, c.name)
+			if err := os.WriteFile(p, c.data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			f := InitFilter("tool", c.name, "", c.opts)
+			out, err := f.processFile(p, false)
+			if err != nil {
+				t.Fatalf("Error processing archive: %v", err)
+			}
+			defer closeFinalFiles([]*finalFile{out})
+
+			if out.PackagePath != c.packagePath || len(out.Others) != 0 {
+				t.Fatalf("Expected only %s, got %s and %d others", c.packagePath, out.PackagePath, len(out.Others))
+			}
+			if out.Mode.Perm() != 0o750 {
+				t.Fatalf("Expected the mode of the archive entry, got %s", out.Mode)
+			}
+			bs, err := io.ReadAll(out.Source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(bs, binary) {
+				t.Fatalf("Expected %q, got %q", binary, bs)
+			}
+		})
+	}
+}
+
+func TestProcessFileBrokenLinks(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	p := filepath.Join(dir, "tool.tar")
+	data := linkTar(t, []linkEntry{
+		{name: "bin/tool", link: "/usr/bin/tool"},
+		{name: "bin/other", link: "../../other"},
+		{name: "bin/loop", link: "loop"},
+		{name: "bin/missing", link: "missing", hard: true},
+	})
+	if err := os.WriteFile(p, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	f := InitFilter("tool", "tool.tar", "", &FilterOpts{})
+	if _, err := f.processFile(p, false); err == nil {
+		t.Fatalf("Expected an error processing an archive with only broken links")
+	}
+}
+
+func TestFilterAssetContentsExecutable(t *testing.T) {
+	resolver = testLinuxAMDResolver
+	f := InitFilter("tool", "tool.tar.gz", "", &FilterOpts{})
+	as := []*Asset{
+		{Name: "tool/tool.sh", Mode: 0o644},
+		{Name: "tool/tool", Mode: 0o755},
+	}
+	out, err := f.FilterAssetContents("tool", as)
+	if err != nil {
+		t.Fatalf("Error filtering contents: %v", err)
+	}
+	if out.Name != "tool/tool" {
+		t.Fatalf("Expected the executable tool/tool, got %s", out.Name)
+	}
+}
@@ -0,0 +1,207 @@
+// minisign.go
+//
+// verify minisign (<asset>.minisig) and signify (<asset>.sig) signatures against a pinned public key
+package assets
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dfang/bin/pkg/config"
+	zlog "github.com/rs/zerolog/log"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	untrustedCommentPrefix = "untrusted comment:"
+	trustedCommentPrefix   = "trusted comment: "
+)
+
+// edPublicKey is a minisign or signify public key, both
+// share the same layout: algorithm, key id and ed25519 key.
+type edPublicKey struct {
+	keyID [8]byte
+	key   ed25519.PublicKey
+}
+
+// edSignature is a minisign or signify signature.
+type edSignature struct {
+	// algorithm is Ed for signatures of the message itself
+	// and ED for minisign signatures of its blake2b hash
+	algorithm string
+	keyID     [8]byte
+	signature []byte
+	// trustedComment and globalSignature are only present in minisign signatures
+	trustedComment  string
+	globalSignature []byte
+}
+
+// parseEdPublicKey parses a public key as printed by `minisign -G` or `signify -G`,
+// either the base64 line alone or the whole .pub file.
+func parseEdPublicKey(s string) (*edPublicKey, error) {
+	lines := nonCommentLines(s)
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("empty public key")
+	}
+	bs, err := decodeBase64(lines[0])
+	if err != nil {
+		return nil, fmt.Errorf("error decoding public key: %w", err)
+	}
+	if len(bs) != 2+8+ed25519.PublicKeySize || string(bs[:2]) != "Ed" {
+		return nil, fmt.Errorf("invalid ed25519 public key")
+	}
+
+	k := &edPublicKey{key: ed25519.PublicKey(bs[10:])}
+	copy(k.keyID[:], bs[2:10])
+	return k, nil
+}
+
+func nonCommentLines(s string) []string {
+	res := []string{}
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, untrustedCommentPrefix) {
+			continue
+		}
+		res = append(res, line)
+	}
+	return res
+}
+
+// parseEdSignature parses a minisign or signify signature file.
+func parseEdSignature(bs []byte) (*edSignature, error) {
+	lines := strings.Split(strings.ReplaceAll(string(bs), "\r\n", "\n"), "\n")
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], untrustedCommentPrefix) {
+		return nil, fmt.Errorf("invalid signature file, missing untrusted comment")
+	}
+
+	raw, err := decodeBase64(lines[1])
+	if err != nil {
+		return nil, fmt.Errorf("error decoding signature: %w", err)
+	}
+	if len(raw) != 2+8+ed25519.SignatureSize {
+		return nil, fmt.Errorf("invalid signature length %d", len(raw))
+	}
+
+	s := &edSignature{algorithm: string(raw[:2]), signature: raw[10:]}
+	copy(s.keyID[:], raw[2:10])
+	if s.algorithm != "Ed" && s.algorithm != "ED" {
+		return nil, fmt.Errorf("unsupported signature algorithm %q", s.algorithm)
+	}
+
+	if len(lines) >= 4 && strings.HasPrefix(lines[2], trustedCommentPrefix) {
+		s.trustedComment = strings.TrimPrefix(lines[2], trustedCommentPrefix)
+		if s.globalSignature, err = decodeBase64(lines[3]); err != nil {
+			return nil, fmt.Errorf("error decoding global signature: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// keyIDString formats a key id the way minisign prints it.
+func keyIDString(id [8]byte) string {
+	reversed := make([]byte, len(id))
+	for i := range id {
+		reversed[i] = id[len(id)-1-i]
+	}
+	return strings.ToUpper(hex.EncodeToString(reversed))
+}
+
+// verifyEd verifies sig over the content of file with the pinned key. The
+// trusted comment of minisign signatures is required to be signed as well.
+func verifyEd(pub *edPublicKey, sig *edSignature, file *signedFile, minisign bool) error {
+	if sig.keyID != pub.keyID {
+		return fmt.Errorf("signed with key %s but the pinned key is %s", keyIDString(sig.keyID), keyIDString(pub.keyID))
+	}
+
+	var message []byte
+	if sig.algorithm == "ED" {
+		r, err := file.open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		h, _ := blake2b.New512(nil)
+		if _, err := io.Copy(h, r); err != nil {
+			return err
+		}
+		message = h.Sum(nil)
+	} else {
+		var err error
+		if message, err = file.readAll(); err != nil {
+			return err
+		}
+	}
+
+	if !ed25519.Verify(pub.key, message, sig.signature) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	if minisign {
+		if sig.globalSignature == nil {
+			return fmt.Errorf("missing trusted comment")
+		}
+		global := append(append([]byte{}, sig.signature...), []byte(sig.trustedComment)...)
+		if !ed25519.Verify(pub.key, global, sig.globalSignature) {
+			return fmt.Errorf("invalid trusted comment signature")
+		}
+	}
+
+	return nil
+}
+
+// verifyEdSignature verifies the first of files with a signature matching ext
+// published in the release. Minisign and signify only differ by the extension
+// of the signature file and minisign's signed trusted comment.
+func (f *Filter) verifyEdSignature(tool, publicKey, ext string, files []*signedFile) error {
+	pub, err := parseEdPublicKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("invalid %s public key: %w", tool, err)
+	}
+
+	for _, file := range files {
+		a := f.findSignatureAsset(file.name, ext)
+		if a == nil {
+			zlog.Debug().Msgf("No %s signature found for %s", tool, file.name)
+			continue
+		}
+		bs, err := f.auxiliaryFile(a)
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(bs, []byte(untrustedCommentPrefix)) {
+			// e.g. a cosign .sig file
+			zlog.Debug().Msgf("%s is not a %s signature", a.Name, tool)
+			continue
+		}
+
+		sig, err := parseEdSignature(bs)
+		if err != nil {
+			return signatureError(file.name, "%s: %v", a.Name, err)
+		}
+		if err := verifyEd(pub, sig, file, tool == "minisign"); err != nil {
+			return signatureError(file.name, "%s: %v", a.Name, err)
+		}
+
+		zlog.Info().Msgf("%s signature of %s verified with key %s", tool, file.name, keyIDString(pub.keyID))
+		return nil
+	}
+
+	return fmt.Errorf("%w: the release doesn't publish a %s signature for %s", ErrSignatureNotFound, tool, files[0].name)
+}
+
+func (f *Filter) verifyMinisign(policy *config.MinisignPolicy, files []*signedFile) error {
+	return f.verifyEdSignature("minisign", policy.PublicKey, ".minisig", files)
+}
+
+func (f *Filter) verifySignify(policy *config.SignifyPolicy, files []*signedFile) error {
+	return f.verifyEdSignature("signify", policy.PublicKey, ".sig", files)
+}
@@ -0,0 +1,118 @@
+package assets
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dfang/bin/pkg/config"
+	"golang.org/x/crypto/blake2b"
+)
+
+type testEdKey struct {
+	id   []byte
+	pub  ed25519.PublicKey
+	priv ed25519.PrivateKey
+}
+
+func newTestEdKey(t *testing.T, id string) *testEdKey {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testEdKey{id: []byte(id), pub: pub, priv: priv}
+}
+
+func (k *testEdKey) publicKey() string {
+	raw := append(append([]byte("Ed"), k.id...), k.pub...)
+	return "untrusted comment: test public key\n" + base64.StdEncoding.EncodeToString(raw) + "\n"
+}
+
+// minisign signs data the way `minisign -S` does with prehashing.
+func (k *testEdKey) minisign(data []byte) []byte {
+	h := blake2b.Sum512(data)
+	sig := ed25519.Sign(k.priv, h[:])
+	comment := "timestamp:1690000000\tfile:bin"
+	global := ed25519.Sign(k.priv, append(append([]byte{}, sig...), []byte(comment)...))
+	raw := append(append([]byte("ED"), k.id...), sig...)
+	return []byte(fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(raw), comment, base64.StdEncoding.EncodeToString(global)))
+}
+
+// signify signs data the way `signify -S` does.
+func (k *testEdKey) signify(data []byte) []byte {
+	raw := append(append([]byte("Ed"), k.id...), ed25519.Sign(k.priv, data)...)
+	return []byte(fmt.Sprintf("untrusted comment: verify with test.pub\n%s\n", base64.StdEncoding.EncodeToString(raw)))
+}
+
+func TestVerifyEdSignatures(t *testing.T) {
+	data := []byte("#!/bin/sh\necho bin\n")
+	name := "bin_0.1.0_linux_amd64"
+	assetPath := writeTempFile(t, name, data)
+
+	pinned := newTestEdKey(t, "pinnedid")
+	other := newTestEdKey(t, "otherkey")
+
+	tampered := bytes.Replace(pinned.minisign(data), []byte("file:bin"), []byte("file:evil"), 1)
+
+	cases := []struct {
+		name  string
+		files map[string][]byte
+		v     *config.Verification
+		err   error
+	}{
+		{
+			name:  "minisign",
+			files: map[string][]byte{name + ".minisig": pinned.minisign(data)},
+			v:     &config.Verification{Minisign: &config.MinisignPolicy{PublicKey: pinned.publicKey()}},
+		},
+		{
+			name:  "minisign with another key",
+			files: map[string][]byte{name + ".minisig": other.minisign(data)},
+			v:     &config.Verification{Minisign: &config.MinisignPolicy{PublicKey: pinned.publicKey()}},
+			err:   ErrSignatureMismatch,
+		},
+		{
+			name:  "minisign with tampered trusted comment",
+			files: map[string][]byte{name + ".minisig": tampered},
+			v:     &config.Verification{Minisign: &config.MinisignPolicy{PublicKey: pinned.publicKey()}},
+			err:   ErrSignatureMismatch,
+		},
+		{
+			name:  "minisign missing",
+			files: map[string][]byte{name + ".sig": pinned.signify(data)},
+			v:     &config.Verification{Minisign: &config.MinisignPolicy{PublicKey: pinned.publicKey()}},
+			err:   ErrSignatureNotFound,
+		},
+		{
+			name:  "signify",
+			files: map[string][]byte{name + ".sig": pinned.signify(data)},
+			v:     &config.Verification{Signify: &config.SignifyPolicy{PublicKey: pinned.publicKey()}},
+		},
+		{
+			name:  "signify of other content",
+			files: map[string][]byte{name + ".sig": pinned.signify([]byte("something else"))},
+			v:     &config.Verification{Signify: &config.SignifyPolicy{PublicKey: pinned.publicKey()}},
+			err:   ErrSignatureMismatch,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f := NewFilter(&FilterOpts{Verification: c.v})
+			f.assets = serveFiles(t, c.files)
+			_, err := f.verifySignatures(&FilteredAsset{Name: name}, assetPath, nil)
+			if c.err == nil && err != nil {
+				t.Fatalf("Error verifying signature: %v", err)
+			}
+			if c.err != nil && !errors.Is(err, c.err) {
+				t.Fatalf("Expected error %v, got %v", c.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+// package.go
+//
+// extract binaries from deb and rpm packages, only their payload is unpacked,
+// the control files and the package scripts are never run
+package assets
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	bstrings "github.com/dfang/bin/pkg/strings"
+	"github.com/h2non/filetype"
+	"github.com/h2non/filetype/matchers"
+)
+
+var cpioType = filetype.AddType("cpio", "application/x-cpio")
+
+var (
+	// arMagic is the global header of the ar archives deb packages are
+	arMagic = []byte("!<arch>\n")
+	// rpmHeaderMagic starts the signature and the main header of rpm packages
+	rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+	// cpioMagic is the magic number of the "new" ascii cpio format,
+	// cpio archives with a checksum are 070702
+	cpioMagic = []byte("07070")
+	// debMagic starts deb packages, their first member is debian-binary
+	debMagic = []byte("!<arch>\ndebian-binary")
+)
+
+const (
+	arHeaderSize   = 60
+	rpmLeadSize    = 96
+	cpioHeaderSize = 110
+	cpioTrailer    = "TRAILER!!!"
+)
+
+func init() {
+	filetype.AddMatcher(cpioType, func(buf []byte) bool {
+		return len(buf) > 6 && bytes.HasPrefix(buf, cpioMagic) && (buf[5] == '1' || buf[5] == '2')
+	})
+	// filetype registers its archive matchers in map order, so a deb
+	// may be matched as a plain ar archive first, check it again ahead
+	filetype.AddMatcher(matchers.TypeDeb, func(buf []byte) bool {
+		return bytes.HasPrefix(buf, debMagic)
+	})
+
+	registerProcessor(matchers.TypeDeb, (*Filter).processDeb)
+	registerProcessor(matchers.TypeRpm, (*Filter).processRpm)
+	registerProcessor(cpioType, (*Filter).processCpio)
+}
+
+// isPackageExt checks if filename is a deb or rpm package, they
+// are only considered when no binary or archive for the OS is available.
+func isPackageExt(filename string) bool {
+	switch filetype.GetType(strings.TrimPrefix(filepath.Ext(filename), ".")) {
+	case matchers.TypeDeb, matchers.TypeRpm:
+		return true
+	}
+	return false
+}
+
+// targetsLinux checks if the resolved target OS is linux,
+// the only one deb and rpm packages are installed on.
+func targetsLinux(r platformResolver) bool {
+	for _, os := range r.GetOS() {
+		if os == "linux" {
+			return true
+		}
+	}
+	return false
+}
+
+// anyForOS checks if any of the matches is named after the target OS.
+func anyForOS(r platformResolver, matches []*FilteredAsset) bool {
+	for _, m := range matches {
+		if bstrings.ContainsAny(strings.ToLower(m.Name), r.GetOS()) {
+			return true
+		}
+	}
+	return false
+}
+
+// processDeb extracts the data.tar member of the deb package at p, which
+// is an ar archive. The control member with the maintainer scripts is skipped.
+func (f *Filter) processDeb(name, p string) (*extracted, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	magic := make([]byte, len(arMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, arMagic) {
+		return nil, fmt.Errorf("invalid deb package %s", f.name)
+	}
+
+	header := make([]byte, arHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid deb package %s: %w", f.name, err)
+		}
+
+		// GNU ar terminates the names with a slash
+		member := strings.TrimSuffix(strings.TrimSpace(string(header[:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid deb package %s: bad size of member %s", f.name, member)
+		}
+
+		content := io.LimitReader(r, size)
+		if strings.HasPrefix(member, "data.tar") {
+			tmp, err := extractToTemp(content)
+			if err != nil {
+				return nil, err
+			}
+			f.executablesOnly = true
+			return &extracted{path: tmp, name: member}, nil
+		}
+
+		// members are aligned to an even offset
+		if _, err := r.Discard(int(size + size%2)); err != nil {
+			return nil, fmt.Errorf("invalid deb package %s: %w", f.name, err)
+		}
+	}
+
+	return nil, fmt.Errorf("no data.tar found in deb package %s", f.name)
+}
+
+// processRpm skips the lead and the headers of the rpm package at p and
+// extracts its payload, a (usually compressed) cpio archive.
+func (f *Filter) processRpm(name, p string) (*extracted, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	if _, err := r.Discard(rpmLeadSize); err != nil {
+		return nil, fmt.Errorf("invalid rpm package %s: %w", f.name, err)
+	}
+
+	// the signature header is padded to a multiple of 8 bytes
+	size, err := skipRpmHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rpm package %s: %w", f.name, err)
+	}
+	if pad := (8 - size%8) % 8; pad > 0 {
+		if _, err := r.Discard(int(pad)); err != nil {
+			return nil, fmt.Errorf("invalid rpm package %s: %w", f.name, err)
+		}
+	}
+	if _, err := skipRpmHeader(r); err != nil {
+		return nil, fmt.Errorf("invalid rpm package %s: %w", f.name, err)
+	}
+
+	tmp, err := extractToTemp(r)
+	if err != nil {
+		return nil, err
+	}
+	f.executablesOnly = true
+	return &extracted{path: tmp, name: strings.TrimSuffix(f.name, filepath.Ext(f.name)) + ".cpio"}, nil
+}
+
+// skipRpmHeader skips a header structure of an rpm package and returns its size.
+func skipRpmHeader(r *bufio.Reader) (int64, error) {
+	intro := make([]byte, 16)
+	if _, err := io.ReadFull(r, intro); err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(intro[:4], rpmHeaderMagic) {
+		return 0, fmt.Errorf("bad header magic")
+	}
+
+	// index entries are 16 bytes each, followed by the data store
+	entries := int64(binary.BigEndian.Uint32(intro[8:12]))
+	store := int64(binary.BigEndian.Uint32(intro[12:16]))
+	size := 16*entries + store
+	if _, err := r.Discard(int(size)); err != nil {
+		return 0, err
+	}
+	return int64(len(intro)) + size, nil
+}
+
+// cpioEntry is a file of a cpio archive and the offset of its content.
+type cpioEntry struct {
+	name   string
+	mode   int64
+	size   int64
+	offset int64
+}
+
+func (e *cpioEntry) isRegular() bool {
+	return e.mode&0o170000 == 0o100000
+}
+
+func (e *cpioEntry) isSymlink() bool {
+	return e.mode&0o170000 == 0o120000
+}
+
+// readCpio lists the entries of the newc cpio archive r.
+func readCpio(r io.ReadSeeker) ([]*cpioEntry, error) {
+	entries := []*cpioEntry{}
+	header := make([]byte, cpioHeaderSize)
+	var offset int64
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, fmt.Errorf("invalid cpio archive: %w", err)
+		}
+		if !bytes.HasPrefix(header, cpioMagic) {
+			return nil, fmt.Errorf("invalid cpio archive: bad header magic")
+		}
+
+		field := func(i int) (int64, error) {
+			return strconv.ParseInt(string(header[6+8*i:14+8*i]), 16, 64)
+		}
+		mode, err := field(1)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpio archive: %w", err)
+		}
+		size, err := field(6)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpio archive: %w", err)
+		}
+		nameSize, err := field(11)
+		if err != nil || nameSize < 1 {
+			return nil, fmt.Errorf("invalid cpio archive: bad name size")
+		}
+
+		name := make([]byte, nameSize)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, fmt.Errorf("invalid cpio archive: %w", err)
+		}
+		// the name and the content are padded to a multiple of 4 bytes
+		offset += align4(cpioHeaderSize + nameSize)
+		e := &cpioEntry{name: string(bytes.TrimRight(name, "\x00")), mode: mode, size: size, offset: offset}
+		if e.name == cpioTrailer {
+			return entries, nil
+		}
+		entries = append(entries, e)
+
+		offset += align4(size)
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func align4(n int64) int64 {
+	return (n + 3) &^ 3
+}
+
+// processCpio lists the entries of the cpio archive at p and extracts the selected one.
+func (f *Filter) processCpio(name, p string) (*extracted, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries, err := readCpio(file)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]*cpioEntry{}
+	archive := newArchiveEntries()
+	for _, e := range entries {
+		entry := &archiveEntry{name: e.name, mode: os.FileMode(e.mode & 0o777), size: e.size}
+		switch {
+		case e.isRegular():
+			entry.header = readHeader(io.NewSectionReader(file, e.offset, e.size))
+		case e.isSymlink():
+			// the content of symlinks is their target
+			target, err := io.ReadAll(io.NewSectionReader(file, e.offset, e.size))
+			if err != nil {
+				return nil, err
+			}
+			entry.isLink, entry.link = true, symlinkTarget(e.name, string(target))
+		default:
+			continue
+		}
+
+		files[e.name] = e
+		archive.add(entry)
+	}
+
+	names, as := f.entryAssets(archive)
+	if len(as) == 0 {
+		return nil, fmt.Errorf("no files found in cpio archive. PackagePath [%s]", f.opts.PackagePath)
+	}
+
+	selected, err := f.selectContents(name, as)
+	if err != nil {
+		return nil, err
+	}
+
+	companions := f.companionContents(names, selected)
+
+	paths := map[string]string{}
+	for source, wanted := range archive.sources(append(selected, keys(companions)...)) {
+		e := files[source]
+		if err := extractLinked(io.NewSectionReader(file, e.offset, e.size), wanted, paths); err != nil {
+			removeExtracted(paths)
+			return nil, err
+		}
+	}
+
+	return extractedEntries(selected, companions, paths, archive.modes(selected), "cpio")
+}
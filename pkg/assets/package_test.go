@@ -0,0 +1,212 @@
+package assets
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/h2non/filetype"
+	"github.com/h2non/filetype/matchers"
+)
+
+type packageFile struct {
+	name string
+	mode int64
+	data []byte
+}
+
+func packageFiles(binary []byte) []packageFile {
+	return []packageFile{
+		{"./usr/share/doc/bin/copyright", 0o644, []byte("MIT")},
+		{"./usr/bin/bin", 0o755, binary},
+		{"./usr/share/man/man1/bin.1", 0o644, []byte(".TH BIN 1")},
+	}
+}
+
+func packageTar(t *testing.T, files []packageFile) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: f.mode, Size: int64(len(f.data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	return buf.Bytes()
+}
+
+func deb(t *testing.T, files []packageFile) []byte {
+	t.Helper()
+	buf := bytes.NewBufferString("!<arch>\n")
+	member := func(name string, data []byte) {
+		fmt.Fprintf(buf, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", name, 0, 0, 0, "100644", len(data))
+		buf.Write(data)
+		if len(data)%2 == 1 {
+			buf.WriteByte('\n')
+		}
+	}
+	member("debian-binary", []byte("2.0\n"))
+	member("control.tar.gz", tarGz(t, map[string][]byte{"./postinst": []byte("#!/bin/sh\nexit 1\n")}))
+	member("data.tar.gz", gz(t, packageTar(t, files)))
+	return buf.Bytes()
+}
+
+func cpio(files []packageFile) []byte {
+	buf := new(bytes.Buffer)
+	entry := func(name string, mode int64, data []byte) {
+		fmt.Fprintf(buf, "070701%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X", 0, mode, 0, 0, 1, 0, len(data), 0, 0, 0, 0, len(name)+1, 0)
+		buf.WriteString(name + "\x00")
+		for buf.Len()%4 != 0 {
+			buf.WriteByte(0)
+		}
+		buf.Write(data)
+		for buf.Len()%4 != 0 {
+			buf.WriteByte(0)
+		}
+	}
+	entry("./usr/bin", 0o40755, nil)
+	for _, f := range files {
+		entry(f.name, 0o100000|f.mode, f.data)
+	}
+	entry(cpioTrailer, 0, nil)
+	return buf.Bytes()
+}
+
+func rpm(t *testing.T, files []packageFile) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	lead := make([]byte, rpmLeadSize)
+	copy(lead, []byte{0xed, 0xab, 0xee, 0xdb, 3, 0})
+	buf.Write(lead)
+
+	header := func(store []byte) {
+		buf.Write(rpmHeaderMagic)
+		buf.Write(make([]byte, 4))
+		_ = binary.Write(buf, binary.BigEndian, uint32(1))
+		_ = binary.Write(buf, binary.BigEndian, uint32(len(store)))
+		buf.Write(make([]byte, 16))
+		buf.Write(store)
+	}
+	// the signature header is padded to 8 bytes, the main header isn't
+	header([]byte("sig"))
+	buf.Write(make([]byte, 5))
+	header([]byte("main"))
+
+	buf.Write(gz(t, cpio(files)))
+	return buf.Bytes()
+}
+
+func TestProcessPackage(t *testing.T) {
+	resolver = testLinuxAMDResolver
+	binary := []byte("\x7fELF binary")
+
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"bin_0.1.0_amd64.deb", deb(t, packageFiles(binary))},
+		{"bin-0.1.0.x86_64.rpm", rpm(t, packageFiles(binary))},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("TMPDIR", dir)
+			p := filepath.Join(dir, c.name)
+			if err := os.WriteFile(p, c.data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			// only the executable is listed, there's nothing to pick from
+			f := InitFilter("bin", c.name, "", &FilterOpts{})
+			out, err := f.processFile(p, false)
+			if err != nil {
+				t.Fatalf("Error processing %s: %v", c.name, err)
+			}
+			if out.Name != "bin" || out.PackagePath != "./usr/bin/bin" {
+				t.Fatalf("Expected bin (./usr/bin/bin), got %s (%s)", out.Name, out.PackagePath)
+			}
+
+			bs, err := io.ReadAll(out.Source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(bs, binary) {
+				t.Fatalf("Expected %q, got %q", binary, bs)
+			}
+			if c, ok := out.Source.(io.Closer); ok {
+				c.Close()
+			}
+
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != 1 {
+				t.Fatalf("Expected temporary files to be removed, found %d files", len(entries))
+			}
+		})
+	}
+}
+
+func TestDetectDeb(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "bin_0.1.0_amd64.deb")
+	if err := os.WriteFile(p, deb(t, packageFiles([]byte("\x7fELF binary"))), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// debs are ar archives too, they must never be detected as such
+	// whatever order filetype registered its matchers in
+	for _, kind := range *filetype.MatcherKeys {
+		if kind == matchers.TypeAr {
+			t.Fatalf("Expected debs to be matched before ar archives")
+		}
+		if kind == matchers.TypeDeb {
+			break
+		}
+	}
+	for i := 0; i < 100; i++ {
+		kind, err := filetype.MatchFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kind == matchers.TypeAr {
+			t.Fatalf("Expected a deb, got a plain ar archive on detection %d", i)
+		}
+		if kind != matchers.TypeDeb {
+			t.Fatalf("Expected a deb, got %s on detection %d", kind.Extension, i)
+		}
+	}
+}
+
+func TestProcessPackageInvalid(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"bin_0.1.0_amd64.deb", []byte("!<arch>\ndebian-binary   0           0     0     100644  4         `\n2.0\n")},
+		{"bin-0.1.0.x86_64.rpm", rpm(t, packageFiles(nil))[:rpmLeadSize+20]},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("TMPDIR", dir)
+			p := filepath.Join(dir, c.name)
+			if err := os.WriteFile(p, c.data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			f := InitFilter("bin", c.name, "", &FilterOpts{})
+			if _, err := f.processFile(p, false); err == nil {
+				t.Fatalf("Expected an error processing %s", c.name)
+			}
+		})
+	}
+}
@@ -5,231 +5,776 @@ package assets
 
 import (
 	"archive/tar"
+	"archive/zip"
 	"bytes"
 	"compress/bzip2"
 	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
 
 	"github.com/apex/log"
+	"github.com/bodgit/sevenzip"
 	"github.com/dfang/bin/pkg/options"
 	bstrings "github.com/dfang/bin/pkg/strings"
 	"github.com/dfang/bin/pkg/util"
 	"github.com/h2non/filetype"
 	"github.com/h2non/filetype/matchers"
 	"github.com/h2non/filetype/types"
-	"github.com/krolaw/zipstream"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
 	zlog "github.com/rs/zerolog/log"
 	"github.com/xi2/xz"
 )
 
 // process downloaded asset (tar zip tar.gz or exe)
+//
+// archives and compressed files are never loaded in memory, every stage extracts
+// its output to a temporary file which is processed again until the binary is found
 
 var (
 	msiType = filetype.AddType("msi", "application/octet-stream")
 	ascType = filetype.AddType("asc", "text/plain")
+	lz4Type = filetype.AddType("lz4", "application/x-lz4")
 )
 
-func (f *Filter) processReader(r io.Reader) (*finalFile, error) {
-	zlog.Trace().Msgf("%v", f.name)
+// lz4Magic is the magic number of lz4 frames.
+var lz4Magic = []byte{0x04, 0x22, 0x4d, 0x18}
+
+func init() {
+	filetype.AddMatcher(lz4Type, func(buf []byte) bool {
+		return bytes.HasPrefix(buf, lz4Magic)
+	})
+}
+
+// compressedExts maps the extensions of compressed files to the extension
+// of their decompressed content, e.g. a .tgz is a compressed .tar.
+var compressedExts = map[string]string{
+	".gz":   "",
+	".tgz":  ".tar",
+	".xz":   "",
+	".txz":  ".tar",
+	".bz2":  "",
+	".tbz":  ".tar",
+	".tbz2": ".tar",
+	".zst":  "",
+	".tzst": ".tar",
+	".lz4":  "",
+}
+
+// decompressedName returns the name of the decompressed content
+// of the compressed file name, e.g. bin.tar for bin.tgz.
+func decompressedName(name string) string {
+	ext := filepath.Ext(name)
+	if to, ok := compressedExts[strings.ToLower(ext)]; ok {
+		return strings.TrimSuffix(name, ext) + to
+	}
+	return name
+}
+
+// extracted is the output of a processor, a file extracted from
+// the asset (or decompressed) into a temporary file.
+type extracted struct {
+	path        string
+	name        string
+	packagePath string
+	// mode is the mode of the file in the archive, 0 if unknown
+	mode os.FileMode
+	// others are the other files picked from the archive
+	others []*extracted
+	// companions are the completions and man pages of the archive,
+	// named after the path they're installed to
+	companions []*extracted
+}
+
+// remove removes the temporary files of e.
+func (e *extracted) remove() {
+	os.Remove(e.path)
+	for _, o := range append(e.others, e.companions...) {
+		o.remove()
+	}
+}
+
+// processorFunc extracts the file of the archive (or decompresses the
+// file) at p, name is the name of the repository the asset belongs to.
+type processorFunc func(f *Filter, name, p string) (*extracted, error)
+
+// processors maps the detected file types to the processor
+// extracting them, see registerProcessor.
+var processors = map[types.Type]processorFunc{}
 
-	var buf bytes.Buffer
-	tee := io.TeeReader(r, &buf)
+// registerProcessor registers fn to process the files detected as t,
+// the files of unregistered types are considered to be the binary.
+func registerProcessor(t types.Type, fn processorFunc) {
+	processors[t] = fn
+}
+
+func init() {
+	registerProcessor(matchers.TypeGz, (*Filter).processGz)
+	registerProcessor(matchers.TypeTar, (*Filter).processTar)
+	registerProcessor(matchers.TypeXz, (*Filter).processXz)
+	registerProcessor(matchers.TypeBz2, (*Filter).processBz2)
+	registerProcessor(matchers.TypeZip, (*Filter).processZip)
+	registerProcessor(matchers.TypeZstd, (*Filter).processZstd)
+	registerProcessor(lz4Type, (*Filter).processLz4)
+	registerProcessor(matchers.Type7z, (*Filter).process7z)
+}
+
+// extractedFile is the binary extracted from an archive,
+// the temporary file is removed once it's closed.
+type extractedFile struct {
+	*os.File
+}
+
+func (e *extractedFile) Close() error {
+	err := e.File.Close()
+	if rerr := os.Remove(e.Name()); err == nil && !os.IsNotExist(rerr) {
+		err = rerr
+	}
+	return err
+}
 
-	t, err := filetype.MatchReader(tee)
+// processFile detects the type of the file at p and extracts it until the
+// binary is found. Files created by the processors are owned and removed
+// once the next stage has been extracted.
+func (f *Filter) processFile(p string, owned bool) (*finalFile, error) {
+	zlog.Trace().Msgf("%v", f.name)
+
+	t, err := filetype.MatchFile(p)
 	if err != nil {
 		return nil, err
 	}
 
-	outputFile := io.MultiReader(&buf, r)
+	zlog.Debug().Msgf("Processing file %s with matcher %s", f.name, t.Extension)
 
-	type processorFunc func(repoName string, r io.Reader) (*finalFile, error)
-	var processor processorFunc
+	processor := processors[t]
+	if processor == nil {
+		zlog.Debug().Msgf("File %s is uncompressed", f.name)
+	}
 
-	zlog.Debug().Msgf("Processing file %s with matcher %s", f.name, t.Extension)
+	if processor == nil {
+		if err := checkBinary(f.platform(), p, f.name); err != nil {
+			if owned {
+				os.Remove(p)
+			}
+			return nil, err
+		}
+		file, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		var source io.Reader = file
+		if owned {
+			source = &extractedFile{file}
+		}
+		return &finalFile{Source: source, Name: f.name, PackagePath: f.packagePath, Mode: f.mode, libcErr: checkLibc(f.platform(), p)}, nil
+	}
+
+	if owned {
+		defer os.Remove(p)
+	}
+
+	out, err := processor(f, f.repoName, p)
+	if err != nil {
+		return nil, err
+	}
+
+	companions, err := openCompanions(out.companions)
+	if err != nil {
+		os.Remove(out.path)
+		for _, o := range out.others {
+			o.remove()
+		}
+		return nil, err
+	}
 
-	switch t {
-	case matchers.TypeGz:
-		fmt.Println("TypeGz")
-		processor = f.processGz
-	case matchers.TypeTar:
-		fmt.Println("TypeTar")
-		processor = f.processTar
-	case matchers.TypeXz:
-		fmt.Println("TypeXz")
-		processor = f.processXz
-	case matchers.TypeBz2:
-		fmt.Println("TypeBz2")
-		processor = f.processBz2
-	case matchers.TypeZip:
-		fmt.Println("TypeZip")
-		processor = f.processZip
-	default:
-		fmt.Println("file uncompressed")
-	}
-	// fmt.Printf("filter %+v\n", f)
-
-	if processor != nil {
-		outFile, err := processor(f.repoName, outputFile)
+	// the other files picked from an archive are processed like the first one
+	others := []*finalFile{}
+	for i, o := range out.others {
+		g := *f
+		g.name = o.name
+		g.packagePath = o.packagePath
+		g.mode = o.mode
+		other, err := g.processFile(o.path, true)
 		if err != nil {
+			closeFinalFiles(others)
+			closeCompanions(companions)
+			os.Remove(out.path)
+			for _, o := range out.others[i+1:] {
+				o.remove()
+			}
 			return nil, err
 		}
+		others = append(others, other)
+		others = append(others, other.Others...)
+		other.Others = nil
+	}
 
-		outputFile = outFile.Source
+	f.name = out.name
+	f.packagePath = out.packagePath
+	// the decompressed files keep the mode of the archive entry
+	if out.mode != 0 {
+		f.mode = out.mode
+	}
 
-		f.name = outFile.Name
-		f.packagePath = outFile.PackagePath
+	// In case of e.g. a .tar.gz, process the uncompressed archive by calling recursively
+	final, err := f.processFile(out.path, true)
+	if err != nil {
+		closeFinalFiles(others)
+		closeCompanions(companions)
+		return nil, err
+	}
+	final.Others = append(final.Others, others...)
+	final.Companions = append(final.Companions, companions...)
+	return final, nil
+}
 
-		// In case of e.g. a .tar.gz, process the uncompressed archive by calling recursively
-		return f.processReader(outputFile)
+// openCompanions opens the extracted companion files, the
+// temporary files are removed once their sources are closed.
+func openCompanions(es []*extracted) ([]*Companion, error) {
+	companions := []*Companion{}
+	for i, e := range es {
+		file, err := os.Open(e.path)
+		if err != nil {
+			closeCompanions(companions)
+			for _, e := range es[i:] {
+				os.Remove(e.path)
+			}
+			return nil, err
+		}
+		companions = append(companions, &Companion{Path: e.name, Source: &extractedFile{file}})
 	}
+	return companions, nil
+}
 
-	return &finalFile{Source: outputFile, Name: f.name, PackagePath: f.packagePath}, err
+func closeCompanions(companions []*Companion) {
+	for _, c := range companions {
+		if c, ok := c.Source.(io.Closer); ok {
+			c.Close()
+		}
+	}
 }
 
-// nolint: unused
-func fileToReader(filePath string) (io.Reader, error) {
-	file, err := os.Open(filePath)
+// closeFinalFiles closes the sources of files, which
+// removes the temporary files they're read from.
+func closeFinalFiles(files []*finalFile) {
+	for _, f := range files {
+		if c, ok := f.Source.(io.Closer); ok {
+			c.Close()
+		}
+		closeCompanions(f.Companions)
+	}
+}
+
+// extractToTemp copies r to a temporary file in the temporary directory,
+// where the ones left behind by an interrupted run don't fill the cache.
+func extractToTemp(r io.Reader) (string, error) {
+	tmp, err := os.CreateTemp("", "bin-extract-*")
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// decompress extracts the stream returned by newReader for the file at p.
+func decompress(p string, newReader func(io.Reader) (io.Reader, error)) (string, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return "", err
 	}
 	defer file.Close()
 
-	return file, nil
+	r, err := newReader(file)
+	if err != nil {
+		return "", err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	return extractToTemp(r)
 }
 
 // processGz receives a tar.gz file and returns the
 // correct file for bin to download.
-func (f *Filter) processGz(name string, r io.Reader) (*finalFile, error) {
-	gr, err := gzip.NewReader(r)
+func (f *Filter) processGz(name, p string) (*extracted, error) {
+	var header string
+	tmp, err := decompress(p, func(r io.Reader) (io.Reader, error) {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		header = gr.Name
+		return gr, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return &finalFile{Source: gr, Name: gr.Name}, nil
+	if header == "" {
+		header = decompressedName(f.name)
+	}
+	return &extracted{path: tmp, name: header}, nil
 }
 
-func (f *Filter) processTar(name string, r io.Reader) (*finalFile, error) {
-	tr := tar.NewReader(r)
-	tarFiles := map[string][]byte{}
+// processTar scans the names of the archive entries first, and reads
+// the archive again to extract only the selected one. Symlinks and
+// hardlinks are extracted as the regular file they point to.
+func (f *Filter) processTar(name, p string) (*extracted, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
 	if len(f.opts.PackagePath) > 0 {
 		log.Debugf("Processing tag with PackagePath %s\n", f.opts.PackagePath)
 	}
+
+	// tar.Reader seeks over the content of the entries
+	// it skips, so scanning doesn't read the whole archive
+	entries := newArchiveEntries()
+	tr := tar.NewReader(file)
 	for {
 		header, err := tr.Next()
 		if err == io.EOF {
 			break
 		} else if err != nil {
 			return nil, err
-		} else if header.FileInfo().IsDir() {
+		}
+
+		e := &archiveEntry{name: header.Name, mode: header.FileInfo().Mode(), size: header.Size}
+		switch header.Typeflag {
+		case tar.TypeReg:
+			e.header = readHeader(tr)
+		case tar.TypeSymlink:
+			e.isLink, e.link = true, symlinkTarget(header.Name, header.Linkname)
+		case tar.TypeLink:
+			e.isLink, e.link = true, cleanPath(header.Linkname)
+		default:
 			continue
 		}
+		entries.add(e)
+	}
+
+	names, as := f.entryAssets(entries)
+	if len(as) == 0 {
+		return nil, fmt.Errorf("no files found in tar archive, use -p flag to manually select . PackagePath [%s]", f.opts.PackagePath)
+	}
 
-		if !f.opts.SkipPathCheck && len(f.opts.PackagePath) > 0 && header.Name != f.opts.PackagePath {
+	selected, err := f.selectContents(name, as)
+	if err != nil {
+		return nil, err
+	}
+	companions := f.companionContents(names, selected)
+	sources := entries.sources(append(selected, keys(companions)...))
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	paths := map[string]string{}
+	tr = tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			removeExtracted(paths)
+			return nil, err
+		}
+
+		wanted := sources[header.Name]
+		if len(wanted) == 0 || header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if _, ok := paths[wanted[0]]; ok {
 			continue
 		}
+		if err := extractLinked(tr, wanted, paths); err != nil {
+			removeExtracted(paths)
+			return nil, err
+		}
+	}
 
-		if header.Typeflag == tar.TypeReg {
-			// TODO we're basically reading all the files
-			// isn't there a way just to store the reference
-			// where this data is so we don't have to do this or
-			// re-scan the archive twice afterwards?
-			bs, err := io.ReadAll(tr)
+	return extractedEntries(selected, companions, paths, entries.modes(selected), "tar")
+}
+
+func (f *Filter) processBz2(name, p string) (*extracted, error) {
+	tmp, err := decompress(p, func(r io.Reader) (io.Reader, error) {
+		return bzip2.NewReader(r), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &extracted{path: tmp, name: decompressedName(f.name)}, nil
+}
+
+func (f *Filter) processXz(name, p string) (*extracted, error) {
+	tmp, err := decompress(p, func(r io.Reader) (io.Reader, error) {
+		return xz.NewReader(r, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &extracted{path: tmp, name: decompressedName(f.name)}, nil
+}
+
+func (f *Filter) processZstd(name, p string) (*extracted, error) {
+	tmp, err := decompress(p, func(r io.Reader) (io.Reader, error) {
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &extracted{path: tmp, name: decompressedName(f.name)}, nil
+}
+
+func (f *Filter) processLz4(name, p string) (*extracted, error) {
+	tmp, err := decompress(p, func(r io.Reader) (io.Reader, error) {
+		return lz4.NewReader(r), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &extracted{path: tmp, name: decompressedName(f.name)}, nil
+}
+
+// processZip uses the central directory of the zip file
+// to list its entries and extract only the selected one.
+func (f *Filter) processZip(name, p string) (*extracted, error) {
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	if len(f.opts.PackagePath) > 0 {
+		log.Debugf("Processing tag with PackagePath %s\n", f.opts.PackagePath)
+	}
+
+	zipFiles := map[string]*zip.File{}
+	entries := newArchiveEntries()
+	for _, zf := range zr.File {
+		if zf.Mode().IsDir() {
+			continue
+		}
+
+		e := &archiveEntry{name: zf.Name, mode: zf.Mode(), size: int64(zf.UncompressedSize64)}
+		// the content of symlinks is their target
+		if zf.Mode()&os.ModeSymlink != 0 {
+			target, err := readZipLink(zf)
 			if err != nil {
 				return nil, err
 			}
-			tarFiles[header.Name] = bs
+			e.isLink, e.link = true, symlinkTarget(zf.Name, target)
+		} else if e.header, err = readZipHeader(zf); err != nil {
+			return nil, err
 		}
-	}
-	if len(tarFiles) == 0 {
-		return nil, fmt.Errorf("no files found in tar archive, use -p flag to manually select . PackagePath [%s]", f.opts.PackagePath)
+
+		zipFiles[zf.Name] = zf
+		entries.add(e)
 	}
 
-	as := make([]*Asset, 0)
-	for f := range tarFiles {
-		as = append(as, &Asset{Name: f, URL: ""})
+	names, as := f.entryAssets(entries)
+	if len(as) == 0 {
+		return nil, fmt.Errorf("No files found in zip archive. PackagePath [%s]", f.opts.PackagePath)
 	}
-	choice, err := f.FilterAssetContents(name, as)
+
+	selected, err := f.selectContents(name, as)
 	if err != nil {
 		return nil, err
 	}
-	selectedFile := choice.String()
 
-	tf := tarFiles[selectedFile]
+	companions := f.companionContents(names, selected)
 
-	return &finalFile{Source: bytes.NewReader(tf), Name: filepath.Base(selectedFile), PackagePath: selectedFile}, nil
-}
-
-func (f *Filter) processBz2(name string, r io.Reader) (*finalFile, error) {
-	br := bzip2.NewReader(r)
+	paths := map[string]string{}
+	for source, wanted := range entries.sources(append(selected, keys(companions)...)) {
+		fr, err := zipFiles[source].Open()
+		if err != nil {
+			removeExtracted(paths)
+			return nil, err
+		}
+		err = extractLinked(fr, wanted, paths)
+		fr.Close()
+		if err != nil {
+			removeExtracted(paths)
+			return nil, err
+		}
+	}
 
-	return &finalFile{Source: br, Name: name}, nil
+	// the extracted files are named after the base of the selected
+	// files since archives usually have folders inside
+	return extractedEntries(selected, companions, paths, entries.modes(selected), "zip")
 }
 
-func (f *Filter) processXz(name string, r io.Reader) (*finalFile, error) {
-	xr, err := xz.NewReader(r, 0)
+// readZipHeader returns the start of the content of zf, see readHeader.
+func readZipHeader(zf *zip.File) ([]byte, error) {
+	fr, err := zf.Open()
 	if err != nil {
 		return nil, err
 	}
+	defer fr.Close()
+	return readHeader(fr), nil
+}
 
-	return &finalFile{Source: xr, Name: name}, nil
+// readZipLink returns the target of the zip symlink zf.
+func readZipLink(zf *zip.File) (string, error) {
+	fr, err := zf.Open()
+	if err != nil {
+		return "", err
+	}
+	defer fr.Close()
+	target, err := io.ReadAll(io.LimitReader(fr, 4096))
+	return string(target), err
 }
 
-func (f *Filter) processZip(name string, r io.Reader) (*finalFile, error) {
-	zr := zipstream.NewReader(r)
+// process7z lists the entries of the 7z archive
+// and extracts only the selected one.
+func (f *Filter) process7z(name, p string) (*extracted, error) {
+	zr, err := open7z(p)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
 
-	zipFiles := map[string][]byte{}
 	if len(f.opts.PackagePath) > 0 {
 		log.Debugf("Processing tag with PackagePath %s\n", f.opts.PackagePath)
 	}
-	for {
-		header, err := zr.Next()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return nil, err
-		} else if header.Mode().IsDir() {
+
+	files := map[string]*sevenzip.File{}
+	entries := newArchiveEntries()
+	for _, zf := range zr.File {
+		if zf.Mode().IsDir() {
 			continue
 		}
 
-		if !f.opts.SkipPathCheck && len(f.opts.PackagePath) > 0 && header.Name != f.opts.PackagePath {
+		e := &archiveEntry{name: zf.Name, mode: zf.Mode(), size: int64(zf.UncompressedSize)}
+		// the content of symlinks is their target
+		if zf.Mode()&os.ModeSymlink != 0 {
+			target, err := read7zLink(zf)
+			if err != nil {
+				return nil, err
+			}
+			e.isLink, e.link = true, symlinkTarget(zf.Name, target)
+		} else if !zf.Mode().IsRegular() {
 			continue
+		} else if e.header, err = read7zHeader(zf); err != nil {
+			return nil, err
 		}
 
-		// TODO we're basically reading all the files
-		// isn't there a way just to store the reference
-		// where this data is so we don't have to do this or
-		// re-scan the archive twice afterwards?
-		bs, err := io.ReadAll(zr)
+		files[zf.Name] = zf
+		entries.add(e)
+	}
+
+	names, as := f.entryAssets(entries)
+	if len(as) == 0 {
+		return nil, fmt.Errorf("no files found in 7z archive. PackagePath [%s]", f.opts.PackagePath)
+	}
+
+	selected, err := f.selectContents(name, as)
+	if err != nil {
+		return nil, err
+	}
+
+	companions := f.companionContents(names, selected)
+
+	paths := map[string]string{}
+	for source, wanted := range entries.sources(append(selected, keys(companions)...)) {
+		fr, err := files[source].Open()
+		if err != nil {
+			removeExtracted(paths)
+			return nil, err
+		}
+		err = extractLinked(fr, wanted, paths)
+		fr.Close()
 		if err != nil {
+			removeExtracted(paths)
 			return nil, err
 		}
+	}
+
+	return extractedEntries(selected, companions, paths, entries.modes(selected), "7z")
+}
 
-		zipFiles[header.Name] = bs
+// read7zHeader returns the start of the content of zf, see readHeader.
+func read7zHeader(zf *sevenzip.File) ([]byte, error) {
+	fr, err := zf.Open()
+	if err != nil {
+		return nil, err
 	}
-	if len(zipFiles) == 0 {
-		return nil, fmt.Errorf("No files found in zip archive. PackagePath [%s]", f.opts.PackagePath)
+	defer fr.Close()
+	return readHeader(fr), nil
+}
+
+// read7zLink returns the target of the 7z symlink zf.
+func read7zLink(zf *sevenzip.File) (string, error) {
+	fr, err := zf.Open()
+	if err != nil {
+		return "", err
+	}
+	defer fr.Close()
+	target, err := io.ReadAll(io.LimitReader(fr, 4096))
+	return string(target), err
+}
+
+// open7z opens the 7z archive at p, the reader
+// panics on some malformed archive headers.
+func open7z(p string) (zr *sevenzip.ReadCloser, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("invalid 7z archive: %v", v)
+		}
+	}()
+	return sevenzip.OpenReader(p)
+}
+
+// selectContents selects the files of an archive to extract: the ones
+// picked with globs or interactively, or the single best candidate.
+func (f *Filter) selectContents(repoName string, as []*Asset) ([]string, error) {
+	if len(f.opts.Pick) > 0 {
+		return f.pickContents(as)
 	}
 
-	as := make([]*Asset, 0)
-	for f := range zipFiles {
-		as = append(as, &Asset{Name: f, URL: ""})
+	if f.opts.PickMany {
+		generic := make([]fmt.Stringer, 0, len(as))
+		for _, a := range as {
+			generic = append(generic, options.LiteralStringer(a.Name))
+		}
+		choices, err := options.SelectMany(fmt.Sprintf("Select the files of %s to install", f.name), generic)
+		if err != nil {
+			return nil, err
+		}
+		selected := make([]string, 0, len(choices))
+		for _, c := range choices {
+			selected = append(selected, c.String())
+		}
+		return selected, nil
 	}
-	choice, err := f.FilterAssetContents(name, as)
+
+	choice, err := f.FilterAssetContents(repoName, as)
 	if err != nil {
 		return nil, err
 	}
-	selectedFile := choice.String()
+	return []string{choice.String()}, nil
+}
 
-	fr := bytes.NewReader(zipFiles[selectedFile])
+// pickContents returns the files of as matched by the Pick globs, in
+// the order of the globs, and sorted by name for each glob. Globs match
+// the path of the files or their base name, e.g. both bin/* and protoc
+// match bin/protoc.
+func (f *Filter) pickContents(as []*Asset) ([]string, error) {
+	selected := []string{}
+	for _, pattern := range f.opts.Pick {
+		matches := []string{}
+		for _, a := range as {
+			if MatchPick(pattern, a.Name) {
+				matches = append(matches, a.Name)
+			}
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%q doesn't match any file of %s", pattern, f.name)
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			if !contains(selected, m) {
+				selected = append(selected, m)
+			}
+		}
+	}
+	return selected, nil
+}
+
+// MatchPick tells if the file of an archive at name is
+// picked by pattern, see FilterOpts.Pick.
+func MatchPick(pattern, name string) bool {
+	if pattern == name {
+		return true
+	}
+	name = strings.TrimPrefix(name, "./")
+	pattern = strings.TrimPrefix(pattern, "./")
+	if ok, _ := path.Match(pattern, name); ok {
+		return true
+	}
+	ok, _ := path.Match(pattern, path.Base(name))
+	return ok
+}
 
-	// return base of selected file since tar
-	// files usually have folders inside
-	return &finalFile{Name: filepath.Base(selectedFile), Source: fr, PackagePath: selectedFile}, nil
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// extractedEntries returns the selected files of an archive extracted to
+// paths with their modes, the first one with the others and the companions attached. It
+// fails, and removes the extracted files, if any file hasn't been extracted.
+func extractedEntries(selected []string, companions map[string]string, paths map[string]string, modes map[string]os.FileMode, kind string) (*extracted, error) {
+	var out *extracted
+	for _, name := range selected {
+		p, ok := paths[name]
+		if !ok {
+			removeExtracted(paths)
+			return nil, fmt.Errorf("%s not found in %s archive", name, kind)
+		}
+		e := &extracted{path: p, name: filepath.Base(name), packagePath: name, mode: modes[name]}
+		if out == nil {
+			out = e
+		} else {
+			out.others = append(out.others, e)
+		}
+	}
+	if out == nil {
+		return nil, fmt.Errorf("no files selected in %s archive", kind)
+	}
+
+	for _, name := range keys(companions) {
+		p, ok := paths[name]
+		if !ok {
+			removeExtracted(paths)
+			return nil, fmt.Errorf("%s not found in %s archive", name, kind)
+		}
+		out.companions = append(out.companions, &extracted{path: p, name: companions[name], packagePath: name})
+	}
+	return out, nil
+}
+
+// keys returns the keys of m sorted.
+func keys(m map[string]string) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func removeExtracted(paths map[string]string) {
+	for _, p := range paths {
+		os.Remove(p)
+	}
 }
 
 // isSupportedExt checks if this provider supports
@@ -240,7 +785,8 @@ func isSupportedExt(filename string) bool {
 		case msiType, matchers.TypeDeb, matchers.TypeRpm, ascType:
 			zlog.Trace().Msgf("Filename %s doesn't have a supported extension", filename)
 			return false
-		case matchers.TypeGz, types.Unknown, matchers.TypeZip, matchers.TypeXz, matchers.TypeTar, matchers.TypeBz2, matchers.TypeExe:
+		case matchers.TypeGz, types.Unknown, matchers.TypeZip, matchers.TypeXz, matchers.TypeTar, matchers.TypeBz2, matchers.TypeExe,
+			matchers.TypeZstd, lz4Type, matchers.Type7z:
 			break
 		default:
 			zlog.Trace().Msgf("Filename %s doesn't have a supported extension", filename)
@@ -258,19 +804,20 @@ func (f *Filter) FilterAssetContents(repoName string, as []*Asset) (*FilteredAss
 	matches := []*FilteredAsset{}
 	if len(as) == 1 {
 		a := as[0]
-		matches = append(matches, &FilteredAsset{RepoName: repoName, Name: a.Name, URL: a.URL, score: 0, Size: a.Size, BrowserDownloadURL: a.BrowserDownloadURL})
+		matches = append(matches, &FilteredAsset{RepoName: repoName, Name: a.Name, URL: a.URL, score: 0, mode: a.Mode, elf: a.elf, Size: a.Size, BrowserDownloadURL: a.BrowserDownloadURL})
 	} else {
 		if !f.opts.SkipScoring {
 			scores := map[string]int{}
 			scoreKeys := []string{}
 			scores[repoName] = 1
-			for _, os := range resolver.GetOS() {
+			r := f.platform()
+			for _, os := range r.GetOS() {
 				scores[os] = 10
 			}
-			for _, arch := range resolver.GetArch() {
+			for _, arch := range r.GetArch() {
 				scores[arch] = 5
 			}
-			for _, osSpecificExtension := range resolver.GetOSSpecificExtensions() {
+			for _, osSpecificExtension := range r.GetOSSpecificExtensions() {
 				scores[osSpecificExtension] = 15
 			}
 
@@ -280,13 +827,14 @@ func (f *Filter) FilterAssetContents(repoName string, as []*Asset) (*FilteredAss
 
 			for _, a := range as {
 				highestScoreForAsset := 0
-				gf := &FilteredAsset{RepoName: repoName, Name: a.Name, DisplayName: a.DisplayName, URL: a.URL, score: 0, Size: a.Size, BrowserDownloadURL: a.BrowserDownloadURL}
+				gf := &FilteredAsset{RepoName: repoName, Name: a.Name, DisplayName: a.DisplayName, URL: a.URL, score: 0, mode: a.Mode, elf: a.elf, Size: a.Size, BrowserDownloadURL: a.BrowserDownloadURL}
 				for _, candidate := range []string{a.Name} {
 					candidateScore := 0
-					if bstrings.ContainsAny(strings.ToLower(candidate), scoreKeys) &&
-						isSupportedExt(candidate) {
+					name, foreign := stripForeignArch(r, candidate)
+					if bstrings.ContainsAny(name, scoreKeys) && isSupportedExt(candidate) &&
+						!forForeignArch(r, name, foreign) {
 						for toMatch, score := range scores {
-							if strings.Contains(strings.ToLower(candidate), strings.ToLower(toMatch)) {
+							if strings.Contains(name, strings.ToLower(toMatch)) {
 								candidateScore += score
 							}
 						}
@@ -298,7 +846,8 @@ func (f *Filter) FilterAssetContents(repoName string, as []*Asset) (*FilteredAss
 					}
 				}
 
-				if highestScoreForAsset > 0 {
+				// ELF binaries are candidates whatever their name, e.g. rg in ripgrep
+				if highestScoreForAsset > 0 || gf.elf != nil {
 					matches = append(matches, gf)
 				}
 			}
@@ -336,6 +885,24 @@ func (f *Filter) FilterAssetContents(repoName string, as []*Asset) (*FilteredAss
 					matches[i].score = matches[i].score + 1
 				}
 
+				// the executable bits of the archive entries, if any, tell the binary
+				// from e.g. its config files or scripts meant to be sourced
+				if matches[i].score > 0 && matches[i].mode&0o111 != 0 {
+					matches[i].score = matches[i].score + 1
+				}
+
+				// the ELF header beats the name heuristics, binaries for the target
+				// are preferred over e.g. autocomplete/bat.bash, and binaries for
+				// another platform are never the one
+				if h := matches[i].elf; h != nil {
+					if err := h.checkTarget(target(f.platform())); err != nil {
+						zlog.Debug().Msgf("Ignoring %s: %v", matches[i].Name, err)
+						matches[i].score = 0
+					} else {
+						matches[i].score = max(matches[i].score, 0) + elfScore
+					}
+				}
+
 				if matches[i].score > highestAssetScore {
 					highestAssetScore = matches[i].score
 				}
@@ -0,0 +1,303 @@
+package assets
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+func tarGz(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	return gz(t, tarArchive(t, files))
+}
+
+func tarArchive(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for name, data := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o755, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	return buf.Bytes()
+}
+
+func zipArchive(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func gz(t *testing.T, data []byte) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	gw := gzip.NewWriter(buf)
+	if _, err := gw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	gw.Close()
+	return buf.Bytes()
+}
+
+// sevenZip builds a 7z archive storing the files uncompressed,
+// the entries are written in the order of names.
+func sevenZip(t *testing.T, names []string, files map[string][]byte) []byte {
+	t.Helper()
+	packed := new(bytes.Buffer)
+	for _, n := range names {
+		packed.Write(files[n])
+	}
+
+	h := new(bytes.Buffer)
+	h.Write([]byte{0x01, 0x04})                                       // header, main streams info
+	h.Write([]byte{0x06, 0x00, 0x01, 0x09, byte(packed.Len()), 0x00}) // pack info
+	h.Write([]byte{0x07, 0x0b, 0x01, 0x00, 0x01, 0x01, 0x00})         // one folder with the copy coder
+	h.Write([]byte{0x0c, byte(packed.Len()), 0x00})
+	h.Write([]byte{0x08, 0x0d, byte(len(names)), 0x09}) // substreams
+	for _, n := range names[:len(names)-1] {
+		h.WriteByte(byte(len(files[n])))
+	}
+	h.Write([]byte{0x0a, 0x01}) // all the digests are defined
+	for _, n := range names {
+		_ = binary.Write(h, binary.LittleEndian, crc32.ChecksumIEEE(files[n]))
+	}
+	h.Write([]byte{0x00, 0x00})
+
+	var utf16 []byte
+	for _, n := range names {
+		for _, r := range n {
+			utf16 = append(utf16, byte(r), 0)
+		}
+		utf16 = append(utf16, 0, 0)
+	}
+	h.Write([]byte{0x05, byte(len(names)), 0x11, byte(len(utf16) + 1), 0x00}) // files info
+	h.Write(utf16)
+	h.Write([]byte{0x00, 0x00})
+
+	start := make([]byte, 20)
+	binary.LittleEndian.PutUint64(start, uint64(packed.Len()))
+	binary.LittleEndian.PutUint64(start[8:], uint64(h.Len()))
+	binary.LittleEndian.PutUint32(start[16:], crc32.ChecksumIEEE(h.Bytes()))
+
+	out := new(bytes.Buffer)
+	out.Write([]byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c, 0x00, 0x04})
+	_ = binary.Write(out, binary.LittleEndian, crc32.ChecksumIEEE(start))
+	out.Write(start)
+	out.Write(packed.Bytes())
+	out.Write(h.Bytes())
+	return out.Bytes()
+}
+
+func zst(t *testing.T, data []byte) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	zw, err := zstd.NewWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func lz4Compress(t *testing.T, data []byte) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	lw := lz4.NewWriter(buf)
+	if _, err := lw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	lw.Close()
+	return buf.Bytes()
+}
+
+func TestProcessFile(t *testing.T) {
+	resolver = testLinuxAMDResolver
+	binary := []byte("\x7fELF binary")
+	contents := map[string][]byte{
+		"bin_linux_amd64/bin":       binary,
+		"bin_linux_amd64/README.md": []byte("# bin"),
+	}
+
+	cases := []struct {
+		name        string
+		data        []byte
+		out         string
+		packagePath string
+	}{
+		{"bin_0.1.0_linux_amd64.tar.gz", tarGz(t, contents), "bin", "bin_linux_amd64/bin"},
+		{"bin_0.1.0_linux_amd64.zip", zipArchive(t, contents), "bin", "bin_linux_amd64/bin"},
+		{"bin_0.1.0_linux_amd64.gz", gz(t, binary), "bin_0.1.0_linux_amd64", ""},
+		{"bin_0.1.0_linux_amd64", binary, "bin_0.1.0_linux_amd64", ""},
+		{"bin_0.1.0_linux_amd64.tgz", tarGz(t, contents), "bin", "bin_linux_amd64/bin"},
+		{"bin_0.1.0_linux_amd64.tar.zst", zst(t, tarArchive(t, contents)), "bin", "bin_linux_amd64/bin"},
+		{"bin_0.1.0_linux_amd64.zst", zst(t, binary), "bin_0.1.0_linux_amd64", ""},
+		{"bin_0.1.0_linux_amd64.tar.lz4", lz4Compress(t, tarArchive(t, contents)), "bin", "bin_linux_amd64/bin"},
+		{"bin_0.1.0_linux_amd64.lz4", lz4Compress(t, binary), "bin_0.1.0_linux_amd64", ""},
+		{"bin_0.1.0_linux_amd64.7z", sevenZip(t, []string{"bin_linux_amd64/README.md", "bin_linux_amd64/bin"}, contents), "bin", "bin_linux_amd64/bin"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("TMPDIR", dir)
+			p := filepath.Join(dir, c.name)
+			if err := os.WriteFile(p, c.data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			f := InitFilter("bin", c.name, "", &FilterOpts{})
+			out, err := f.processFile(p, false)
+			if err != nil {
+				t.Fatalf("Error processing %s: %v", c.name, err)
+			}
+			if out.Name != c.out || out.PackagePath != c.packagePath {
+				t.Fatalf("Expected %s (%s), got %s (%s)", c.out, c.packagePath, out.Name, out.PackagePath)
+			}
+
+			bs, err := io.ReadAll(out.Source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(bs, binary) {
+				t.Fatalf("Expected %q, got %q", binary, bs)
+			}
+			if c, ok := out.Source.(io.Closer); ok {
+				c.Close()
+			}
+
+			// only the downloaded asset is left once the binary is read
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != 1 {
+				t.Fatalf("Expected temporary files to be removed, found %d files", len(entries))
+			}
+		})
+	}
+}
+
+func TestProcessTarPackagePath(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	p := filepath.Join(dir, "tools.tar.gz")
+	data := tarGz(t, map[string][]byte{"tools/a": []byte("a"), "tools/b": []byte("b")})
+	if err := os.WriteFile(p, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	f := InitFilter("tools", "tools.tar.gz", "", &FilterOpts{PackagePath: "tools/b"})
+	out, err := f.processFile(p, false)
+	if err != nil {
+		t.Fatalf("Error processing archive: %v", err)
+	}
+	defer out.Source.(io.Closer).Close()
+
+	if bs, _ := io.ReadAll(out.Source); string(bs) != "b" {
+		t.Fatalf("Expected tools/b to be extracted, got %q", bs)
+	}
+}
+
+func TestProcessFilePick(t *testing.T) {
+	contents := map[string][]byte{
+		"tools/bin/a":    []byte("a"),
+		"tools/bin/b":    []byte("b"),
+		"tools/README":   []byte("# tools"),
+		"tools/lib/c.so": []byte("c"),
+	}
+
+	cases := []struct {
+		name string
+		data []byte
+		pick []string
+		out  []string
+	}{
+		{"tools.tar.gz", tarGz(t, contents), []string{"tools/bin/*"}, []string{"a", "b"}},
+		{"tools.zip", zipArchive(t, contents), []string{"tools/bin/*"}, []string{"a", "b"}},
+		{"tools.tar.gz", tarGz(t, contents), []string{"b", "a"}, []string{"b", "a"}},
+		{"tools.zip", zipArchive(t, contents), []string{"tools/bin/b", "b"}, []string{"b"}},
+		{"tools.tar.gz", tarGz(t, contents), []string{"a", "missing"}, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("TMPDIR", dir)
+			p := filepath.Join(dir, c.name)
+			if err := os.WriteFile(p, c.data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			f := InitFilter("tools", c.name, "", &FilterOpts{Pick: c.pick})
+			out, err := f.processFile(p, false)
+			if c.out == nil {
+				if err == nil {
+					t.Fatalf("Expected an error picking %v", c.pick)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Error processing archive: %v", err)
+				}
+
+				files := append([]*finalFile{out}, out.Others...)
+				if len(files) != len(c.out) {
+					t.Fatalf("Expected %d files, got %d", len(c.out), len(files))
+				}
+				for i, file := range files {
+					bs, _ := io.ReadAll(file.Source)
+					if file.Name != c.out[i] || file.PackagePath != "tools/bin/"+c.out[i] || string(bs) != c.out[i] {
+						t.Fatalf("Expected %s, got %s (%s) with %q", c.out[i], file.Name, file.PackagePath, bs)
+					}
+				}
+				closeFinalFiles(files)
+			}
+
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != 1 {
+				t.Fatalf("Expected temporary files to be removed, found %d files", len(entries))
+			}
+		})
+	}
+}
+
+func TestDecompressedName(t *testing.T) {
+	cases := map[string]string{
+		"bin_linux_amd64.tgz":     "bin_linux_amd64.tar",
+		"bin_linux_amd64.TXZ":     "bin_linux_amd64.tar",
+		"bin_linux_amd64.tar.zst": "bin_linux_amd64.tar",
+		"bin_linux_amd64.gz":      "bin_linux_amd64",
+		"bin_linux_amd64.lz4":     "bin_linux_amd64",
+		"bin_linux_amd64.zip":     "bin_linux_amd64.zip",
+	}
+	for name, expected := range cases {
+		if got := decompressedName(name); got != expected {
+			t.Errorf("decompressedName(%q) = %q, expected %q", name, got, expected)
+		}
+	}
+}
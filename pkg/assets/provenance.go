@@ -0,0 +1,340 @@
+// provenance.go
+//
+// verify SLSA provenance (<asset>.intoto.jsonl, multiple.intoto.jsonl) and GitHub artifact
+// attestations against the digest of the downloaded asset and the provenance policy
+package assets
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dfang/bin/pkg/config"
+	zlog "github.com/rs/zerolog/log"
+)
+
+const inTotoPayloadType = "application/vnd.in-toto+json"
+
+// inTotoStatement is an in-toto attestation statement, v0.1 or v1.
+type inTotoStatement struct {
+	Type          string `json:"_type"`
+	PredicateType string `json:"predicateType"`
+	Subject       []struct {
+		Name   string            `json:"name"`
+		Digest map[string]string `json:"digest"`
+	} `json:"subject"`
+	Predicate slsaPredicate `json:"predicate"`
+}
+
+// slsaPredicate holds the fields of SLSA provenance v0.2 and v1
+// predicates needed to check where and how an asset was built.
+type slsaPredicate struct {
+	// v0.2
+	Builder struct {
+		ID string `json:"id"`
+	} `json:"builder"`
+	Invocation struct {
+		ConfigSource struct {
+			URI    string            `json:"uri"`
+			Digest map[string]string `json:"digest"`
+		} `json:"configSource"`
+	} `json:"invocation"`
+
+	// v1
+	BuildDefinition struct {
+		ExternalParameters struct {
+			Workflow struct {
+				Ref        string `json:"ref"`
+				Repository string `json:"repository"`
+			} `json:"workflow"`
+		} `json:"externalParameters"`
+		ResolvedDependencies []struct {
+			URI    string            `json:"uri"`
+			Digest map[string]string `json:"digest"`
+		} `json:"resolvedDependencies"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+	} `json:"runDetails"`
+}
+
+// provenanceEnvelope is a DSSE envelope found in the release or in the GitHub
+// attestations, with the certificates of the Sigstore bundle it came in, if any.
+type provenanceEnvelope struct {
+	source   string
+	envelope *dsseEnvelope
+	material *sigstoreMaterial
+}
+
+// NormalizeRepo turns the different ways a source repository is referenced
+// (git+https://github.com/owner/repo.git, https://github.com/owner/repo, ...)
+// into github.com/owner/repo.
+func NormalizeRepo(repo string) string {
+	repo = strings.TrimPrefix(repo, "git+")
+	repo = strings.TrimPrefix(strings.TrimPrefix(repo, "https://"), "http://")
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSuffix(repo, "/"), ".git"))
+}
+
+// summary extracts the builder and source information from the statement.
+func (s *inTotoStatement) summary() *config.Provenance {
+	p := &config.Provenance{PredicateType: s.PredicateType}
+	pr := s.Predicate
+
+	if pr.RunDetails.Builder.ID != "" {
+		p.BuilderID = pr.RunDetails.Builder.ID
+		w := pr.BuildDefinition.ExternalParameters.Workflow
+		p.SourceRepo, p.SourceRef = NormalizeRepo(w.Repository), w.Ref
+		for _, d := range pr.BuildDefinition.ResolvedDependencies {
+			uri, ref, _ := strings.Cut(d.URI, "@")
+			if p.SourceRepo == "" {
+				p.SourceRepo, p.SourceRef = NormalizeRepo(uri), ref
+			}
+			if NormalizeRepo(uri) == p.SourceRepo {
+				p.SourceDigest = d.Digest["gitCommit"]
+				break
+			}
+		}
+		return p
+	}
+
+	p.BuilderID = pr.Builder.ID
+	uri, ref, _ := strings.Cut(pr.Invocation.ConfigSource.URI, "@")
+	p.SourceRepo, p.SourceRef = NormalizeRepo(uri), ref
+	p.SourceDigest = pr.Invocation.ConfigSource.Digest["sha1"]
+	return p
+}
+
+// checkProvenancePolicy checks the builder and source of the provenance against the policy.
+func checkProvenancePolicy(policy *config.ProvenancePolicy, p *config.Provenance) error {
+	if want := NormalizeRepo(policy.SourceRepo); p.SourceRepo != want {
+		return fmt.Errorf("built from %q, expected %q", p.SourceRepo, want)
+	}
+	if policy.SourceRef != "" {
+		if ok, err := path.Match(policy.SourceRef, p.SourceRef); err != nil || !ok {
+			return fmt.Errorf("built from ref %q, expected %q", p.SourceRef, policy.SourceRef)
+		}
+	}
+	if policy.BuilderID != "" && p.BuilderID != policy.BuilderID && !strings.HasPrefix(p.BuilderID, policy.BuilderID+"@") {
+		return fmt.Errorf("built by %q, expected %q", p.BuilderID, policy.BuilderID)
+	}
+	return nil
+}
+
+// dssePAE is the pre-authentication encoding signed by DSSE signatures.
+func dssePAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// signerPolicy returns the policy the provenance signer is checked against. If no
+// identity is configured, the signing certificate must have been issued to the
+// builder or to a workflow of the source repository.
+func signerPolicy(policy *config.ProvenancePolicy) *config.CosignPolicy {
+	signer := policy.Signer
+	if signer.Key == "" && signer.Identity == "" {
+		ids := []string{regexp.QuoteMeta("https://"+NormalizeRepo(policy.SourceRepo)+"/") + ".*"}
+		if policy.BuilderID != "" {
+			ids = append(ids, regexp.QuoteMeta(policy.BuilderID)+"(@.*)?")
+		}
+		signer.Identity = strings.Join(ids, "|")
+		signer.IdentityRegexp = true
+	}
+	return &signer
+}
+
+// verifyEnvelope verifies the DSSE signatures of the envelope and
+// returns the identity of the signer.
+func verifyEnvelope(signer *config.CosignPolicy, e *provenanceEnvelope, payload []byte) (string, error) {
+	pae := &signedFile{name: e.source, data: dssePAE(e.envelope.PayloadType, payload)}
+	digest, err := sha256File(pae)
+	if err != nil {
+		return "", err
+	}
+
+	var pub crypto.PublicKey
+	id := signer.Key
+	if signer.Key != "" {
+		if pub, err = loadPublicKey(signer.Key); err != nil {
+			return "", err
+		}
+	} else {
+		if e.material == nil || len(e.material.certs) == 0 {
+			return "", fmt.Errorf("no signing certificate found, configure a key to verify %s offline", e.source)
+		}
+		if pub, err = verifyCertificate(signer, e.material); err != nil {
+			return "", err
+		}
+		id = strings.Join(certificateIdentities(e.material.certs[0]), ",")
+	}
+
+	for _, s := range e.envelope.Signatures {
+		sig, err := decodeBase64(s.Sig)
+		if err != nil {
+			continue
+		}
+		if verifyBlobSignature(pub, pae, digest, sig) == nil {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("invalid envelope signature")
+}
+
+// dsseSignatureWithCert is a DSSE signature carrying its signing
+// certificate, as written by some in-toto implementations.
+type dsseSignatureWithCert struct {
+	Signatures []struct {
+		Cert string `json:"cert"`
+	} `json:"signatures"`
+}
+
+// parseProvenanceLine parses a line of a .jsonl file, either a bare DSSE
+// envelope or a Sigstore bundle wrapping one.
+func parseProvenanceLine(source string, line []byte) (*provenanceEnvelope, error) {
+	b, m, err := parseSigstoreBundle(line)
+	if err == nil && b.DSSEEnvelope != nil {
+		return &provenanceEnvelope{source: source, envelope: b.DSSEEnvelope, material: m}, nil
+	}
+
+	var e dsseEnvelope
+	if err := json.Unmarshal(line, &e); err != nil {
+		return nil, err
+	}
+	if e.PayloadType == "" {
+		return nil, fmt.Errorf("not a DSSE envelope")
+	}
+
+	pe := &provenanceEnvelope{source: source, envelope: &e}
+	var withCert dsseSignatureWithCert
+	if json.Unmarshal(line, &withCert) == nil {
+		for _, s := range withCert.Signatures {
+			if s.Cert == "" {
+				continue
+			}
+			if certs, err := parseCertificates([]byte(s.Cert)); err == nil {
+				pe.material = &sigstoreMaterial{certs: certs}
+				break
+			}
+		}
+	}
+	return pe, nil
+}
+
+// provenanceEnvelopes collects the provenance published in the release for the asset
+// and the attestations of its digest, when the provider supports them.
+func (f *Filter) provenanceEnvelopes(name, digest string) ([]*provenanceEnvelope, error) {
+	candidates := []*Asset{}
+	for _, ext := range []string{".intoto.jsonl", ".sigstore.json", ".sigstore"} {
+		if a := f.findSignatureAsset(name, ext); a != nil {
+			candidates = append(candidates, a)
+		}
+	}
+	for _, a := range f.assets {
+		if strings.HasSuffix(a.Name, ".intoto.jsonl") && a.Name != name+".intoto.jsonl" {
+			candidates = append(candidates, a)
+		}
+	}
+
+	res := []*provenanceEnvelope{}
+	for _, a := range candidates {
+		bs, err := f.auxiliaryFile(a)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(bs))
+		scanner.Buffer(make([]byte, 0, 64*1024), maxChecksumFileSize)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			e, err := parseProvenanceLine(a.Name, line)
+			if err != nil {
+				zlog.Debug().Err(err).Msgf("Skipping invalid provenance in %s", a.Name)
+				continue
+			}
+			res = append(res, e)
+		}
+	}
+
+	if f.opts.Attestations != nil {
+		bundles, err := f.opts.Attestations(digest)
+		if err != nil {
+			zlog.Debug().Err(err).Msgf("Could not fetch the attestations of %s", name)
+		}
+		for _, b := range bundles {
+			if e, err := parseProvenanceLine("attestations", b); err == nil {
+				res = append(res, e)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// verifyProvenance looks for a provenance statement about the downloaded asset, checks
+// its signature and that the asset was built from the expected source by the expected
+// builder. The verified provenance summary is returned to be recorded in the config.
+func (f *Filter) verifyProvenance(policy *config.ProvenancePolicy, file *signedFile) (*config.Provenance, error) {
+	d, err := sha256File(file)
+	if err != nil {
+		return nil, err
+	}
+	digest := hex.EncodeToString(d)
+
+	envelopes, err := f.provenanceEnvelopes(file.name, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := signerPolicy(policy)
+	for _, e := range envelopes {
+		if e.envelope.PayloadType != inTotoPayloadType {
+			continue
+		}
+		payload, err := decodeBase64(e.envelope.Payload)
+		if err != nil {
+			continue
+		}
+		var st inTotoStatement
+		if err := json.Unmarshal(payload, &st); err != nil {
+			continue
+		}
+
+		matches := false
+		for _, s := range st.Subject {
+			if strings.EqualFold(s.Digest["sha256"], digest) {
+				matches = true
+			}
+		}
+		if !matches {
+			continue
+		}
+
+		id, err := verifyEnvelope(signer, e, payload)
+		if err != nil {
+			return nil, signatureError(file.name, "provenance from %s: %v", e.source, err)
+		}
+
+		summary := st.summary()
+		if err := checkProvenancePolicy(policy, summary); err != nil {
+			return nil, signatureError(file.name, "provenance from %s: %v", e.source, err)
+		}
+
+		summary.Subject = "sha256:" + digest
+		summary.Source = e.source
+		summary.Signer = id
+		summary.VerifiedAt = time.Now().UTC()
+		zlog.Info().Msgf("Provenance of %s verified, built from %s@%s by %s", file.name, summary.SourceRepo, summary.SourceRef, summary.BuilderID)
+		return summary, nil
+	}
+
+	return nil, fmt.Errorf("%w: no provenance found for %s (sha256:%s)", ErrSignatureNotFound, file.name, digest)
+}
@@ -0,0 +1,145 @@
+package assets
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/dfang/bin/pkg/config"
+)
+
+const testBuilder = "https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml"
+
+// slsaEnvelope returns a DSSE envelope of a SLSA v0.2 provenance for
+// digest, built from repo at ref and signed with key.
+func slsaEnvelope(t *testing.T, key *ecdsa.PrivateKey, digest, repo, ref string) map[string]interface{} {
+	t.Helper()
+	payload, _ := json.Marshal(map[string]interface{}{
+		"_type":         "https://in-toto.io/Statement/v0.1",
+		"predicateType": "https://slsa.dev/provenance/v0.2",
+		"subject":       []map[string]interface{}{{"name": "bin", "digest": map[string]string{"sha256": digest}}},
+		"predicate": map[string]interface{}{
+			"builder": map[string]string{"id": testBuilder + "@refs/tags/v1.9.0"},
+			"invocation": map[string]interface{}{
+				"configSource": map[string]interface{}{
+					"uri":    "git+https://" + repo + "@" + ref,
+					"digest": map[string]string{"sha1": "0123456789abcdef0123456789abcdef01234567"},
+				},
+			},
+		},
+	})
+	pae := sha256.Sum256(dssePAE(inTotoPayloadType, payload))
+	sig, _ := ecdsa.SignASN1(rand.Reader, key, pae[:])
+	return map[string]interface{}{
+		"payloadType": inTotoPayloadType,
+		"payload":     base64.StdEncoding.EncodeToString(payload),
+		"signatures":  []map[string]string{{"sig": base64.StdEncoding.EncodeToString(sig)}},
+	}
+}
+
+func TestVerifyProvenance(t *testing.T) {
+	data := []byte("#!/bin/sh\necho bin\n")
+	d := sha256.Sum256(data)
+	digest := hex.EncodeToString(d[:])
+	name := "bin_0.1.0_linux_amd64"
+	assetPath := writeTempFile(t, name, data)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	pubDER, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	pubKey := writePEM(t, "provenance.pub", "PUBLIC KEY", pubDER)
+
+	caDER, leaf, leafKey := newTestCA(t, testIdentity)
+	trustedRoot := writePEM(t, "root.pem", "CERTIFICATE", caDER)
+
+	envelope := func(k *ecdsa.PrivateKey, digest, ref string) []byte {
+		bs, _ := json.Marshal(slsaEnvelope(t, k, digest, "github.com/dfang/bin", ref))
+		return bs
+	}
+	bundle, _ := json.Marshal(map[string]interface{}{
+		"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json",
+		"verificationMaterial": map[string]interface{}{
+			"certificate": map[string]string{"rawBytes": base64.StdEncoding.EncodeToString(leaf.Raw)},
+		},
+		"dsseEnvelope": slsaEnvelope(t, leafKey, digest, "github.com/dfang/bin", "refs/tags/v0.1.0"),
+	})
+
+	keyed := config.ProvenancePolicy{SourceRepo: "github.com/dfang/bin", Signer: config.CosignPolicy{Key: pubKey}}
+	cases := []struct {
+		name         string
+		files        map[string][]byte
+		attestations [][]byte
+		policy       config.ProvenancePolicy
+		err          error
+	}{
+		{
+			name:   "provenance of the asset",
+			files:  map[string][]byte{name + ".intoto.jsonl": envelope(key, digest, "refs/tags/v0.1.0")},
+			policy: keyed,
+		},
+		{
+			name: "provenance covering several assets",
+			files: map[string][]byte{"multiple.intoto.jsonl": append(append(
+				envelope(key, "deadbeef", "refs/tags/v0.1.0"), '\n'), envelope(key, digest, "refs/tags/v0.1.0")...)},
+			policy: config.ProvenancePolicy{SourceRepo: "https://github.com/dfang/bin", SourceRef: "refs/tags/*", BuilderID: testBuilder, Signer: keyed.Signer},
+		},
+		{
+			name:   "provenance of another repository",
+			files:  map[string][]byte{name + ".intoto.jsonl": envelope(key, digest, "refs/tags/v0.1.0")},
+			policy: config.ProvenancePolicy{SourceRepo: "github.com/evil/bin", Signer: keyed.Signer},
+			err:    ErrSignatureMismatch,
+		},
+		{
+			name:   "provenance of another ref",
+			files:  map[string][]byte{name + ".intoto.jsonl": envelope(key, digest, "refs/heads/main")},
+			policy: config.ProvenancePolicy{SourceRepo: "github.com/dfang/bin", SourceRef: "refs/tags/*", Signer: keyed.Signer},
+			err:    ErrSignatureMismatch,
+		},
+		{
+			name:   "provenance signed with another key",
+			files:  map[string][]byte{name + ".intoto.jsonl": envelope(leafKey, digest, "refs/tags/v0.1.0")},
+			policy: keyed,
+			err:    ErrSignatureMismatch,
+		},
+		{
+			name:   "provenance of other content",
+			files:  map[string][]byte{name + ".intoto.jsonl": envelope(key, "deadbeef", "refs/tags/v0.1.0")},
+			policy: keyed,
+			err:    ErrSignatureNotFound,
+		},
+		{
+			name:         "attestation bundle",
+			files:        map[string][]byte{"checksums.txt": []byte("")},
+			attestations: [][]byte{bundle},
+			policy: config.ProvenancePolicy{SourceRepo: "github.com/dfang/bin", SourceRef: "refs/tags/v*",
+				Signer: config.CosignPolicy{Issuer: testIssuer, TrustedRoot: trustedRoot}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			policy := c.policy
+			f := NewFilter(&FilterOpts{
+				Verification: &config.Verification{Provenance: &policy},
+				Attestations: func(string) ([][]byte, error) { return c.attestations, nil },
+			})
+			f.assets = serveFiles(t, c.files)
+			p, err := f.verifySignatures(&FilteredAsset{Name: name}, assetPath, nil)
+			if c.err == nil && err != nil {
+				t.Fatalf("Error verifying provenance: %v", err)
+			}
+			if c.err != nil && !errors.Is(err, c.err) {
+				t.Fatalf("Expected error %v, got %v", c.err, err)
+			}
+			if c.err == nil && p.SourceRepo != "github.com/dfang/bin" {
+				t.Fatalf("Expected source repo github.com/dfang/bin, got %s", p.SourceRepo)
+			}
+		})
+	}
+}
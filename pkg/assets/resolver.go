@@ -15,14 +15,54 @@ func (runtimeResolver) GetArch() []string {
 	return config.GetArch()
 }
 
+func (runtimeResolver) GetForeignArch() []string {
+	return config.GetForeignArch()
+}
+
 func (runtimeResolver) GetOSSpecificExtensions() []string {
 	return config.GetOSSpecificExtensions()
 }
 
+func (runtimeResolver) GetLibc() *libc {
+	return detectLibc()
+}
+
+// targetResolver resolves the platform binaries are installed for
+// when it isn't the one bin runs on, its libc is unknown.
+type targetResolver struct {
+	platform *config.Platform
+}
+
+func (t targetResolver) GetOS() []string {
+	return config.OSAliases(t.platform.OS)
+}
+
+func (t targetResolver) GetArch() []string {
+	return config.ArchAliases(t.platform.Arch, t.platform.Variant)
+}
+
+func (t targetResolver) GetForeignArch() []string {
+	return config.ForeignArchAliases(t.platform.Arch, t.platform.Variant)
+}
+
+func (t targetResolver) GetOSSpecificExtensions() []string {
+	return config.OSSpecificExtensions(t.platform.OS)
+}
+
+func (targetResolver) GetLibc() *libc {
+	return nil
+}
+
+// resolver resolves the platform bin runs on
 var resolver platformResolver = runtimeResolver{}
 
 type platformResolver interface {
 	GetOS() []string
 	GetArch() []string
+	// GetForeignArch returns the names of the architectures the target can't
+	// run, longest first. The assets only named after them are skipped
+	GetForeignArch() []string
 	GetOSSpecificExtensions() []string
+	// GetLibc returns the libc of the target, nil if unknown or not Linux
+	GetLibc() *libc
 }
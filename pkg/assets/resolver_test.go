@@ -0,0 +1,85 @@
+package assets
+
+import (
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dfang/bin/pkg/config"
+)
+
+func TestFilterAssetsPlatform(t *testing.T) {
+	// the host is linux/amd64, the binaries are installed for another platform
+	resolver = testLinuxAMDResolver
+	as := []*Asset{
+		{Name: "tool_1.0.0_darwin_arm64.tar.gz"},
+		{Name: "tool_1.0.0_linux_amd64.tar.gz"},
+		{Name: "tool_1.0.0_linux_arm64.tar.gz"},
+		{Name: "tool_1.0.0_linux_armv7.tar.gz"},
+		{Name: "tool_1.0.0_windows_amd64.zip"},
+	}
+
+	cases := []struct {
+		platform *config.Platform
+		out      string
+	}{
+		{nil, "tool_1.0.0_linux_amd64.tar.gz"},
+		{&config.Platform{OS: "linux", Arch: "arm64"}, "tool_1.0.0_linux_arm64.tar.gz"},
+		{&config.Platform{OS: "linux", Arch: "arm", Variant: "7"}, "tool_1.0.0_linux_armv7.tar.gz"},
+		{&config.Platform{OS: "darwin", Arch: "arm64"}, "tool_1.0.0_darwin_arm64.tar.gz"},
+		{&config.Platform{OS: "windows", Arch: "amd64"}, "tool_1.0.0_windows_amd64.zip"},
+	}
+
+	for _, c := range cases {
+		f := NewFilter(&FilterOpts{Platform: c.platform})
+		gf, err := f.FilterAssets("tool", as)
+		if err != nil {
+			t.Fatalf("Error filtering assets for %v: %v", c.platform, err)
+		}
+		if gf.Name != c.out {
+			t.Fatalf("Expected %s for %v, got %s", c.out, c.platform, gf.Name)
+		}
+	}
+}
+
+func TestProcessFilePlatform(t *testing.T) {
+	resolver = testLinuxAMDResolver
+	arm64 := elfBinary(elfPlatforms["arm64"], elf.ELFOSABI_NONE)
+	amd64 := elfBinary(elfPlatforms["amd64"], elf.ELFOSABI_NONE)
+	platform := &config.Platform{OS: "linux", Arch: "arm64"}
+
+	cases := []struct {
+		data []byte
+		out  string
+		ok   bool
+	}{
+		{tarGz(t, map[string][]byte{"tool-arm64/tool": arm64, "tool-amd64/tool": amd64}), "tool-arm64/tool", true},
+		{tarGz(t, map[string][]byte{"tool/tool": amd64}), "", false},
+	}
+
+	for _, c := range cases {
+		dir := t.TempDir()
+		t.Setenv("TMPDIR", dir)
+		p := filepath.Join(dir, "tool.tar.gz")
+		if err := os.WriteFile(p, c.data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		f := InitFilter("tool", "tool.tar.gz", "", &FilterOpts{Platform: platform})
+		out, err := f.processFile(p, false)
+		if !c.ok {
+			if err == nil {
+				t.Fatalf("Expected an amd64 binary to be refused for %s, got %s", platform, out.PackagePath)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Error processing archive for %s: %v", platform, err)
+		}
+		closeFinalFiles([]*finalFile{out})
+		if out.PackagePath != c.out {
+			t.Fatalf("Expected %s for %s, got %s", c.out, platform, out.PackagePath)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// signature.go
+//
+// verify the signatures published alongside the release before the downloaded asset is processed
+package assets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dfang/bin/pkg/config"
+)
+
+var (
+	ErrSignatureNotFound = errors.New("no signature found")
+	ErrSignatureMismatch = errors.New("signature verification failed")
+)
+
+// signatureExts are the extensions of the files holding the signature of an asset
+// or the material needed to verify it.
+var signatureExts = []string{
+	".sig",
+	".minisig",
+	".asc",
+	".gpg",
+	".pem",
+	".cert",
+	".sigstore",
+	".sigstore.json",
+	".bundle",
+	".intoto.jsonl",
+}
+
+// isSignatureFile reports whether the asset name looks like a signature file.
+func isSignatureFile(name string) bool {
+	n := strings.ToLower(name)
+	for _, ext := range signatureExts {
+		if strings.HasSuffix(n, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// signedFile is a file of the release whose signatures can be looked
+// up among the release assets, either the downloaded asset itself or
+// the checksum file that was used to validate it.
+type signedFile struct {
+	name string
+	// path is set for files stored on disk, data for files kept in memory
+	path string
+	data []byte
+	// sha256 is the digest of the file if it's known already
+	sha256 []byte
+}
+
+func (s *signedFile) open() (io.ReadCloser, error) {
+	if s.data != nil {
+		return io.NopCloser(bytes.NewReader(s.data)), nil
+	}
+	return os.Open(s.path)
+}
+
+func (s *signedFile) readAll() ([]byte, error) {
+	if s.data != nil {
+		return s.data, nil
+	}
+	return os.ReadFile(s.path)
+}
+
+// findSignatureAsset returns the release asset named after name
+// with one of the given extensions, in order of preference.
+func (f *Filter) findSignatureAsset(name string, exts ...string) *Asset {
+	for _, ext := range exts {
+		for _, a := range f.assets {
+			if a.Name == name+ext {
+				return a
+			}
+		}
+	}
+	return nil
+}
+
+// signedFiles returns the files whose signatures can vouch for the downloaded asset
+// at p. Releases built with goreleaser usually only sign the checksum file, which
+// is as good as signing the asset once its checksum has been validated.
+func (f *Filter) signedFiles(gf *FilteredAsset, p string, digest *config.Digest) []*signedFile {
+	asset := &signedFile{name: gf.Name, path: p}
+	if digest != nil && digest.Algorithm == "sha256" {
+		asset.sha256, _ = hex.DecodeString(digest.Value)
+	}
+	res := []*signedFile{asset}
+	if f.checksumFile != nil {
+		res = append(res, f.checksumFile)
+	}
+	return res
+}
+
+// verifySignatures checks the downloaded asset at p against the signature
+// policies configured for the binary, digest is its sha256 digest if it's known.
+// It returns the verified provenance of the asset if a provenance policy is configured.
+func (f *Filter) verifySignatures(gf *FilteredAsset, p string, digest *config.Digest) (*config.Provenance, error) {
+	v := f.opts.Verification
+	if v == nil {
+		return nil, nil
+	}
+
+	files := f.signedFiles(gf, p, digest)
+	if v.Cosign != nil {
+		if err := f.verifyCosign(v.Cosign, files); err != nil {
+			return nil, err
+		}
+	}
+	if v.Minisign != nil {
+		if err := f.verifyMinisign(v.Minisign, files); err != nil {
+			return nil, err
+		}
+	}
+	if v.Signify != nil {
+		if err := f.verifySignify(v.Signify, files); err != nil {
+			return nil, err
+		}
+	}
+	if v.GPG != nil {
+		if err := f.verifyGPG(v.GPG, files); err != nil {
+			return nil, err
+		}
+	}
+
+	if v.Provenance != nil {
+		// provenance is about the asset itself, not the checksum file
+		return f.verifyProvenance(v.Provenance, files[0])
+	}
+
+	return nil, nil
+}
+
+// decodeBase64 decodes s as standard or URL base64 since both
+// are used by the different signing tools.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if bs, err := base64.StdEncoding.DecodeString(s); err == nil {
+		return bs, nil
+	}
+	if bs, err := base64.RawStdEncoding.DecodeString(s); err == nil {
+		return bs, nil
+	}
+	return base64.URLEncoding.DecodeString(s)
+}
+
+func signatureError(name, format string, args ...interface{}) error {
+	return fmt.Errorf("%w for %s: %s", ErrSignatureMismatch, name, fmt.Sprintf(format, args...))
+}
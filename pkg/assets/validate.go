@@ -1,3 +1,334 @@
+// validate.go
+//
+// validate downloaded asset against the checksum files published alongside the release
+// (checksums.txt, SHA256SUMS, <asset>.sha256, <asset>.sha512, ...)
 package assets
 
-// TODO: validate checksum of downloaded asset
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1" // nolint: gosec
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dfang/bin/pkg/cache"
+	"github.com/dfang/bin/pkg/config"
+	zlog "github.com/rs/zerolog/log"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrChecksumNotFound = errors.New("no checksum found")
+)
+
+// maxChecksumFileSize caps how much of a checksum file we read, they
+// are plain text files listing a few dozens of assets at most.
+const maxChecksumFileSize = 1 << 20
+
+// Checksum is the digest of a downloaded asset as published by upstream.
+type Checksum struct {
+	Algorithm string
+	Value     string
+	// Source is the name of the checksum file the digest was read from
+	Source string
+}
+
+func (c *Checksum) String() string {
+	return fmt.Sprintf("%s:%s", c.Algorithm, c.Value)
+}
+
+// bsdChecksumLine matches the BSD style output of `shasum --tag`,
+// e.g. SHA256 (bin_0.1.0_linux_amd64.tar.gz) = 4a5b...
+var bsdChecksumLine = regexp.MustCompile(`^(SHA1|SHA256|SHA512)\s*\((.+)\)\s*=\s*([0-9a-fA-F]+)$`)
+
+// checksumFileNames are the common names of files listing the checksums of all
+// assets of a release. The match is done against the lowercased asset name.
+var checksumFileNames = []string{
+	"checksums.txt",
+	"checksums",
+	"sha256sums",
+	"sha256sums.txt",
+	"sha512sums",
+	"sha512sums.txt",
+	"sha1sums",
+}
+
+// checksumExts are the extensions of files holding the checksum of a single asset.
+var checksumExts = []string{".sha256", ".sha256sum", ".sha512", ".sha512sum", ".sha1"}
+
+// isChecksumFile reports whether the asset name looks like a checksum file,
+// either for a single asset or for the whole release.
+func isChecksumFile(name string) bool {
+	n := strings.ToLower(name)
+	for _, ext := range checksumExts {
+		if strings.HasSuffix(n, ext) {
+			return true
+		}
+	}
+	for _, c := range checksumFileNames {
+		// e.g. fzf_0.42.0_checksums.txt or terraform_1.5.5_SHA256SUMS
+		if n == c || strings.HasSuffix(n, "_"+c) || strings.HasSuffix(n, "-"+c) || strings.HasSuffix(n, "."+c) {
+			return true
+		}
+	}
+	return false
+}
+
+// findChecksumAssets returns the release assets that could contain the checksum
+// of target. Per-asset checksum files are returned first since they are the most
+// specific ones.
+func findChecksumAssets(target string, as []*Asset) []*Asset {
+	specific := []*Asset{}
+	generic := []*Asset{}
+	for _, a := range as {
+		if !isChecksumFile(a.Name) {
+			continue
+		}
+		if strings.HasPrefix(a.Name, target+".") {
+			specific = append(specific, a)
+			continue
+		}
+
+		// skip checksum files of other assets
+		isOther := false
+		for _, ext := range checksumExts {
+			if strings.HasSuffix(strings.ToLower(a.Name), ext) {
+				isOther = true
+			}
+		}
+		if !isOther {
+			generic = append(generic, a)
+		}
+	}
+	return append(specific, generic...)
+}
+
+// algorithmFromName guesses the digest algorithm from a checksum file name.
+func algorithmFromName(name string) string {
+	n := strings.ToLower(name)
+	switch {
+	case strings.Contains(n, "sha512"):
+		return "sha512"
+	case strings.Contains(n, "sha256"):
+		return "sha256"
+	case strings.Contains(n, "sha1"):
+		return "sha1"
+	}
+	return ""
+}
+
+// algorithmFromDigest guesses the digest algorithm from the length of a hex digest.
+func algorithmFromDigest(digest string) string {
+	switch len(digest) {
+	case 40:
+		return "sha1"
+	case 64:
+		return "sha256"
+	case 128:
+		return "sha512"
+	}
+	return ""
+}
+
+func newHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "sha1":
+		return sha1.New(), nil // nolint: gosec
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+}
+
+// parseChecksums looks for the digest of target in r. It understands the
+// GNU coreutils format (`<digest>  <name>` or `<digest> *<name>`), the BSD
+// format (`SHA256 (<name>) = <digest>`) and files containing a single digest.
+func parseChecksums(r io.Reader, source, target string) (*Checksum, error) {
+	algorithm := algorithmFromName(source)
+	scanner := bufio.NewScanner(io.LimitReader(r, maxChecksumFileSize))
+	lines := 0
+	var single string
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines++
+
+		if m := bsdChecksumLine.FindStringSubmatch(line); m != nil {
+			if path.Base(m[2]) == target {
+				return newChecksum(strings.ToLower(m[1]), m[3], source)
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 1 {
+			single = fields[0]
+			continue
+		}
+		name := strings.TrimPrefix(strings.Join(fields[1:], " "), "*")
+		if path.Base(name) == target {
+			return newChecksum(algorithm, fields[0], source)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// <asset>.sha256 files sometimes only contain the digest
+	if lines == 1 && single != "" {
+		return newChecksum(algorithm, single, source)
+	}
+
+	return nil, fmt.Errorf("%w for %s in %s", ErrChecksumNotFound, target, source)
+}
+
+func newChecksum(algorithm, digest, source string) (*Checksum, error) {
+	digest = strings.ToLower(digest)
+	if _, err := hex.DecodeString(digest); err != nil {
+		return nil, fmt.Errorf("invalid digest %q in %s", digest, source)
+	}
+	if algorithm == "" {
+		algorithm = algorithmFromDigest(digest)
+	}
+	if algorithm == "" || algorithmFromDigest(digest) != algorithm {
+		return nil, fmt.Errorf("can't determine the algorithm of digest %q in %s", digest, source)
+	}
+	return &Checksum{Algorithm: algorithm, Value: digest, Source: source}, nil
+}
+
+// fileDigest computes the digest of the file at p with the given algorithm.
+func fileDigest(p, algorithm string) (string, error) {
+	d, err := FileDigest(p, algorithm)
+	if err != nil {
+		return "", err
+	}
+	return d.Value, nil
+}
+
+// FileDigest returns the digest of the file at p.
+func FileDigest(p, algorithm string) (*config.Digest, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Digest(file, algorithm)
+}
+
+// Digest hashes everything read from r with the given algorithm.
+func Digest(r io.Reader, algorithm string) (*config.Digest, error) {
+	h, err := newHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return nil, err
+	}
+	return &config.Digest{Algorithm: algorithm, Value: hex.EncodeToString(h.Sum(nil)), Size: n}, nil
+}
+
+// fetchAuxiliaryFile downloads a small release file, like a checksum or
+// signature file, into memory. It's retried and timed out like assets are,
+// the API URL is used when the headers authenticate the request.
+func fetchAuxiliaryFile(a *Asset, headers map[string]string) ([]byte, error) {
+	u := a.BrowserDownloadURL
+	if _, ok := headers["Authorization"]; u == "" || ok && a.URL != "" {
+		u = a.URL
+	}
+
+	dir, err := os.MkdirTemp("", "bin-auxiliary-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, filepath.Base(a.Name))
+	if err := grabAsset(u, p, a.Size, headers); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(io.LimitReader(file, maxChecksumFileSize))
+}
+
+// validate checks the downloaded file at p against the checksums published in
+// the release. It returns the verified checksum or nil if the release doesn't
+// publish any and checksums aren't required. The file is only hashed again if
+// digest, when known, isn't computed with the algorithm of the checksum.
+func (f *Filter) validate(gf *FilteredAsset, p string, digest *config.Digest) (*Checksum, error) {
+	if f.opts.SkipChecksum {
+		zlog.Debug().Msgf("--skip-checksum flag was supplied, skipping checksum validation of %s", gf.Name)
+		return nil, nil
+	}
+
+	candidates := findChecksumAssets(gf.Name, f.assets)
+	var expected *Checksum
+	for _, c := range candidates {
+		zlog.Debug().Msgf("Looking for checksum of %s in %s", gf.Name, c.Name)
+		bs, err := f.auxiliaryFile(c)
+		if errors.Is(err, cache.ErrNotCached) {
+			return nil, err
+		}
+		if err != nil {
+			zlog.Debug().Err(err).Msgf("Could not download checksum file %s", c.Name)
+			continue
+		}
+		expected, err = parseChecksums(bytes.NewReader(bs), c.Name, gf.Name)
+		if err != nil {
+			zlog.Debug().Err(err).Msgf("Could not find checksum of %s in %s", gf.Name, c.Name)
+			continue
+		}
+		f.checksumFile = &signedFile{name: c.Name, data: bs}
+		break
+	}
+
+	if expected == nil {
+		if f.opts.RequireChecksum {
+			return nil, fmt.Errorf("%w for %s, the release doesn't publish a checksum file", ErrChecksumNotFound, gf.Name)
+		}
+		zlog.Warn().Msgf("No checksum published for %s, skipping validation", gf.Name)
+		return nil, nil
+	}
+
+	var actual string
+	if digest != nil && digest.Algorithm == expected.Algorithm {
+		actual = digest.Value
+	} else {
+		var err error
+		if actual, err = fileDigest(p, expected.Algorithm); err != nil {
+			return nil, err
+		}
+	}
+
+	if actual != expected.Value {
+		// don't reuse the corrupted download, its content is shared with
+		// the other cached assets with the same digest and only removed
+		// once none of them refers to it
+		if err := cache.Default().Remove(f.cacheKey(gf.Name)); err != nil {
+			zlog.Debug().Err(err).Msgf("Could not remove %s from the download cache", gf.Name)
+		}
+		f.checksumFile = nil
+		return nil, fmt.Errorf("%w for %s: expected %s, got %s:%s (from %s)", ErrChecksumMismatch, gf.Name, expected, expected.Algorithm, actual, expected.Source)
+	}
+
+	zlog.Info().Msgf("Checksum of %s verified against %s", gf.Name, expected.Source)
+	return expected, nil
+}
@@ -0,0 +1,123 @@
+package assets
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestIsChecksumFile(t *testing.T) {
+	cases := []struct {
+		in  string
+		out bool
+	}{
+		{"checksums.txt", true},
+		{"fzf_0.42.0_checksums.txt", true},
+		{"terraform_1.5.5_SHA256SUMS", true},
+		{"SHA256SUMS", true},
+		{"ripgrep-13.0.0-x86_64-unknown-linux-musl.tar.gz.sha256", true},
+		{"zig-linux-x86_64-0.11.0.tar.xz.sha512", true},
+		{"ripgrep-13.0.0-x86_64-unknown-linux-musl.tar.gz", false},
+		{"checksum-tool_linux_amd64", false},
+	}
+
+	for _, c := range cases {
+		if result := isChecksumFile(c.in); result != c.out {
+			t.Fatalf("Expected isChecksumFile(%v) to be %v, but got %v", c.in, c.out, result)
+		}
+	}
+}
+
+func TestFindChecksumAssets(t *testing.T) {
+	as := []*Asset{
+		{Name: "rg-linux-amd64.tar.gz"},
+		{Name: "rg-linux-amd64.tar.gz.sha256"},
+		{Name: "rg-darwin-amd64.tar.gz"},
+		{Name: "rg-darwin-amd64.tar.gz.sha256"},
+		{Name: "checksums.txt"},
+	}
+
+	res := findChecksumAssets("rg-linux-amd64.tar.gz", as)
+	names := []string{}
+	for _, a := range res {
+		names = append(names, a.Name)
+	}
+
+	if e, a := "rg-linux-amd64.tar.gz.sha256,checksums.txt", strings.Join(names, ","); e != a {
+		t.Fatalf("Expected checksum assets %s, got %s", e, a)
+	}
+}
+
+func TestParseChecksums(t *testing.T) {
+	sha256sum := "3b5e1e3b2e4f1f9a4b3b1d9cbb5d9a2f6b9e4f1b3a5c7d9e1f3a5b7c9d1e3f5a"
+	sha512sum := strings.Repeat("ab", 64)
+	cases := []struct {
+		name    string
+		source  string
+		content string
+		target  string
+		out     string
+		err     error
+	}{
+		{
+			name:    "gnu format",
+			source:  "checksums.txt",
+			content: "0000000000000000000000000000000000000000000000000000000000000000  bin_0.1.0_darwin_amd64.tar.gz\n" + sha256sum + "  bin_0.1.0_linux_amd64.tar.gz\n",
+			target:  "bin_0.1.0_linux_amd64.tar.gz",
+			out:     "sha256:" + sha256sum,
+		},
+		{
+			name:    "gnu binary mode",
+			source:  "SHA256SUMS",
+			content: sha256sum + " *bin_0.1.0_linux_amd64.tar.gz\n",
+			target:  "bin_0.1.0_linux_amd64.tar.gz",
+			out:     "sha256:" + sha256sum,
+		},
+		{
+			name:    "bsd format",
+			source:  "checksums.txt",
+			content: "SHA512 (bin_0.1.0_linux_amd64.tar.gz) = " + sha512sum + "\n",
+			target:  "bin_0.1.0_linux_amd64.tar.gz",
+			out:     "sha512:" + sha512sum,
+		},
+		{
+			name:    "single digest",
+			source:  "bin_0.1.0_linux_amd64.tar.gz.sha512",
+			content: sha512sum + "\n",
+			target:  "bin_0.1.0_linux_amd64.tar.gz",
+			out:     "sha512:" + sha512sum,
+		},
+		{
+			name:    "path prefix",
+			source:  "sha256sums.txt",
+			content: strings.ToUpper(sha256sum) + "  ./dist/bin_0.1.0_linux_amd64.tar.gz\n",
+			target:  "bin_0.1.0_linux_amd64.tar.gz",
+			out:     "sha256:" + sha256sum,
+		},
+		{
+			name:    "missing",
+			source:  "checksums.txt",
+			content: sha256sum + "  bin_0.1.0_darwin_amd64.tar.gz\n",
+			target:  "bin_0.1.0_linux_amd64.tar.gz",
+			err:     ErrChecksumNotFound,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := parseChecksums(strings.NewReader(c.content), c.source, c.target)
+			if c.err != nil {
+				if !errors.Is(err, c.err) {
+					t.Fatalf("Expected error %v, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error parsing checksums: %v", err)
+			}
+			if res.String() != c.out {
+				t.Fatalf("Expected %s, got %s", c.out, res)
+			}
+		})
+	}
+}
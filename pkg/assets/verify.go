@@ -5,5 +5,6 @@ package assets
 // after installation verify if it's correctly installed
 // by checking --help exit code ???
 // not all downloaded asset can run successfully
-// eg. cosmtrek/air is not available on CentOS 8 because of GLIBC
+// eg. cosmtrek/air is not available on CentOS 8 because of GLIBC,
+// binaries requiring a newer glibc than the host's are caught by checkLibc
 // for this case maybe we can run prompt use to run go install
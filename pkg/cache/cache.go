@@ -0,0 +1,501 @@
+// Package cache stores downloaded release assets by their sha256 digest, and
+// indexes them by provider, repository, version and asset name so assets with
+// the same name in different repos or releases never collide.
+//
+//	<dir>/blobs/sha256/<digest>                            asset content
+//	<dir>/index/<provider>/<repo>/<version>/<asset>.json   entry pointing to a blob
+//	<dir>/partial/<provider>/<repo>/<version>/<asset>      download in progress
+//	<dir>/releases/<provider>/<repo>/<version>.json        release metadata
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dfang/bin/pkg/config"
+)
+
+const (
+	blobsDir    = "blobs"
+	indexDir    = "index"
+	partialDir  = "partial"
+	releasesDir = "releases"
+)
+
+// ErrNotCached is returned when an asset or a release
+// needed offline isn't in the cache.
+var ErrNotCached = errors.New("not in the download cache")
+
+// Default returns the cache in the configured cache directory.
+func Default() *Cache {
+	return New(config.GetCacheDir(), config.GetCacheMaxSize())
+}
+
+var (
+	// keyLocks holds a mutex per key, see Lock
+	keyLocks sync.Map
+	// blobMu serializes the changes of the blobs and of the index entries
+	// pointing to them, so a blob is never removed while another entry
+	// is stored with the same content
+	blobMu sync.Mutex
+)
+
+// Lock locks k until the returned function is called, so binaries
+// installed concurrently don't download the same asset twice.
+func Lock(k Key) func() {
+	m, _ := keyLocks.LoadOrStore(k, &sync.Mutex{})
+	mu := m.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// Key identifies a release asset.
+type Key struct {
+	Provider string `json:"provider"`
+	Repo     string `json:"repo"`
+	Version  string `json:"version"`
+	Asset    string `json:"asset"`
+}
+
+func (k Key) String() string {
+	return path.Join(k.Provider, k.Repo, k.Version, k.Asset)
+}
+
+// relPath returns the path of the key in the index and partial directories,
+// every component is sanitized so it can't escape the cache directory.
+func (k Key) relPath() string {
+	parts := []string{sanitize(k.Provider)}
+	for _, p := range strings.Split(k.Repo, "/") {
+		parts = append(parts, sanitize(p))
+	}
+	return filepath.Join(append(parts, sanitize(k.Version), sanitize(k.Asset))...)
+}
+
+func sanitize(s string) string {
+	if s == "" || s == "." || s == ".." {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// Entry is an asset stored in the cache.
+type Entry struct {
+	Key
+	URL      string    `json:"url"`
+	Digest   string    `json:"digest"`
+	Size     int64     `json:"size"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"last_used"`
+	// ModTime is the modification time of the blob when
+	// it was stored, it changes if the blob is modified
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Cache is a content addressed download cache.
+type Cache struct {
+	dir     string
+	maxSize int64
+}
+
+// New returns the cache stored in dir. Least recently used
+// entries are evicted once it grows over maxSize bytes, 0
+// disables the eviction.
+func New(dir string, maxSize int64) *Cache {
+	return &Cache{dir: dir, maxSize: maxSize}
+}
+
+// Dir returns the directory of the cache.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+func (c *Cache) indexPath(k Key) string {
+	return filepath.Join(c.dir, indexDir, k.relPath()+".json")
+}
+
+func (c *Cache) blobPath(digest string) string {
+	algorithm, value, _ := strings.Cut(digest, ":")
+	return filepath.Join(c.dir, blobsDir, sanitize(algorithm), sanitize(value))
+}
+
+// PartialPath returns where the asset is downloaded to before being
+// stored, a partial download left there by a previous run can be resumed.
+func (c *Cache) PartialPath(k Key) (string, error) {
+	p := filepath.Join(c.dir, partialDir, k.relPath())
+	return p, os.MkdirAll(filepath.Dir(p), 0o755)
+}
+
+func fileDigest(p string) (string, int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+func (c *Cache) readEntry(p string) (*Entry, error) {
+	bs, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{}
+	if err := json.Unmarshal(bs, e); err != nil {
+		return nil, fmt.Errorf("invalid cache entry %s: %w", p, err)
+	}
+	return e, nil
+}
+
+func (c *Cache) writeEntry(e *Entry) error {
+	p := c.indexPath(e.Key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	bs, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, bs, 0o644)
+}
+
+// Lookup returns the entry of k and the path of its content. The content
+// was hashed when it was stored, it's never reused if its size or its
+// modification time changed since.
+func (c *Cache) Lookup(k Key) (*Entry, string, bool) {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+
+	e, err := c.readEntry(c.indexPath(k))
+	if err != nil {
+		return nil, "", false
+	}
+
+	p := c.blobPath(e.Digest)
+	fi, err := os.Stat(p)
+	if err == nil && e.ModTime.IsZero() {
+		// the entries stored before the modification time was recorded are hashed once
+		if digest, _, derr := fileDigest(p); derr != nil || digest != e.Digest {
+			err = fmt.Errorf("%s doesn't match its digest", p)
+		}
+		e.ModTime = fi.ModTime().UTC()
+	}
+	if err != nil || fi.Size() != e.Size || !fi.ModTime().Equal(e.ModTime) {
+		_ = c.remove(k)
+		return nil, "", false
+	}
+
+	e.LastUsed = time.Now().UTC()
+	if err := c.writeEntry(e); err != nil {
+		return nil, "", false
+	}
+	return e, p, true
+}
+
+// Store moves the file downloaded from url at p into the cache as the
+// content of k and returns its new path. The file is hashed to be stored
+// by its digest, a blob with the same content is kept as is.
+func (c *Cache) Store(k Key, url, p string) (*Entry, string, error) {
+	digest, size, err := fileDigest(p)
+	if err != nil {
+		return nil, "", err
+	}
+
+	e, blob, err := c.storeBlob(k, url, p, digest, size)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if c.maxSize > 0 {
+		if err := c.Evict(c.maxSize, k); err != nil {
+			return nil, "", err
+		}
+	}
+	return e, blob, nil
+}
+
+// storeBlob moves the file at p to the blob of digest, unless the blob
+// exists already with that content, and points the entry of k to it.
+func (c *Cache) storeBlob(k Key, url, p, digest string, size int64) (*Entry, string, error) {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+
+	blob := c.blobPath(digest)
+	if existing, _, err := fileDigest(blob); err == nil && existing == digest {
+		_ = os.Remove(p)
+	} else {
+		if err := os.MkdirAll(filepath.Dir(blob), 0o755); err != nil {
+			return nil, "", err
+		}
+		if err := os.Rename(p, blob); err != nil {
+			return nil, "", err
+		}
+	}
+	fi, err := os.Stat(blob)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now().UTC()
+	e := &Entry{Key: k, URL: url, Digest: digest, Size: size, ModTime: fi.ModTime().UTC(), Created: now, LastUsed: now}
+	if err := c.writeEntry(e); err != nil {
+		return nil, "", err
+	}
+	return e, blob, nil
+}
+
+// releasePath returns the path of the metadata of the release of k.
+func (c *Cache) releasePath(k Key) string {
+	return filepath.Join(c.dir, releasesDir, filepath.Dir(k.relPath())+".json")
+}
+
+// StoreRelease caches the metadata of the release of k (the
+// asset is ignored) so the release can be resolved offline.
+func (c *Cache) StoreRelease(k Key, v interface{}) error {
+	p := c.releasePath(k)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	bs, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, bs, 0o644)
+}
+
+// LookupRelease reads the cached metadata of the release of k into v.
+func (c *Cache) LookupRelease(k Key, v interface{}) error {
+	bs, err := os.ReadFile(c.releasePath(k))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("release %s %s: %w", path.Join(k.Provider, k.Repo), k.Version, ErrNotCached)
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(bs, v)
+}
+
+// Releases returns the versions of the repository of k with cached metadata.
+func (c *Cache) Releases(k Key) ([]string, error) {
+	k.Version = "_"
+	entries, err := os.ReadDir(filepath.Dir(c.releasePath(k)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	versions := []string{}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			versions = append(versions, strings.TrimSuffix(e.Name(), ".json"))
+		}
+	}
+	return versions, nil
+}
+
+// List returns the entries of the cache sorted by key.
+func (c *Cache) List() ([]*Entry, error) {
+	entries := []*Entry{}
+	err := filepath.WalkDir(filepath.Join(c.dir, indexDir), func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, ".json") {
+			return nil
+		}
+		e, err := c.readEntry(p)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key.String() < entries[j].Key.String()
+	})
+	return entries, err
+}
+
+// Size returns the disk usage of the cached assets and partial downloads.
+func (c *Cache) Size() (int64, error) {
+	var size int64
+	for _, d := range []string{blobsDir, partialDir} {
+		err := filepath.WalkDir(filepath.Join(c.dir, d), func(p string, d fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() {
+				fi, err := d.Info()
+				if err != nil {
+					return err
+				}
+				size += fi.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return size, nil
+}
+
+// Remove removes the entry of k, and its content if
+// no other entry points to the same blob.
+func (c *Cache) Remove(k Key) error {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+	return c.remove(k)
+}
+
+// remove removes the entry of k, blobMu must be held.
+func (c *Cache) remove(k Key) error {
+	p := c.indexPath(k)
+	e, err := c.readEntry(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if e == nil {
+		// the entry was invalid, there's no blob to look for
+		return os.Remove(p)
+	}
+
+	entries, err := c.List()
+	if err != nil {
+		return err
+	}
+	return c.removeEntry(e, references(entries))
+}
+
+// references counts the entries pointing to each blob.
+func references(entries []*Entry) map[string]int {
+	refs := map[string]int{}
+	for _, e := range entries {
+		refs[e.Digest]++
+	}
+	return refs
+}
+
+// removeEntry removes e, and its blob once refs counts no other
+// entry pointing to it, blobMu must be held.
+func (c *Cache) removeEntry(e *Entry, refs map[string]int) error {
+	if err := os.Remove(c.indexPath(e.Key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if refs[e.Digest]--; refs[e.Digest] > 0 {
+		return nil
+	}
+	if err := os.Remove(c.blobPath(e.Digest)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Evict removes the least recently used entries until the
+// content of the cache is smaller than maxSize. The entries
+// of keep are never evicted.
+func (c *Cache) Evict(maxSize int64, keep ...Key) error {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+
+	entries, err := c.List()
+	if err != nil {
+		return err
+	}
+
+	sizes := map[string]int64{}
+	for _, e := range entries {
+		sizes[e.Digest] = e.Size
+	}
+	var size int64
+	for _, s := range sizes {
+		size += s
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+
+	refs := references(entries)
+	for _, e := range entries {
+		if size <= maxSize {
+			break
+		}
+		if kept(e.Key, keep) {
+			continue
+		}
+		if err := c.removeEntry(e, refs); err != nil {
+			return err
+		}
+		if refs[e.Digest] == 0 {
+			size -= e.Size
+		}
+	}
+	return nil
+}
+
+func kept(k Key, keep []Key) bool {
+	for _, kk := range keep {
+		if k == kk {
+			return true
+		}
+	}
+	return false
+}
+
+// Clean removes the entries that haven't been used since before, or
+// every entry if before is zero, and the interrupted downloads.
+func (c *Cache) Clean(before time.Time) error {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+
+	if before.IsZero() {
+		for _, d := range []string{blobsDir, indexDir, partialDir, releasesDir} {
+			if err := os.RemoveAll(filepath.Join(c.dir, d)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	entries, err := c.List()
+	if err != nil {
+		return err
+	}
+	refs := references(entries)
+	for _, e := range entries {
+		if e.LastUsed.Before(before) {
+			if err := c.removeEntry(e, refs); err != nil {
+				return err
+			}
+		}
+	}
+	return os.RemoveAll(filepath.Join(c.dir, partialDir))
+}
@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func download(t *testing.T, c *Cache, k Key, content string) string {
+	t.Helper()
+	p, err := c.PartialPath(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, blob, err := c.Store(k, "https://example.com/"+k.Asset, p)
+	if err != nil {
+		t.Fatalf("Error storing %s: %v", k, err)
+	}
+	return blob
+}
+
+func TestLookup(t *testing.T) {
+	c := New(t.TempDir(), 0)
+	a := Key{Provider: "github", Repo: "owner/a", Version: "v1.0.0", Asset: "linux-amd64.tar.gz"}
+	b := Key{Provider: "github", Repo: "owner/b", Version: "v1.0.0", Asset: "linux-amd64.tar.gz"}
+	download(t, c, a, "a")
+	download(t, c, b, "b")
+
+	for k, content := range map[Key]string{a: "a", b: "b"} {
+		_, p, ok := c.Lookup(k)
+		if !ok {
+			t.Fatalf("Expected %s to be cached", k)
+		}
+		if bs, _ := os.ReadFile(p); string(bs) != content {
+			t.Fatalf("Expected %s to contain %q, got %q", k, content, bs)
+		}
+	}
+
+	if _, _, ok := c.Lookup(Key{Provider: "github", Repo: "owner/a", Version: "v1.1.0", Asset: "linux-amd64.tar.gz"}); ok {
+		t.Fatalf("Expected another version not to be cached")
+	}
+
+	// a modified blob is never reused
+	_, p, _ := c.Lookup(a)
+	if err := os.WriteFile(p, []byte("tampered"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := c.Lookup(a); ok {
+		t.Fatalf("Expected a modified asset not to be reused")
+	}
+
+	// so is a blob modified without changing its size
+	_, p, _ = c.Lookup(b)
+	if err := os.WriteFile(p, []byte("c"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(p, time.Now(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := c.Lookup(b); ok {
+		t.Fatalf("Expected a modified asset of the same size not to be reused")
+	}
+}
+
+func TestLookupSharedContent(t *testing.T) {
+	c := New(t.TempDir(), 0)
+	a := Key{Provider: "github", Repo: "owner/a", Version: "v1.0.0", Asset: "linux-amd64.tar.gz"}
+	b := Key{Provider: "github", Repo: "owner/b", Version: "v1.0.0", Asset: "linux-amd64.tar.gz"}
+	download(t, c, a, "same")
+	download(t, c, b, "same")
+
+	// storing the same content again doesn't invalidate the other entries
+	for _, k := range []Key{a, b} {
+		if _, _, ok := c.Lookup(k); !ok {
+			t.Fatalf("Expected %s to be cached", k)
+		}
+	}
+
+	// the entries stored before their modification time was recorded are hashed once
+	e, _ := c.readEntry(c.indexPath(a))
+	e.ModTime = time.Time{}
+	if err := c.writeEntry(e); err != nil {
+		t.Fatal(err)
+	}
+	if e, _, ok := c.Lookup(a); !ok || e.ModTime.IsZero() {
+		t.Fatalf("Expected %s to be cached with its modification time, got %+v", a, e)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	c := New(t.TempDir(), 0)
+	a := Key{Provider: "github", Repo: "owner/a", Version: "v1.0.0", Asset: "linux-amd64.tar.gz"}
+	b := Key{Provider: "github", Repo: "owner/b", Version: "v1.0.0", Asset: "linux-amd64.tar.gz"}
+	blob := download(t, c, a, "same")
+	download(t, c, b, "same")
+
+	// the content is kept as long as another entry refers to it
+	if err := c.Remove(a); err != nil {
+		t.Fatalf("Error removing %s: %v", a, err)
+	}
+	if _, _, ok := c.Lookup(a); ok {
+		t.Fatalf("Expected %s to be removed", a)
+	}
+	if _, p, ok := c.Lookup(b); !ok || p != blob {
+		t.Fatalf("Expected %s to still be cached in %s", b, blob)
+	}
+
+	if err := c.Remove(b); err != nil {
+		t.Fatalf("Error removing %s: %v", b, err)
+	}
+	if _, err := os.Stat(blob); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected the unreferenced content to be removed, got %v", err)
+	}
+}
+
+func TestRelPath(t *testing.T) {
+	k := Key{Provider: "github", Repo: "../..", Version: "..", Asset: "../../etc/passwd"}
+	for _, part := range strings.Split(k.relPath(), string(filepath.Separator)) {
+		if part == ".." {
+			t.Fatalf("Expected the key path to stay in the cache directory, got %s", k.relPath())
+		}
+	}
+}
+
+func TestEvict(t *testing.T) {
+	c := New(t.TempDir(), 0)
+	keys := []Key{}
+	for _, v := range []string{"v1", "v2", "v3"} {
+		k := Key{Provider: "github", Repo: "owner/repo", Version: v, Asset: "bin"}
+		download(t, c, k, strings.Repeat(v, 10))
+		keys = append(keys, k)
+		time.Sleep(10 * time.Millisecond)
+	}
+	// same content as v3, it shouldn't count twice
+	dup := Key{Provider: "github", Repo: "owner/fork", Version: "v3", Asset: "bin"}
+	download(t, c, dup, strings.Repeat("v3", 10))
+
+	// v1 was used last, v2 is the least recently used
+	c.Lookup(keys[0])
+
+	if err := c.Evict(45); err != nil {
+		t.Fatalf("Error evicting: %v", err)
+	}
+	if _, _, ok := c.Lookup(keys[1]); ok {
+		t.Fatalf("Expected the least recently used entry to be evicted")
+	}
+	for _, k := range []Key{keys[0], keys[2], dup} {
+		if _, _, ok := c.Lookup(k); !ok {
+			t.Fatalf("Expected %s to be kept", k)
+		}
+	}
+
+	if size, _ := c.Size(); size != 40 {
+		t.Fatalf("Expected the cache to use 40 bytes, got %d", size)
+	}
+}
+
+func TestClean(t *testing.T) {
+	c := New(t.TempDir(), 0)
+	k := Key{Provider: "github", Repo: "owner/repo", Version: "v1", Asset: "bin"}
+	blob := download(t, c, k, "bin")
+	partial, _ := c.PartialPath(Key{Provider: "github", Repo: "owner/repo", Version: "v2", Asset: "bin"})
+	if err := os.WriteFile(partial, []byte("b"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Clean(time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(blob); err != nil {
+		t.Fatalf("Expected recently used entries to be kept")
+	}
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Fatalf("Expected partial downloads to be removed")
+	}
+
+	if err := c.Clean(time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := c.List(); len(entries) != 0 {
+		t.Fatalf("Expected the cache to be empty, got %d entries", len(entries))
+	}
+	if _, err := os.Stat(filepath.Dir(blob)); !os.IsNotExist(err) {
+		t.Fatalf("Expected blobs to be removed")
+	}
+}
+
+func TestRelease(t *testing.T) {
+	c := New(t.TempDir(), 0)
+	k := Key{Provider: "github", Repo: "owner/a", Version: "v1.0.0"}
+
+	var got []string
+	if err := c.LookupRelease(k, &got); !errors.Is(err, ErrNotCached) {
+		t.Fatalf("Expected ErrNotCached, got %v", err)
+	}
+
+	if err := c.StoreRelease(k, []string{"linux-amd64.tar.gz", "checksums.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LookupRelease(k, &got); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != "linux-amd64.tar.gz,checksums.txt" {
+		t.Fatalf("Unexpected release metadata %v", got)
+	}
+
+	versions, err := c.Releases(Key{Provider: "github", Repo: "owner/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0] != "v1.0.0" {
+		t.Fatalf("Expected v1.0.0 to be cached, got %v", versions)
+	}
+	if versions, _ := c.Releases(Key{Provider: "github", Repo: "owner/b"}); len(versions) != 0 {
+		t.Fatalf("Expected no cached release, got %v", versions)
+	}
+}
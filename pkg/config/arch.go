@@ -0,0 +1,97 @@
+package config
+
+import (
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// archAliases are the other names assets use for the architectures, by GOARCH.
+var archAliases = map[string][]string{
+	"386":      {"i386", "i686", "x86"},
+	"amd64":    {"x86_64", "x86-64", "x64", "64"},
+	"arm":      {},
+	"arm64":    {"aarch64", "armv8"},
+	"loong64":  {"loongarch64"},
+	"mips":     {},
+	"mipsle":   {"mipsel"},
+	"mips64":   {},
+	"mips64le": {"mips64el"},
+	"ppc64":    {"powerpc64"},
+	"ppc64le":  {"powerpc64le", "ppc64el"},
+	"riscv64":  {},
+	"s390x":    {},
+}
+
+// armVariants are the names of the arm variants, by GOARM. Hosts run the
+// binaries of their variant and of the lower ones, armhf is armv7 hard-float.
+var armVariants = map[string][]string{
+	"5": {"armv5", "armv5l", "armel"},
+	"6": {"armv6", "armv6l"},
+	"7": {"armv7", "armv7l", "armhf"},
+}
+
+// ArchAliases returns the names of the architecture goarch in asset
+// names, goarch first. goarm is the arm variant, see GOARM.
+func ArchAliases(goarch, goarm string) []string {
+	res := append([]string{goarch}, archAliases[goarch]...)
+	if goarch == "arm" {
+		res = append(res, armVariants[goarm]...)
+	}
+	return res
+}
+
+// ForeignArchAliases returns the names of the architectures the binaries
+// of goarch can't run on: the other architectures, and the arm variants
+// higher than goarm. Some contain the names of goarch, e.g. arm64 and arm,
+// they're sorted longest first so they can be told apart.
+func ForeignArchAliases(goarch, goarm string) []string {
+	res := []string{}
+	for arch, aliases := range archAliases {
+		if arch != goarch {
+			res = append(res, arch)
+			res = append(res, aliases...)
+		}
+	}
+	for variant, aliases := range armVariants {
+		if goarch != "arm" || goarm != "" && variant > goarm {
+			res = append(res, aliases...)
+		}
+	}
+
+	own := map[string]bool{}
+	for _, a := range ArchAliases(goarch, goarm) {
+		own[a] = true
+	}
+	foreign := res[:0]
+	for _, a := range res {
+		// short names like the 64 of linux64 show up in
+		// version numbers too, they don't rule assets out
+		if !own[a] && len(a) > 2 {
+			foreign = append(foreign, a)
+		}
+	}
+	sort.Slice(foreign, func(i, j int) bool {
+		if len(foreign[i]) != len(foreign[j]) {
+			return len(foreign[i]) > len(foreign[j])
+		}
+		return foreign[i] < foreign[j]
+	})
+	return foreign
+}
+
+// goarm returns the arm variant the running program is built for,
+// empty if it's not built for arm or the variant isn't recorded.
+func goarm() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, s := range info.Settings {
+		if s.Key == "GOARM" {
+			// e.g. 7,softfloat
+			return strings.SplitN(s.Value, ",", 2)[0]
+		}
+	}
+	return ""
+}
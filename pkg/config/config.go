@@ -10,6 +10,8 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/apex/log"
 	zlog "github.com/rs/zerolog/log"
@@ -17,6 +19,9 @@ import (
 
 var cfg config
 
+// mu serializes the updates of the config by concurrent installs
+var mu sync.Mutex
+
 type config struct {
 	// DefaultPath might not be expanded so it's important that
 	// the caller expands this variable with os.ExpandEnv(string)
@@ -26,19 +31,204 @@ type config struct {
 
 	// CacheDir is where bin downloads asset file and checksum to
 	CacheDir string `json:"cache_dir"`
+	// CacheMaxSize is the size, in megabytes, over which the least
+	// recently used assets are evicted from the cache
+	CacheMaxSize int64 `json:"cache_max_size,omitempty"`
+
+	// KeyringDir holds the OpenPGP public keys used to verify
+	// signed releases, defaults to keyring/ in the config directory
+	KeyringDir string `json:"keyring_dir,omitempty"`
+
+	// Download configures the retries and timeouts of asset downloads
+	Download *DownloadConfig `json:"download,omitempty"`
+
+	// AssetRules are the asset selection rules of every binary,
+	// they're merged with the rules of each binary
+	AssetRules *AssetRules `json:"asset_rules,omitempty"`
+}
+
+// DownloadConfig configures how assets are downloaded, unset
+// fields fall back to the defaults of GetDownloadConfig.
+type DownloadConfig struct {
+	// Retries is how many times a failed download is retried
+	Retries *int `json:"retries,omitempty"`
+	// RequestTimeout is how long, in seconds, a download attempt
+	// can go without receiving any data before it's aborted
+	RequestTimeout int `json:"request_timeout,omitempty"`
+	// Timeout is the maximum duration, in seconds, of a
+	// download including all of its retries
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// AssetRules tune which asset of a release is installed when
+// the scoring by OS, architecture and extension picks the wrong one.
+type AssetRules struct {
+	// Include are regular expressions, the asset name has to match one of them
+	Include []string `json:"include,omitempty"`
+	// Exclude are regular expressions, the assets whose name matches one of them are skipped
+	Exclude []string `json:"exclude,omitempty"`
+	// Weights override the scores of the words matched in the asset
+	// names, e.g. {"musl": 20}, or add new ones. Negative weights
+	// push the assets matching them down
+	Weights map[string]int `json:"weights,omitempty"`
+}
+
+// IsEmpty checks if the rules don't change the asset selection.
+func (r *AssetRules) IsEmpty() bool {
+	return r == nil || len(r.Include) == 0 && len(r.Exclude) == 0 && len(r.Weights) == 0
 }
 
 type Binary struct {
 	Path       string `json:"path"`
 	RemoteName string `json:"remote_name"`
 	Version    string `json:"version"`
-	Hash       string `json:"hash"`
-	URL        string `json:"url"`
-	Provider   string `json:"provider"`
+	// Hash is the hex encoded sha256 of the installed binary, empty
+	// if it's unknown (configs written by older versions of bin)
+	Hash     string `json:"hash"`
+	URL      string `json:"url"`
+	Provider string `json:"provider"`
 	// if file is installed from a package format (zip, tar, etc) store
 	// the package path in config so we don't ask the user to select
 	// the path again when upgrading
 	PackagePath string `json:"package_path"`
+	// Checksum is the upstream checksum (<algorithm>:<digest>) the
+	// downloaded asset was verified against, empty if none was published
+	Checksum string `json:"checksum,omitempty"`
+	// Verification is the signature verification policy applied
+	// to the downloaded assets before installing them
+	Verification *Verification `json:"verification,omitempty"`
+	// Provenance is the verified provenance of the installed asset
+	Provenance *Provenance `json:"provenance,omitempty"`
+	// AssetDigest is the digest of the downloaded release asset
+	AssetDigest *Digest `json:"asset_digest,omitempty"`
+	// BinaryDigest is the digest of the installed binary, after
+	// it has been extracted from the asset
+	BinaryDigest *Digest `json:"binary_digest,omitempty"`
+	// Desktop is the desktop entry and icon installed for an
+	// AppImage, they're updated and removed along with it
+	Desktop *Desktop `json:"desktop,omitempty"`
+	// Bundle is the path of the first binary picked from the same
+	// archive, the binaries of a bundle are updated together
+	Bundle string `json:"bundle,omitempty"`
+	// Companions are the paths of the shell completions and man
+	// pages installed from the archive of the binary
+	Companions []string `json:"companions,omitempty"`
+	// AssetRules select the asset of the binary on installs and updates
+	AssetRules *AssetRules `json:"asset_rules,omitempty"`
+	// AssetTemplate is the name of the asset the user selected, with
+	// the version replaced by {version}, so updates select it again
+	// rather than prompting, e.g. tool-{version}-linux-musl.tar.gz
+	AssetTemplate string `json:"asset_template,omitempty"`
+	// Platform is the platform the binary is installed for, e.g.
+	// linux/arm64, empty if it's the one bin runs on
+	Platform string `json:"platform,omitempty"`
+}
+
+// Desktop is the desktop integration of an AppImage.
+type Desktop struct {
+	// Entry is the path of the installed .desktop file
+	Entry string `json:"entry"`
+	// Icon is the path of the installed icon, empty if
+	// the AppImage doesn't embed one
+	Icon string `json:"icon,omitempty"`
+}
+
+// Digest is the content hash of a file.
+type Digest struct {
+	Algorithm string `json:"algorithm"`
+	Value     string `json:"value"`
+	Size      int64  `json:"size"`
+}
+
+// String returns the digest in the <algorithm>:<value> form.
+func (d *Digest) String() string {
+	return d.Algorithm + ":" + d.Value
+}
+
+// emptySHA256 is the digest older versions of bin recorded
+// for every binary, as the hash was never written to.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// Verification holds the signature verification policies of a binary.
+// A nil policy means the corresponding signatures aren't checked.
+type Verification struct {
+	Cosign   *CosignPolicy   `json:"cosign,omitempty"`
+	Minisign *MinisignPolicy `json:"minisign,omitempty"`
+	Signify  *SignifyPolicy  `json:"signify,omitempty"`
+	GPG      *GPGPolicy      `json:"gpg,omitempty"`
+
+	Provenance *ProvenancePolicy `json:"provenance,omitempty"`
+}
+
+// CosignPolicy verifies cosign signatures (<asset>.sig, <asset>.pem) and
+// Sigstore bundles (<asset>.sigstore.json). Key is used for keyed
+// signatures, otherwise the signing certificate must chain up to
+// TrustedRoot and match Identity and Issuer (keyless signatures).
+type CosignPolicy struct {
+	// Key is the path to a PEM encoded public key
+	Key string `json:"key,omitempty"`
+	// Identity is the expected subject of the signing certificate,
+	// e.g. https://github.com/goreleaser/goreleaser/.github/workflows/release.yml@refs/tags/v1.20.0
+	// or a regular expression if IdentityRegexp is set
+	Identity       string `json:"identity,omitempty"`
+	IdentityRegexp bool   `json:"identity_regexp,omitempty"`
+	// Issuer is the expected OIDC issuer of the signing certificate,
+	// e.g. https://token.actions.githubusercontent.com
+	Issuer string `json:"issuer,omitempty"`
+	// TrustedRoot is the path to a Sigstore trusted_root.json or a PEM
+	// bundle with the certificate authorities trusted for keyless signatures
+	TrustedRoot string `json:"trusted_root,omitempty"`
+}
+
+// MinisignPolicy pins the minisign public key the assets
+// must be signed with (<asset>.minisig).
+type MinisignPolicy struct {
+	// PublicKey is the base64 encoded key, e.g. RWSGOq2NVecA2UPNdBUZykf1CCb147pkmdtYxgb3Ti+JO/wCYvhbAb/U
+	PublicKey string `json:"public_key"`
+}
+
+// SignifyPolicy pins the signify public key the assets
+// must be signed with (<asset>.sig).
+type SignifyPolicy struct {
+	// PublicKey is the base64 encoded key as found in the .pub file
+	PublicKey string `json:"public_key"`
+}
+
+// GPGPolicy pins the fingerprint of the OpenPGP key the assets must
+// be signed with (<asset>.asc). The key itself is read from the keyring.
+type GPGPolicy struct {
+	Fingerprint string `json:"fingerprint"`
+	// Keyring overrides the keyring directory set in the config
+	Keyring string `json:"keyring,omitempty"`
+}
+
+// ProvenancePolicy requires a SLSA provenance (<asset>.intoto.jsonl) or a GitHub
+// artifact attestation for the downloaded asset, built from SourceRepo.
+type ProvenancePolicy struct {
+	// SourceRepo is the repository the asset must be built from, e.g. github.com/owner/repo
+	SourceRepo string `json:"source_repo"`
+	// SourceRef is a glob the git ref must match, e.g. refs/tags/*
+	SourceRef string `json:"source_ref,omitempty"`
+	// BuilderID is the expected builder, e.g.
+	// https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml
+	BuilderID string `json:"builder_id,omitempty"`
+	// Signer verifies the signature of the provenance. If no identity is set,
+	// the signing certificate must belong to the builder or the source repo.
+	Signer CosignPolicy `json:"signer"`
+}
+
+// Provenance is the summary of the verified provenance
+// of the installed asset, kept for later audits.
+type Provenance struct {
+	PredicateType string    `json:"predicate_type"`
+	BuilderID     string    `json:"builder_id"`
+	SourceRepo    string    `json:"source_repo"`
+	SourceRef     string    `json:"source_ref,omitempty"`
+	SourceDigest  string    `json:"source_digest,omitempty"`
+	Subject       string    `json:"subject"`
+	Source        string    `json:"source"`
+	Signer        string    `json:"signer,omitempty"`
+	VerifiedAt    time.Time `json:"verified_at"`
 }
 
 func CheckAndLoad() error {
@@ -85,6 +275,12 @@ func CheckAndLoad() error {
 		}
 	}
 
+	for _, b := range cfg.Bins {
+		if b.BinaryDigest == nil && b.Hash == emptySHA256 {
+			b.Hash = ""
+		}
+	}
+
 	if len(cfg.DefaultPath) == 0 {
 		cfg.DefaultPath, err = getDefaultPath()
 		if err != nil {
@@ -125,6 +321,9 @@ func Get() *config {
 // UpsertBinary adds or updats an existing
 // binary resource in the config.
 func UpsertBinary(c *Binary) error {
+	mu.Lock()
+	defer mu.Unlock()
+
 	if c != nil {
 		cfg.Bins[c.Path] = c
 		err := write()
@@ -139,6 +338,9 @@ func UpsertBinary(c *Binary) error {
 // RemoveBinaries removes the specified paths
 // from bin configuration. It doesn't care about the order.
 func RemoveBinaries(paths []string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
 	for _, p := range paths {
 		delete(cfg.Bins, p)
 	}
@@ -159,7 +361,7 @@ func write() error {
 
 	defer f.Close()
 
-	fmt.Printf("%+v\n", cfg)
+	zlog.Trace().Msgf("%+v", cfg)
 
 	decoder := json.NewEncoder(f)
 	decoder.SetIndent("", "    ")
@@ -172,34 +374,122 @@ func write() error {
 	return nil
 }
 
+// GetDataDir returns the XDG data directory where the desktop entries,
+// completions and man pages are installed, ~/.local/share unless
+// overridden by XDG_DATA_HOME.
+func GetDataDir() (string, error) {
+	if d := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(d) {
+		return d, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share"), nil
+}
+
 func GetCacheDir() string {
 	return cfg.CacheDir
 }
 
+// GetCacheMaxSize returns the maximum size of the download cache
+// in bytes, 2GB unless configured otherwise.
+func GetCacheMaxSize() int64 {
+	if cfg.CacheMaxSize > 0 {
+		return cfg.CacheMaxSize << 20
+	}
+	return 2 << 30
+}
+
+// GetDownloadConfig returns the download settings
+// with the defaults applied to the unset fields.
+func GetDownloadConfig() DownloadConfig {
+	retries := 3
+	dc := DownloadConfig{Retries: &retries, RequestTimeout: 60, Timeout: 30 * 60}
+	if d := cfg.Download; d != nil {
+		if d.Retries != nil && *d.Retries >= 0 {
+			dc.Retries = d.Retries
+		}
+		if d.RequestTimeout > 0 {
+			dc.RequestTimeout = d.RequestTimeout
+		}
+		if d.Timeout > 0 {
+			dc.Timeout = d.Timeout
+		}
+	}
+	return dc
+}
+
+// GetAssetRules returns the asset selection rules of a binary merged with
+// the global ones: the patterns of both apply, and the weights of the
+// binary override the global ones. It returns nil if there are none.
+func GetAssetRules(binary *AssetRules) *AssetRules {
+	global := cfg.AssetRules
+	if global.IsEmpty() {
+		global = nil
+	}
+	if binary.IsEmpty() {
+		return global
+	}
+	if global == nil {
+		return binary
+	}
+
+	rules := &AssetRules{
+		Include: append(append([]string{}, global.Include...), binary.Include...),
+		Exclude: append(append([]string{}, global.Exclude...), binary.Exclude...),
+		Weights: map[string]int{},
+	}
+	for _, weights := range []map[string]int{global.Weights, binary.Weights} {
+		for k, w := range weights {
+			rules.Weights[k] = w
+		}
+	}
+	return rules
+}
+
+// GetKeyringDir returns the directory holding the
+// OpenPGP public keys trusted to sign releases.
+func GetKeyringDir() string {
+	if cfg.KeyringDir != "" {
+		return cfg.KeyringDir
+	}
+	configDir, err := getConfigPath()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "keyring")
+}
+
 // GetArch is the running program's operating system target:
 // one of darwin, freebsd, linux, and so on.
 func GetArch() []string {
-	res := []string{runtime.GOARCH}
-	if runtime.GOARCH == "amd64" {
-		// Adding x86_64 manually since the uname syscall (man 2 uname)
-		// is not implemented in all systems
-		res = append(res, "x86_64")
-		res = append(res, "x64")
-		res = append(res, "64")
-	}
-	return res
+	// the names are listed since the uname syscall (man 2 uname)
+	// is not implemented in all systems
+	return ArchAliases(runtime.GOARCH, goarm())
+}
+
+// GetForeignArch returns the names of the architectures
+// the running program's binaries can't run on.
+func GetForeignArch() []string {
+	return ForeignArchAliases(runtime.GOARCH, goarm())
 }
 
 // GetOS is the running program's architecture target:
 // one of 386, amd64, arm, s390x, and so on.
 func GetOS() []string {
-	res := []string{runtime.GOOS}
-	if runtime.GOOS == "windows" {
+	return OSAliases(runtime.GOOS)
+}
+
+// OSAliases returns the names of the OS goos in asset names, goos first.
+func OSAliases(goos string) []string {
+	res := []string{goos}
+	if goos == "windows" {
 		// Adding win since some repositories release with that as the indicator of a windows binary
 		res = append(res, "win")
 	}
 
-	if runtime.GOOS == "darwin" {
+	if goos == "darwin" {
 		res = append(res, "macos")
 		res = append(res, "macOS")
 		res = append(res, "osx")
@@ -245,7 +535,12 @@ func getConfigPath() (string, error) {
 }
 
 func GetOSSpecificExtensions() []string {
-	switch runtime.GOOS {
+	return OSSpecificExtensions(runtime.GOOS)
+}
+
+// OSSpecificExtensions returns the extensions of the assets specific to goos.
+func OSSpecificExtensions(goos string) []string {
+	switch goos {
 	case "linux":
 		return []string{"AppImage"}
 	case "windows":
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// knownOS are the OSes binaries can be installed for, as GOOS.
+var knownOS = []string{"aix", "android", "darwin", "dragonfly", "freebsd", "illumos", "linux", "netbsd", "openbsd", "solaris", "windows"}
+
+// Platform is the OS and architecture binaries are installed
+// for when it isn't the one bin runs on.
+type Platform struct {
+	// OS is the OS, as GOOS
+	OS string
+	// Arch is the architecture, as GOARCH
+	Arch string
+	// Variant is the arm variant, as GOARM, e.g. 7
+	Variant string
+}
+
+// ParsePlatform parses platforms in the os/arch[/variant] form used by
+// docker, e.g. linux/arm64 or linux/arm/v7. Empty platforms are nil.
+// The v8 variant of arm64 is ignored, it's the only one docker has.
+func ParsePlatform(s string) (*Platform, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(strings.ToLower(s), "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("invalid platform %q, expected os/arch[/variant], e.g. linux/arm64", s)
+	}
+	p := &Platform{OS: parts[0], Arch: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = strings.TrimPrefix(parts[2], "v")
+		if p.Arch == "arm64" && p.Variant == "8" {
+			p.Variant = ""
+		}
+	}
+
+	if !contains(knownOS, p.OS) {
+		return nil, fmt.Errorf("unknown OS %q in platform %q, expected one of %s", p.OS, s, strings.Join(knownOS, ", "))
+	}
+	if _, ok := archAliases[p.Arch]; !ok {
+		return nil, fmt.Errorf("unknown architecture %q in platform %q", p.Arch, s)
+	}
+	if p.Variant != "" {
+		if _, ok := armVariants[p.Variant]; !ok || p.Arch != "arm" {
+			return nil, fmt.Errorf("unknown variant %q of %s in platform %q", parts[2], p.Arch, s)
+		}
+	}
+	return p, nil
+}
+
+// String returns the platform in the os/arch[/variant] form.
+func (p *Platform) String() string {
+	s := p.OS + "/" + p.Arch
+	if p.Variant != "" {
+		s += "/v" + p.Variant
+	}
+	return s
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
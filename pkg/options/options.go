@@ -1,11 +1,20 @@
 package options
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"regexp"
 	"strconv"
+	"strings"
+	"sync"
+	"unicode"
 )
 
+// mu serializes the prompts of binaries installed concurrently.
+var mu sync.Mutex
+
 type LiteralStringer string
 
 func (l LiteralStringer) String() string {
@@ -19,6 +28,9 @@ func Select(msg string, opts []fmt.Stringer) (interface{}, error) {
 	if len(opts) == 1 {
 		return opts[0], nil
 	}
+	mu.Lock()
+	defer mu.Unlock()
+
 	fmt.Printf("\n%s\n", msg)
 	for i, o := range opts {
 		fmt.Printf("\n [%d] %s", i+1, o)
@@ -51,6 +63,9 @@ func SelectCustom(msg string, opts []fmt.Stringer) (interface{}, error) {
 	if len(opts) == 1 {
 		return opts[0], nil
 	}
+	mu.Lock()
+	defer mu.Unlock()
+
 	fmt.Printf("\n%s\n", msg)
 	for i, o := range opts {
 		fmt.Printf("\n [%d] %s", i+1, o)
@@ -86,3 +101,104 @@ func SelectCustom(msg string, opts []fmt.Stringer) (interface{}, error) {
 
 	return opts[v-1], nil
 }
+
+// SelectMany prompts the user which of the available options
+// are desired through STDIN, as a list of option numbers and
+// ranges like 1,3-5, and returns the selected ones.
+func SelectMany(msg string, opts []fmt.Stringer) ([]fmt.Stringer, error) {
+	if len(opts) == 1 {
+		return opts, nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	fmt.Printf("\n%s\n", msg)
+	for i, o := range opts {
+		fmt.Printf("\n [%d] %s", i+1, o)
+	}
+
+	var selection string
+	var indexes []int
+	var err error
+	for {
+		fmt.Printf("\n Select options (e.g. 1,3-5): ")
+		selection, err = readLine(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		indexes, err = parseSelection(selection, len(opts))
+		if err != nil {
+			fmt.Printf("Invalid selection: %v", err)
+			continue
+		}
+		break
+	}
+
+	selected := make([]fmt.Stringer, 0, len(indexes))
+	for _, i := range indexes {
+		selected = append(selected, opts[i])
+	}
+	return selected, nil
+}
+
+// readLine reads a whole line of r a byte at a time, so
+// nothing past it is buffered away from the next prompts.
+func readLine(r io.Reader) (string, error) {
+	var line strings.Builder
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				return strings.TrimSuffix(line.String(), "\r"), nil
+			}
+			line.WriteByte(b[0])
+		}
+		if errors.Is(err, io.EOF) && line.Len() > 0 {
+			return line.String(), nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
+
+// rangeSpaces matches the spaces around the dash of ranges.
+var rangeSpaces = regexp.MustCompile(`\s*-\s*`)
+
+// parseSelection parses a list of option numbers and ranges separated
+// by commas or spaces, and returns the 0-based indexes of the options.
+func parseSelection(selection string, n int) ([]int, error) {
+	parts := strings.FieldsFunc(rangeSpaces.ReplaceAllString(selection, "-"), func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("no option selected")
+	}
+
+	indexes := []int{}
+	seen := map[int]bool{}
+	for _, part := range parts {
+		from, to, isRange := strings.Cut(part, "-")
+		if !isRange {
+			to = from
+		}
+		start, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", from)
+		}
+		end, err := strconv.Atoi(to)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", to)
+		}
+		if start < 1 || end > n || start > end {
+			return nil, fmt.Errorf("%q is out of range", part)
+		}
+		for i := start; i <= end; i++ {
+			if !seen[i] {
+				seen[i] = true
+				indexes = append(indexes, i-1)
+			}
+		}
+	}
+	return indexes, nil
+}
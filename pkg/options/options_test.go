@@ -0,0 +1,55 @@
+package options
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSelection(t *testing.T) {
+	cases := []struct {
+		in  string
+		out []int
+		err bool
+	}{
+		{"1", []int{0}, false},
+		{"1,3", []int{0, 2}, false},
+		{"2-4", []int{1, 2, 3}, false},
+		{"4,1-2,2", []int{3, 0, 1}, false},
+		{"1, 3", []int{0, 2}, false},
+		{"1 3", []int{0, 2}, false},
+		{" 2 - 3 ,4 ", []int{1, 2, 3}, false},
+		{"0", nil, true},
+		{"5", nil, true},
+		{"3-2", nil, true},
+		{"a", nil, true},
+		{"", nil, true},
+		{" , ", nil, true},
+	}
+
+	for _, c := range cases {
+		out, err := parseSelection(c.in, 4)
+		if (err != nil) != c.err {
+			t.Fatalf("Unexpected error parsing %q: %v", c.in, err)
+		}
+		if !c.err && !reflect.DeepEqual(out, c.out) {
+			t.Fatalf("Expected %q to select %v, got %v", c.in, c.out, out)
+		}
+	}
+}
+
+func TestReadLine(t *testing.T) {
+	r := strings.NewReader("1, 3\r\n2 4\nlast")
+	for _, expected := range []string{"1, 3", "2 4", "last"} {
+		line, err := readLine(r)
+		if err != nil {
+			t.Fatalf("Error reading %q: %v", expected, err)
+		}
+		if line != expected {
+			t.Fatalf("Expected %q, got %q", expected, line)
+		}
+	}
+	if _, err := readLine(r); err == nil {
+		t.Fatalf("Expected an error at the end of the input")
+	}
+}
@@ -0,0 +1,79 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// plainInterval is how often the progress of a download is logged.
+var plainInterval = 10 * time.Second
+
+// plain logs the progress of the downloads as lines of text.
+type plain struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func newPlain(w io.Writer) *plain {
+	return &plain{w: w}
+}
+
+func (p *plain) printf(format string, args ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.w, format+"\n", args...)
+}
+
+func (p *plain) Start(name string, total int64) Bar {
+	if total > 0 {
+		p.printf("Downloading %s (%s)", name, formatBytes(total))
+	} else {
+		p.printf("Downloading %s", name)
+	}
+	now := time.Now()
+	return &plainBar{p: p, name: name, total: total, started: now, logged: now}
+}
+
+type plainBar struct {
+	mu       sync.Mutex
+	p        *plain
+	name     string
+	total    int64
+	current  int64
+	started  time.Time
+	logged   time.Time
+	finished bool
+}
+
+func (b *plainBar) SetTotal(total int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.total = total
+}
+
+func (b *plainBar) SetCurrent(current int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.current = current
+	if time.Since(b.logged) < plainInterval {
+		return
+	}
+	b.logged = time.Now()
+	if b.total > 0 {
+		b.p.printf("Downloading %s: %s of %s (%d%%)", b.name, formatBytes(b.current), formatBytes(b.total), b.current*100/b.total)
+	} else {
+		b.p.printf("Downloading %s: %s", b.name, formatBytes(b.current))
+	}
+}
+
+func (b *plainBar) Finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.finished {
+		return
+	}
+	b.finished = true
+	b.p.printf("Downloaded %s (%s) in %s", b.name, formatBytes(b.current), time.Since(b.started).Round(100*time.Millisecond))
+}
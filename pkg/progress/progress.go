@@ -0,0 +1,134 @@
+// Package progress reports the progress of downloads. On a terminal every
+// download gets its own progress bar so concurrent downloads don't garble
+// each other, elsewhere (CI logs, pipes) the progress is logged as plain
+// lines, and nothing is reported in quiet mode.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/mattn/go-isatty"
+)
+
+// Mode selects how the progress is reported.
+type Mode string
+
+const (
+	// Auto picks TTY or Plain depending on the output
+	Auto Mode = "auto"
+	// TTY draws a progress bar per download
+	TTY Mode = "tty"
+	// Plain logs the progress as lines of text
+	Plain Mode = "plain"
+	// Quiet doesn't report any progress
+	Quiet Mode = "quiet"
+)
+
+// Bar tracks the progress of a single download.
+type Bar interface {
+	SetTotal(total int64)
+	SetCurrent(current int64)
+	// Finish stops reporting the progress of the download
+	Finish()
+}
+
+// Reporter starts the bars of the downloads.
+type Reporter interface {
+	Start(name string, total int64) Bar
+}
+
+var (
+	mu       sync.Mutex
+	reporter Reporter
+)
+
+// New returns the reporter of mode writing to w.
+func New(mode Mode, w io.Writer) Reporter {
+	if mode == Auto {
+		mode = Detect(w)
+	}
+	switch mode {
+	case TTY:
+		return newTerminal(w)
+	case Quiet:
+		return quiet{}
+	default:
+		return newPlain(w)
+	}
+}
+
+// Detect returns TTY if w is a terminal and Plain otherwise.
+func Detect(w io.Writer) Mode {
+	f, ok := w.(*os.File)
+	if !ok || os.Getenv("CI") != "" || os.Getenv("TERM") == "dumb" {
+		return Plain
+	}
+	if isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd()) {
+		return TTY
+	}
+	return Plain
+}
+
+// Set replaces the reporter used by Start.
+func Set(r Reporter) {
+	mu.Lock()
+	defer mu.Unlock()
+	reporter = r
+}
+
+// Start starts reporting the progress of the download of name,
+// total is the expected size or 0 if it isn't known.
+func Start(name string, total int64) Bar {
+	mu.Lock()
+	if reporter == nil {
+		reporter = New(Auto, os.Stderr)
+	}
+	r := reporter
+	mu.Unlock()
+	return r.Start(name, total)
+}
+
+// Writer wraps the output w of a logger, the lines written while
+// progress bars are drawn are printed above the bars instead of
+// being overwritten by them.
+func Writer(w io.Writer) io.Writer {
+	return &logWriter{w: w}
+}
+
+type logWriter struct {
+	w io.Writer
+}
+
+func (l *logWriter) Write(p []byte) (int, error) {
+	mu.Lock()
+	t, ok := reporter.(*terminal)
+	mu.Unlock()
+	if !ok {
+		return l.w.Write(p)
+	}
+	return t.writeAbove(l.w, p)
+}
+
+type quiet struct{}
+
+func (quiet) Start(string, int64) Bar { return quiet{} }
+func (quiet) SetTotal(int64)          {}
+func (quiet) SetCurrent(int64)        {}
+func (quiet) Finish()                 {}
+
+// formatBytes formats a size in bytes with a binary unit.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,114 @@
+package progress
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetect(t *testing.T) {
+	if m := Detect(new(bytes.Buffer)); m != Plain {
+		t.Fatalf("Expected plain progress when not writing to a terminal, got %s", m)
+	}
+}
+
+func TestPlain(t *testing.T) {
+	interval := plainInterval
+	plainInterval = 0
+	defer func() { plainInterval = interval }()
+
+	buf := new(bytes.Buffer)
+	b := New(Plain, buf).Start("bin.tar.gz", 2048)
+	b.SetCurrent(1024)
+	b.SetCurrent(2048)
+	b.Finish()
+	b.Finish()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expected := []string{
+		"Downloading bin.tar.gz (2.0 KiB)",
+		"Downloading bin.tar.gz: 1.0 KiB of 2.0 KiB (50%)",
+		"Downloading bin.tar.gz: 2.0 KiB of 2.0 KiB (100%)",
+	}
+	if len(lines) != len(expected)+1 {
+		t.Fatalf("Unexpected output %q", buf.String())
+	}
+	for i, l := range expected {
+		if lines[i] != l {
+			t.Fatalf("Expected %q, got %q", l, lines[i])
+		}
+	}
+	if !strings.HasPrefix(lines[3], "Downloaded bin.tar.gz (2.0 KiB) in ") {
+		t.Fatalf("Unexpected last line %q", lines[3])
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	buf := new(bytes.Buffer)
+	b := New(Quiet, buf).Start("bin.tar.gz", 2048)
+	b.SetCurrent(2048)
+	b.Finish()
+	if buf.Len() != 0 {
+		t.Fatalf("Expected no output, got %q", buf.String())
+	}
+}
+
+func TestTerminal(t *testing.T) {
+	buf := new(bytes.Buffer)
+	r := newTerminal(buf)
+	a := r.Start("a.tar.gz", 100)
+	b := r.Start("b.tar.gz", 100)
+	a.SetCurrent(100)
+	a.Finish()
+	b.SetCurrent(50)
+	time.Sleep(2 * refreshRate)
+	b.SetCurrent(100)
+	b.Finish()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.bars) != 0 || r.stop != nil {
+		t.Fatalf("Expected the bars to be released once every download finished")
+	}
+
+	// both bars are drawn on their own line and redrawn in place
+	out := buf.String()
+	if !strings.Contains(out, "a.tar.gz") || !strings.Contains(out, "b.tar.gz") || !strings.Contains(out, "\x1b[2A") {
+		t.Fatalf("Unexpected output %q", out)
+	}
+}
+
+func TestTerminalWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	r := newTerminal(buf)
+	Set(r)
+	defer Set(nil)
+
+	b := r.Start("bin.tar.gz", 100)
+	r.mu.Lock()
+	r.render()
+	r.mu.Unlock()
+	if _, err := Writer(buf).Write([]byte("WARN retrying\n")); err != nil {
+		t.Fatal(err)
+	}
+	b.Finish()
+
+	// the bar is cleared before the log line and drawn again below it
+	out := buf.String()
+	i := strings.Index(out, "\x1b[1A\x1b[J")
+	j := strings.Index(out, "WARN retrying\n")
+	k := strings.LastIndex(out, "bin.tar.gz")
+	if i < 0 || j < i || k < j {
+		t.Fatalf("Unexpected output %q", out)
+	}
+
+	// without bars the lines are written as is
+	buf.Reset()
+	if _, err := Writer(buf).Write([]byte("INFO done\n")); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "INFO done\n" {
+		t.Fatalf("Unexpected output %q", buf.String())
+	}
+}
@@ -0,0 +1,117 @@
+package progress
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/cheggaaa/pb"
+)
+
+const refreshRate = 150 * time.Millisecond
+
+// terminal draws a progress bar per download and redraws them all
+// in place, so concurrent downloads each keep their own line.
+type terminal struct {
+	mu    sync.Mutex
+	w     io.Writer
+	bars  []*terminalBar
+	lines int
+	stop  chan struct{}
+}
+
+func newTerminal(w io.Writer) *terminal {
+	return &terminal{w: w}
+}
+
+func (t *terminal) Start(name string, total int64) Bar {
+	b := &terminalBar{t: t, pb: pb.New64(total).SetTemplate(pb.Full).Set(pb.Bytes, true).Set("prefix", name+" ")}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.bars = append(t.bars, b)
+	if t.stop == nil {
+		t.stop = make(chan struct{})
+		go t.run(t.stop)
+	}
+	return b
+}
+
+func (t *terminal) run(stop chan struct{}) {
+	ticker := time.NewTicker(refreshRate)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.mu.Lock()
+			t.render()
+			t.mu.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// render redraws the bars over the previous ones, t.mu must be held.
+func (t *terminal) render() {
+	buf := new(bytes.Buffer)
+	if t.lines > 0 {
+		fmt.Fprintf(buf, "\x1b[%dA", t.lines)
+	}
+	for _, b := range t.bars {
+		fmt.Fprintf(buf, "\r%s\x1b[K\n", b.pb.String())
+	}
+	t.lines = len(t.bars)
+	_, _ = t.w.Write(buf.Bytes())
+}
+
+// writeAbove writes p to w above the bars, which are cleared
+// first and redrawn below it so they don't overwrite p.
+func (t *terminal) writeAbove(w io.Writer, p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.lines > 0 {
+		fmt.Fprintf(t.w, "\x1b[%dA\x1b[J", t.lines)
+		t.lines = 0
+	}
+	n, err := w.Write(p)
+	if len(t.bars) > 0 {
+		t.render()
+	}
+	return n, err
+}
+
+func (t *terminal) finish(b *terminalBar) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if b.done {
+		return
+	}
+	b.done = true
+	b.pb.Finish()
+	t.render()
+
+	for _, b := range t.bars {
+		if !b.done {
+			return
+		}
+	}
+	// every download is done, the next
+	// bars are drawn below the finished ones
+	t.bars = nil
+	t.lines = 0
+	close(t.stop)
+	t.stop = nil
+}
+
+type terminalBar struct {
+	t    *terminal
+	pb   *pb.ProgressBar
+	done bool
+}
+
+func (b *terminalBar) SetTotal(total int64)     { b.pb.SetTotal(total) }
+func (b *terminalBar) SetCurrent(current int64) { b.pb.SetCurrent(current) }
+func (b *terminalBar) Finish()                  { b.t.finish(b) }
@@ -19,6 +19,12 @@ type docker struct {
 }
 
 func (d *docker) Fetch(opts *FetchOpts) (*File, error) {
+	if opts.Offline {
+		return nil, fmt.Errorf("docker image %s:%s can't be installed offline", d.repo, d.tag)
+	}
+	if opts.Platform != nil {
+		return nil, fmt.Errorf("docker image %s:%s can't be installed for %s, it runs on this host", d.repo, d.tag, opts.Platform)
+	}
 	log.Infof("Pulling docker image %s:%s", d.repo, d.tag)
 	out, err := d.client.ImageCreate(context.Background(), fmt.Sprintf("%s:%s", d.repo, d.tag), types.ImageCreateOptions{})
 	if err != nil {
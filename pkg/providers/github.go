@@ -3,6 +3,7 @@ package providers
 import (
 	"context"
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -11,6 +12,8 @@ import (
 
 	"github.com/apex/log"
 	"github.com/dfang/bin/pkg/assets"
+	"github.com/dfang/bin/pkg/cache"
+	"github.com/dfang/bin/pkg/progress"
 	"github.com/google/go-github/v53/github"
 	"github.com/rs/zerolog"
 	zlog "github.com/rs/zerolog/log"
@@ -27,34 +30,26 @@ type gitHub struct {
 }
 
 func (g *gitHub) Fetch(opts *FetchOpts) (*File, error) {
-	var release *github.RepositoryRelease
-
-	// If we have a tag, let's fetch from there
-	var err error
-	var resp *github.Response
-	if len(g.tag) > 0 {
-		// log.Infof("Getting %s release for %s/%s", g.tag, g.owner, g.repo)
-		zlog.Info().Msgf("Getting %s release for https://github.com/%s/%s", g.tag, g.owner, g.repo)
-		release, _, err = g.client.Repositories.GetReleaseByTag(context.TODO(), g.owner, g.repo, g.tag)
-	} else {
-		// log.Infof("Getting latest release for %s/%s", g.owner, g.repo)
-		zlog.Info().Msgf("Getting latest release for https://github.com/%s/%s", g.owner, g.repo)
-		release, resp, err = g.client.Repositories.GetLatestRelease(context.TODO(), g.owner, g.repo)
-		if resp != nil && resp.StatusCode == http.StatusNotFound {
-			err = fmt.Errorf("repository %s/%s does not have releases", g.owner, g.repo)
-		}
+	tag := g.tag
+	if tag == "" {
+		tag = opts.Version
 	}
+	key := cache.Key{Provider: g.GetID(), Repo: g.owner + "/" + g.repo, Version: tag}
+	release, err := cachedRelease(key, opts, func() (*release, error) { return g.getRelease(tag) })
 	if err != nil {
 		return nil, err
 	}
 
-	candidates := []*assets.Asset{}
-	for _, a := range release.Assets {
-		candidates = append(candidates, &assets.Asset{Name: a.GetName(), URL: a.GetURL(), Size: int64(*a.Size), BrowserDownloadURL: *a.BrowserDownloadURL})
-	}
+	candidates := release.Assets
 	zlog.Debug().Msgf("Possible candidates length: %d", len(candidates))
 
-	f := assets.InitFilter(g.repo, "", "", &assets.FilterOpts{SkipScoring: opts.All, PackagePath: opts.PackagePath, SkipPathCheck: opts.SkipPatchCheck})
+	fopts := opts.filterOpts()
+	if !opts.Offline {
+		fopts.Attestations = g.attestations
+	}
+	key.Version = release.Version
+	fopts.CacheKey = key
+	f := assets.InitFilter(g.repo, "", "", fopts)
 	// zlog.Trace().Msgf("filter %+v", f)
 	gf, err := f.FilterAssets(g.repo, candidates)
 	if err != nil {
@@ -67,26 +62,86 @@ func (g *gitHub) Fetch(opts *FetchOpts) (*File, error) {
 		gf.ExtraHeaders["Authorization"] = fmt.Sprintf("token %s", g.token)
 	}
 
-	fmt.Printf("gf %+v\n", gf)
+	zlog.Debug().Msgf("gf %+v", gf)
 
 	outFile, err := f.ProcessURL(gf)
 	if err != nil {
 		return nil, err
 	}
 
-	version := release.GetTagName()
+	version := release.Version
 
 	// TODO calculate file hash. Not sure if we can / should do it here
 	// since we don't want to read the file unnecessarily. Additionally, sometimes
 	// releases have .sha256 files, so it'd be nice to check for those also
 	// file := &File{Data: outFile.Source, Name: assets.SanitizeName(outFile.Name, version), Hash: sha256.New(), Version: version, PackagePath: outFile.PackagePath}
 
-	file := &File{Data: outFile.Source, Name: outFile.Name, Hash: sha256.New(), Version: version, PackagePath: outFile.PackagePath}
-	fmt.Printf("file %+v\n", file)
+	file := &File{Data: outFile.Source, Name: outFile.Name, Hash: sha256.New(), Version: version, PackagePath: outFile.PackagePath, Mode: outFile.Mode, Checksum: checksumString(outFile.Checksum), Provenance: outFile.Provenance, AssetDigest: outFile.AssetDigest}
+	file.Companions = outFile.Companions
+	file.AssetTemplate = outFile.AssetTemplate
+	for _, o := range outFile.Others {
+		file.Others = append(file.Others, file.sibling(o.Source, o.Name, o.PackagePath, o.Mode))
+	}
+	zlog.Debug().Msgf("file %+v", file)
 
 	return file, nil
 }
 
+// getRelease fetches the release of the tag, or the latest release.
+func (g *gitHub) getRelease(tag string) (*release, error) {
+	var rel *github.RepositoryRelease
+
+	// If we have a tag, let's fetch from there
+	var err error
+	var resp *github.Response
+	if len(tag) > 0 {
+		// log.Infof("Getting %s release for %s/%s", tag, g.owner, g.repo)
+		zlog.Info().Msgf("Getting %s release for https://github.com/%s/%s", tag, g.owner, g.repo)
+		rel, _, err = g.client.Repositories.GetReleaseByTag(context.TODO(), g.owner, g.repo, tag)
+	} else {
+		// log.Infof("Getting latest release for %s/%s", g.owner, g.repo)
+		zlog.Info().Msgf("Getting latest release for https://github.com/%s/%s", g.owner, g.repo)
+		rel, resp, err = g.client.Repositories.GetLatestRelease(context.TODO(), g.owner, g.repo)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			err = fmt.Errorf("repository %s/%s does not have releases", g.owner, g.repo)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r := &release{Version: rel.GetTagName()}
+	for _, a := range rel.Assets {
+		r.Assets = append(r.Assets, &assets.Asset{Name: a.GetName(), URL: a.GetURL(), Size: int64(a.GetSize()), BrowserDownloadURL: a.GetBrowserDownloadURL()})
+	}
+	return r, nil
+}
+
+// attestations returns the Sigstore bundles of the artifact attestations
+// published in the repository for the given sha256 digest.
+func (g *gitHub) attestations(digest string) ([][]byte, error) {
+	u := fmt.Sprintf("repos/%s/%s/attestations/sha256:%s", g.owner, g.repo, digest)
+	req, err := g.client.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Attestations []struct {
+			Bundle json.RawMessage `json:"bundle"`
+		} `json:"attestations"`
+	}
+	if _, err := g.client.Do(context.TODO(), req, &res); err != nil {
+		return nil, err
+	}
+
+	bundles := [][]byte{}
+	for _, a := range res.Attestations {
+		bundles = append(bundles, a.Bundle)
+	}
+	return bundles, nil
+}
+
 // GetLatestVersion checks the latest repo release and
 // returns the corresponding name and url to fetch the version.
 func (g *gitHub) GetLatestVersion() (string, string, error) {
@@ -157,7 +212,7 @@ func newGitHub(u *url.URL) (Provider, error) {
 }
 
 func initLogger() {
-	output := zerolog.ConsoleWriter{Out: os.Stdout}
+	output := zerolog.ConsoleWriter{Out: progress.Writer(os.Stdout)}
 	output.TimeFormat = "2006-01-02 15:04:05" // Customize the timestamp format if needed
 	// output.FormatLevel = func(i interface{}) string {
 	// 	return colorizeLevel(i.(string))
@@ -13,6 +13,7 @@ import (
 	"github.com/apex/log"
 	"github.com/coreos/go-semver/semver"
 	"github.com/dfang/bin/pkg/assets"
+	"github.com/dfang/bin/pkg/cache"
 	"github.com/dfang/bin/pkg/options"
 )
 
@@ -39,6 +40,16 @@ func (g *hashiCorp) buildHashiCorpAPIURL(args ...string) string {
 	return apiURL.String()
 }
 
+// buildHashiCorpDownloadURL returns the URL of a file published
+// for a release, e.g. the SHA256SUMS file.
+func (g *hashiCorp) buildHashiCorpDownloadURL(args ...string) string {
+	downloadURL := &url.URL{}
+	*downloadURL = *g.baseURL
+	downloadURL.Path = path.Join(args...)
+
+	return downloadURL.String()
+}
+
 func (g *hashiCorp) getRelease(repoName, version string) (*hashiCorpRelease, error) {
 	releaseURL := g.buildHashiCorpAPIURL(repoName, version)
 	resp, err := g.client.Get(releaseURL)
@@ -72,32 +83,21 @@ func (g *hashiCorp) GetID() string {
 }
 
 func (g *hashiCorp) Fetch(opts *FetchOpts) (*File, error) {
-	var release *hashiCorpRelease
-
-	// If we have a tag, let's fetch from there
-	var err error
-	if len(g.tag) > 0 {
-		log.Infof("Getting %s release for %s", g.tag, g.repo)
-		release, err = g.getRelease(g.repo, g.tag)
-	} else {
-		var version string
-		version, _, err = g.GetLatestVersion()
-		if err != nil {
-			return nil, err
-		}
-		release, err = g.getRelease(g.repo, version)
+	tag := g.tag
+	if tag == "" {
+		tag = opts.Version
 	}
-
+	key := cache.Key{Provider: g.GetID(), Repo: g.repo, Version: tag}
+	release, err := cachedRelease(key, opts, func() (*release, error) { return g.fetchRelease(tag) })
 	if err != nil {
 		return nil, err
 	}
+	candidates := release.Assets
 
-	candidates := []*assets.Asset{}
-	for _, link := range release.Builds {
-		candidates = append(candidates, &assets.Asset{Name: link.Filename, URL: link.URL})
-	}
-
-	f := assets.NewFilter(&assets.FilterOpts{SkipScoring: opts.All, PackagePath: opts.PackagePath, SkipPathCheck: opts.SkipPatchCheck})
+	fopts := opts.filterOpts()
+	key.Version = release.Version
+	fopts.CacheKey = key
+	f := assets.NewFilter(fopts)
 	gf, err := f.FilterAssets(g.repo, candidates)
 	if err != nil {
 		return nil, err
@@ -113,11 +113,49 @@ func (g *hashiCorp) Fetch(opts *FetchOpts) (*File, error) {
 	// TODO calculate file hash. Not sure if we can / should do it here
 	// since we don't want to read the file unnecessarily. Additionally, sometimes
 	// releases have .sha256 files, so it'd be nice to check for those also
-	file := &File{Data: outFile.Source, Name: assets.SanitizeName(outFile.Name, version), Hash: sha256.New(), Version: version}
+	file := &File{Data: outFile.Source, Name: assets.SanitizeName(outFile.Name, version), Hash: sha256.New(), Version: version, Mode: outFile.Mode, Checksum: checksumString(outFile.Checksum), Provenance: outFile.Provenance, AssetDigest: outFile.AssetDigest}
+	file.Companions = outFile.Companions
+	file.AssetTemplate = outFile.AssetTemplate
+	for _, o := range outFile.Others {
+		file.Others = append(file.Others, file.sibling(o.Source, assets.SanitizeName(o.Name, version), o.PackagePath, o.Mode))
+	}
 
 	return file, nil
 }
 
+// fetchRelease fetches the release of the tag, or the latest release.
+func (g *hashiCorp) fetchRelease(tag string) (*release, error) {
+	var rel *hashiCorpRelease
+
+	// If we have a tag, let's fetch from there
+	var err error
+	if len(tag) > 0 {
+		log.Infof("Getting %s release for %s", tag, g.repo)
+		rel, err = g.getRelease(g.repo, tag)
+	} else {
+		var version string
+		version, _, err = g.GetLatestVersion()
+		if err != nil {
+			return nil, err
+		}
+		rel, err = g.getRelease(g.repo, version)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	r := &release{Version: rel.Version}
+	for _, link := range rel.Builds {
+		r.Assets = append(r.Assets, &assets.Asset{Name: link.Filename, URL: link.URL, BrowserDownloadURL: link.URL})
+	}
+	if len(rel.Shasums) > 0 {
+		shasumsURL := g.buildHashiCorpDownloadURL(g.repo, rel.Version, rel.Shasums)
+		r.Assets = append(r.Assets, &assets.Asset{Name: rel.Shasums, URL: shasumsURL, BrowserDownloadURL: shasumsURL})
+	}
+	return r, nil
+}
+
 // GetLatestVersion checks the latest repo release and
 // returns the corresponding name and url to fetch the version.
 func (g *hashiCorp) GetLatestVersion() (string, string, error) {
@@ -1,30 +1,98 @@
 package providers
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"hash"
 	"io"
+	"net"
 	"net/url"
+	"os"
 	"regexp"
 	"strings"
+
+	"github.com/dfang/bin/pkg/assets"
+	"github.com/dfang/bin/pkg/cache"
+	"github.com/dfang/bin/pkg/config"
+	zlog "github.com/rs/zerolog/log"
 )
 
 var ErrInvalidProvider = errors.New("invalid provider")
 
 type File struct {
+	// Data is the content of the binary, callers have to
+	// close it if it implements io.Closer
 	Data        io.Reader
 	Name        string
 	Hash        hash.Hash
 	Version     string
 	Length      int64
 	PackagePath string
+	// Mode is the mode of the binary in the archive
+	// of the asset, 0 if unknown or not an archive
+	Mode os.FileMode
+	// Checksum is the upstream checksum the downloaded asset was
+	// verified against, in the <algorithm>:<digest> form
+	Checksum string
+	// Provenance is the verified provenance of the downloaded asset
+	Provenance *config.Provenance
+	// AssetDigest is the digest of the downloaded asset, nil if the
+	// provider doesn't download one (docker)
+	AssetDigest *config.Digest
+	// AssetTemplate is the name of the asset with the version replaced,
+	// set when the user selected it among several candidates
+	AssetTemplate string
+	// Others are the other binaries picked from the same asset,
+	// see FetchOpts.Pick, callers have to close their Data too
+	Others []*File
+	// Companions are the shell completions and man pages of
+	// the asset, see FetchOpts.Companions, callers have to
+	// close their Source too
+	Companions []*assets.Companion
+}
+
+// sibling returns the file of another binary picked from
+// the same asset as f, it shares the release metadata of f.
+func (f *File) sibling(data io.Reader, name, packagePath string, mode os.FileMode) *File {
+	return &File{Data: data, Name: name, Hash: sha256.New(), Version: f.Version, PackagePath: packagePath, Mode: mode, Checksum: f.Checksum, Provenance: f.Provenance, AssetDigest: f.AssetDigest, AssetTemplate: f.AssetTemplate}
 }
 
 type FetchOpts struct {
 	All            bool
 	PackagePath    string
 	SkipPatchCheck bool
+	// Pick selects several files of the archive with globs, or
+	// the package paths of the binaries of a bundle on updates
+	Pick []string
+	// PickMany prompts to select several files of the archive
+	PickMany bool
+	// Companions fetches the shell completions
+	// and man pages shipped with the binary
+	Companions bool
+
+	RequireChecksum bool
+	SkipChecksum    bool
+
+	// Platform is the platform to install the binary
+	// for, nil for the one bin runs on
+	Platform *config.Platform
+
+	// Rules are the asset selection rules of the binary
+	Rules *config.AssetRules
+	// AssetTemplate selects the same asset as the user did
+	// for a previous version, see File.AssetTemplate
+	AssetTemplate string
+
+	// Verification is the signature verification policy of the binary
+	Verification *config.Verification
+
+	// Offline installs the release from the download cache
+	// without reaching the provider
+	Offline bool
+	// Version is the release to install if the URL doesn't
+	// point to a specific release, the latest one otherwise
+	Version string
 }
 
 type Provider interface {
@@ -39,6 +107,109 @@ type Provider interface {
 	GetID() string
 }
 
+func (o *FetchOpts) filterOpts() *assets.FilterOpts {
+	return &assets.FilterOpts{
+		SkipScoring:     o.All,
+		PackagePath:     o.PackagePath,
+		SkipPathCheck:   o.SkipPatchCheck,
+		Pick:            o.Pick,
+		PickMany:        o.PickMany,
+		Companions:      o.Companions,
+		RequireChecksum: o.RequireChecksum,
+		SkipChecksum:    o.SkipChecksum,
+		Platform:        o.Platform,
+		Rules:           o.Rules,
+		AssetTemplate:   o.AssetTemplate,
+		Verification:    o.Verification,
+		Offline:         o.Offline,
+	}
+}
+
+// Fetch fetches the binary with p. If the provider can't be reached,
+// it falls back to the release kept in the download cache.
+func Fetch(p Provider, opts *FetchOpts) (*File, error) {
+	f, err := p.Fetch(opts)
+	if err == nil || opts.Offline || !IsNetworkError(err) {
+		return f, err
+	}
+
+	zlog.Warn().Err(err).Msgf("Could not reach %s, trying the download cache", p.GetID())
+	offline := *opts
+	offline.Offline = true
+	f, cerr := p.Fetch(&offline)
+	if cerr != nil {
+		return nil, fmt.Errorf("%w (offline fallback: %w)", err, cerr)
+	}
+	return f, nil
+}
+
+// IsNetworkError tells if err was caused by the network
+// being unreachable or timing out.
+func IsNetworkError(err error) bool {
+	var urlErr *url.Error
+	var netErr net.Error
+	return errors.As(err, &urlErr) || errors.As(err, &netErr)
+}
+
+// release is the metadata of a release kept in the
+// download cache to install it offline.
+type release struct {
+	Version string          `json:"version"`
+	Assets  []*assets.Asset `json:"assets"`
+}
+
+// cachedRelease returns the release identified by key. Online, the release is
+// fetched and its metadata cached; offline, it's loaded from the cache using
+// the version of key, the requested version or the only cached version.
+func cachedRelease(key cache.Key, opts *FetchOpts, fetch func() (*release, error)) (*release, error) {
+	c := cache.Default()
+	if !opts.Offline {
+		r, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+		if c.Dir() != "" {
+			key.Version = r.Version
+			if err := c.StoreRelease(key, r); err != nil {
+				zlog.Debug().Err(err).Msgf("Could not cache the release metadata of %s", key.Repo)
+			}
+		}
+		return r, nil
+	}
+
+	if key.Version == "" {
+		key.Version = opts.Version
+	}
+	if key.Version == "" {
+		versions, err := c.Releases(key)
+		if err != nil {
+			return nil, err
+		}
+		switch len(versions) {
+		case 0:
+			return nil, fmt.Errorf("release %s/%s: %w", key.Provider, key.Repo, cache.ErrNotCached)
+		case 1:
+			key.Version = versions[0]
+		default:
+			return nil, fmt.Errorf("several releases of %s/%s are cached (%s), specify the version to install offline", key.Provider, key.Repo, strings.Join(versions, ", "))
+		}
+	}
+
+	zlog.Info().Msgf("Using the cached %s release of %s", key.Version, key.Repo)
+	var r release
+	if err := c.LookupRelease(key, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func checksumString(c *assets.Checksum) string {
+	if c == nil {
+		return ""
+	}
+	return c.String()
+}
+
 var (
 	httpURLPrefix   = regexp.MustCompile("^https?://")
 	dockerURLPrefix = regexp.MustCompile("^docker://")
@@ -0,0 +1,57 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/dfang/bin/pkg/cache"
+)
+
+func TestIsNetworkError(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected bool
+	}{
+		{&url.Error{Op: "Get", URL: "https://api.github.com", Err: errors.New("no such host")}, true},
+		{fmt.Errorf("error downloading: %w", context.DeadlineExceeded), true},
+		{errors.New("repository owner/repo does not have releases"), false},
+	}
+
+	for _, c := range cases {
+		if got := IsNetworkError(c.err); got != c.expected {
+			t.Errorf("IsNetworkError(%v) = %v, expected %v", c.err, got, c.expected)
+		}
+	}
+}
+
+// unreachable is a provider whose releases can't be fetched
+// online and aren't in the download cache.
+type unreachable struct{}
+
+func (unreachable) Fetch(opts *FetchOpts) (*File, error) {
+	if opts.Offline {
+		return nil, fmt.Errorf("release unreachable/tool: %w", cache.ErrNotCached)
+	}
+	return nil, &url.Error{Op: "Get", URL: "https://unreachable", Err: errors.New("no such host")}
+}
+
+func (unreachable) GetLatestVersion() (string, string, error) {
+	return "", "", errors.New("unreachable")
+}
+
+func (unreachable) GetID() string {
+	return "unreachable"
+}
+
+func TestFetchOfflineFallback(t *testing.T) {
+	_, err := Fetch(unreachable{}, &FetchOpts{})
+	if !IsNetworkError(err) {
+		t.Errorf("Expected the network error to be kept, got %v", err)
+	}
+	if !errors.Is(err, cache.ErrNotCached) {
+		t.Errorf("Expected the offline fallback error to be kept, got %v", err)
+	}
+}